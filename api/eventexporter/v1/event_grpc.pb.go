@@ -0,0 +1,460 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: eventexporter/v1/event.proto
+
+package eventexporterv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// EventSinkClient is the client API for EventSink service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type EventSinkClient interface {
+	// Stream pushes the events to the receiver, every event must be acknowledged
+	// with its sequence. The unacknowledged events are sent again on a new stream,
+	// the receiver should deduplicate them by sequence or event uid.
+	Stream(ctx context.Context, opts ...grpc.CallOption) (EventSink_StreamClient, error)
+}
+
+type eventSinkClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEventSinkClient(cc grpc.ClientConnInterface) EventSinkClient {
+	return &eventSinkClient{cc}
+}
+
+func (c *eventSinkClient) Stream(ctx context.Context, opts ...grpc.CallOption) (EventSink_StreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &EventSink_ServiceDesc.Streams[0], "/eventexporter.v1.EventSink/Stream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &eventSinkStreamClient{stream}
+	return x, nil
+}
+
+type EventSink_StreamClient interface {
+	Send(*StreamRequest) error
+	Recv() (*StreamResponse, error)
+	grpc.ClientStream
+}
+
+type eventSinkStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *eventSinkStreamClient) Send(m *StreamRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *eventSinkStreamClient) Recv() (*StreamResponse, error) {
+	m := new(StreamResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// EventSinkServer is the server API for EventSink service.
+// All implementations must embed UnimplementedEventSinkServer
+// for forward compatibility
+type EventSinkServer interface {
+	// Stream pushes the events to the receiver, every event must be acknowledged
+	// with its sequence. The unacknowledged events are sent again on a new stream,
+	// the receiver should deduplicate them by sequence or event uid.
+	Stream(EventSink_StreamServer) error
+	mustEmbedUnimplementedEventSinkServer()
+}
+
+// UnimplementedEventSinkServer must be embedded to have forward compatible implementations.
+type UnimplementedEventSinkServer struct {
+}
+
+func (UnimplementedEventSinkServer) Stream(EventSink_StreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method Stream not implemented")
+}
+func (UnimplementedEventSinkServer) mustEmbedUnimplementedEventSinkServer() {}
+
+// UnsafeEventSinkServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EventSinkServer will
+// result in compilation errors.
+type UnsafeEventSinkServer interface {
+	mustEmbedUnimplementedEventSinkServer()
+}
+
+func RegisterEventSinkServer(s grpc.ServiceRegistrar, srv EventSinkServer) {
+	s.RegisterService(&EventSink_ServiceDesc, srv)
+}
+
+func _EventSink_Stream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(EventSinkServer).Stream(&eventSinkStreamServer{stream})
+}
+
+type EventSink_StreamServer interface {
+	Send(*StreamResponse) error
+	Recv() (*StreamRequest, error)
+	grpc.ServerStream
+}
+
+type eventSinkStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *eventSinkStreamServer) Send(m *StreamResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *eventSinkStreamServer) Recv() (*StreamRequest, error) {
+	m := new(StreamRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// EventSink_ServiceDesc is the grpc.ServiceDesc for EventSink service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var EventSink_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "eventexporter.v1.EventSink",
+	HandlerType: (*EventSinkServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Stream",
+			Handler:       _EventSink_Stream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "eventexporter/v1/event.proto",
+}
+
+// EventSubscriberClient is the client API for EventSubscriber service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type EventSubscriberClient interface {
+	// Subscribe streams the events matched by the rule until the client cancels, the
+	// events are dropped when the client is too slow to receive them.
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (EventSubscriber_SubscribeClient, error)
+}
+
+type eventSubscriberClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEventSubscriberClient(cc grpc.ClientConnInterface) EventSubscriberClient {
+	return &eventSubscriberClient{cc}
+}
+
+func (c *eventSubscriberClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (EventSubscriber_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &EventSubscriber_ServiceDesc.Streams[0], "/eventexporter.v1.EventSubscriber/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &eventSubscriberSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type EventSubscriber_SubscribeClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type eventSubscriberSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *eventSubscriberSubscribeClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// EventSubscriberServer is the server API for EventSubscriber service.
+// All implementations must embed UnimplementedEventSubscriberServer
+// for forward compatibility
+type EventSubscriberServer interface {
+	// Subscribe streams the events matched by the rule until the client cancels, the
+	// events are dropped when the client is too slow to receive them.
+	Subscribe(*SubscribeRequest, EventSubscriber_SubscribeServer) error
+	mustEmbedUnimplementedEventSubscriberServer()
+}
+
+// UnimplementedEventSubscriberServer must be embedded to have forward compatible implementations.
+type UnimplementedEventSubscriberServer struct {
+}
+
+func (UnimplementedEventSubscriberServer) Subscribe(*SubscribeRequest, EventSubscriber_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedEventSubscriberServer) mustEmbedUnimplementedEventSubscriberServer() {}
+
+// UnsafeEventSubscriberServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EventSubscriberServer will
+// result in compilation errors.
+type UnsafeEventSubscriberServer interface {
+	mustEmbedUnimplementedEventSubscriberServer()
+}
+
+func RegisterEventSubscriberServer(s grpc.ServiceRegistrar, srv EventSubscriberServer) {
+	s.RegisterService(&EventSubscriber_ServiceDesc, srv)
+}
+
+func _EventSubscriber_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EventSubscriberServer).Subscribe(m, &eventSubscriberSubscribeServer{stream})
+}
+
+type EventSubscriber_SubscribeServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type eventSubscriberSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *eventSubscriberSubscribeServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// EventSubscriber_ServiceDesc is the grpc.ServiceDesc for EventSubscriber service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var EventSubscriber_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "eventexporter.v1.EventSubscriber",
+	HandlerType: (*EventSubscriberServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _EventSubscriber_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "eventexporter/v1/event.proto",
+}
+
+// SinkPluginClient is the client API for SinkPlugin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SinkPluginClient interface {
+	// Configure is called once after the plugin starts.
+	Configure(ctx context.Context, in *ConfigureRequest, opts ...grpc.CallOption) (*ConfigureResponse, error)
+	Send(ctx context.Context, in *SendRequest, opts ...grpc.CallOption) (*SendResponse, error)
+	// ObjectDeleted notifies that the involved object is deleted, it's optional.
+	ObjectDeleted(ctx context.Context, in *ObjectDeletedRequest, opts ...grpc.CallOption) (*ObjectDeletedResponse, error)
+	// Close is called before the plugin is killed.
+	Close(ctx context.Context, in *CloseRequest, opts ...grpc.CallOption) (*CloseResponse, error)
+}
+
+type sinkPluginClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSinkPluginClient(cc grpc.ClientConnInterface) SinkPluginClient {
+	return &sinkPluginClient{cc}
+}
+
+func (c *sinkPluginClient) Configure(ctx context.Context, in *ConfigureRequest, opts ...grpc.CallOption) (*ConfigureResponse, error) {
+	out := new(ConfigureResponse)
+	err := c.cc.Invoke(ctx, "/eventexporter.v1.SinkPlugin/Configure", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sinkPluginClient) Send(ctx context.Context, in *SendRequest, opts ...grpc.CallOption) (*SendResponse, error) {
+	out := new(SendResponse)
+	err := c.cc.Invoke(ctx, "/eventexporter.v1.SinkPlugin/Send", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sinkPluginClient) ObjectDeleted(ctx context.Context, in *ObjectDeletedRequest, opts ...grpc.CallOption) (*ObjectDeletedResponse, error) {
+	out := new(ObjectDeletedResponse)
+	err := c.cc.Invoke(ctx, "/eventexporter.v1.SinkPlugin/ObjectDeleted", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sinkPluginClient) Close(ctx context.Context, in *CloseRequest, opts ...grpc.CallOption) (*CloseResponse, error) {
+	out := new(CloseResponse)
+	err := c.cc.Invoke(ctx, "/eventexporter.v1.SinkPlugin/Close", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SinkPluginServer is the server API for SinkPlugin service.
+// All implementations must embed UnimplementedSinkPluginServer
+// for forward compatibility
+type SinkPluginServer interface {
+	// Configure is called once after the plugin starts.
+	Configure(context.Context, *ConfigureRequest) (*ConfigureResponse, error)
+	Send(context.Context, *SendRequest) (*SendResponse, error)
+	// ObjectDeleted notifies that the involved object is deleted, it's optional.
+	ObjectDeleted(context.Context, *ObjectDeletedRequest) (*ObjectDeletedResponse, error)
+	// Close is called before the plugin is killed.
+	Close(context.Context, *CloseRequest) (*CloseResponse, error)
+	mustEmbedUnimplementedSinkPluginServer()
+}
+
+// UnimplementedSinkPluginServer must be embedded to have forward compatible implementations.
+type UnimplementedSinkPluginServer struct {
+}
+
+func (UnimplementedSinkPluginServer) Configure(context.Context, *ConfigureRequest) (*ConfigureResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Configure not implemented")
+}
+func (UnimplementedSinkPluginServer) Send(context.Context, *SendRequest) (*SendResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Send not implemented")
+}
+func (UnimplementedSinkPluginServer) ObjectDeleted(context.Context, *ObjectDeletedRequest) (*ObjectDeletedResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ObjectDeleted not implemented")
+}
+func (UnimplementedSinkPluginServer) Close(context.Context, *CloseRequest) (*CloseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Close not implemented")
+}
+func (UnimplementedSinkPluginServer) mustEmbedUnimplementedSinkPluginServer() {}
+
+// UnsafeSinkPluginServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SinkPluginServer will
+// result in compilation errors.
+type UnsafeSinkPluginServer interface {
+	mustEmbedUnimplementedSinkPluginServer()
+}
+
+func RegisterSinkPluginServer(s grpc.ServiceRegistrar, srv SinkPluginServer) {
+	s.RegisterService(&SinkPlugin_ServiceDesc, srv)
+}
+
+func _SinkPlugin_Configure_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConfigureRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SinkPluginServer).Configure(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/eventexporter.v1.SinkPlugin/Configure",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SinkPluginServer).Configure(ctx, req.(*ConfigureRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SinkPlugin_Send_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SinkPluginServer).Send(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/eventexporter.v1.SinkPlugin/Send",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SinkPluginServer).Send(ctx, req.(*SendRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SinkPlugin_ObjectDeleted_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ObjectDeletedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SinkPluginServer).ObjectDeleted(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/eventexporter.v1.SinkPlugin/ObjectDeleted",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SinkPluginServer).ObjectDeleted(ctx, req.(*ObjectDeletedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SinkPlugin_Close_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CloseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SinkPluginServer).Close(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/eventexporter.v1.SinkPlugin/Close",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SinkPluginServer).Close(ctx, req.(*CloseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// SinkPlugin_ServiceDesc is the grpc.ServiceDesc for SinkPlugin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SinkPlugin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "eventexporter.v1.SinkPlugin",
+	HandlerType: (*SinkPluginServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Configure",
+			Handler:    _SinkPlugin_Configure_Handler,
+		},
+		{
+			MethodName: "Send",
+			Handler:    _SinkPlugin_Send_Handler,
+		},
+		{
+			MethodName: "ObjectDeleted",
+			Handler:    _SinkPlugin_ObjectDeleted_Handler,
+		},
+		{
+			MethodName: "Close",
+			Handler:    _SinkPlugin_Close_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "eventexporter/v1/event.proto",
+}
@@ -0,0 +1,64 @@
+// eventexporter-sink-jsonfile is an example sink plugin which appends the events as JSON
+// lines to a file. Put it in the plugin directory and configure it as receiver jsonfile,
+// the name file is taken by the built-in receiver.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+
+	eventexporterv1 "github.com/champly/eventexporter/api/eventexporter/v1"
+	"github.com/champly/eventexporter/pkg/plugin"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+type jsonFileSink struct {
+	sync.Mutex
+	Path string `json:"path"`
+	f    *os.File
+}
+
+func (s *jsonFileSink) Configure(config []byte) error {
+	if err := json.Unmarshal(config, s); err != nil {
+		return err
+	}
+	if s.Path == "" {
+		return errors.New("path must be set")
+	}
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	s.f = f
+	return nil
+}
+
+func (s *jsonFileSink) Send(ctx context.Context, ev *eventexporterv1.Event) error {
+	b, err := protojson.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	if _, err = s.f.Write(append(b, '\n')); err != nil {
+		// the disk may be full for a while.
+		return plugin.Retryable(err)
+	}
+	return nil
+}
+
+func (s *jsonFileSink) Close() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	return s.f.Close()
+}
+
+func main() {
+	plugin.Serve(&jsonFileSink{})
+}
@@ -39,9 +39,14 @@ func NewEventExporter() *cobra.Command {
 
 	// exporter
 	cmd.PersistentFlags().StringVarP(&exporter.ConfigPath, "exporter_config_path", "", exporter.ConfigPath, "Exported config path which can define multi receiver and filter rule with yaml format.")
+	cmd.PersistentFlags().StringVarP(&exporter.PluginDir, "plugin_dir", "", exporter.PluginDir, "Directory of sink plugins named eventexporter-sink-<name>, which are configured as receiver <name>.")
 
 	// controller
 	cmd.PersistentFlags().IntVarP(&controller.HttpPort, "http_port", "", controller.HttpPort, "Controller http port witch provide metrics, health, ready and debug.")
+	cmd.PersistentFlags().BoolVarP(&controller.EnableSubscription, "enable_subscription", "", controller.EnableSubscription, "Serve the events subscription api with sse, websocket and grpc on http port, it's unauthenticated unless --subscription_token is set.")
+	cmd.PersistentFlags().IntVarP(&controller.SubscriptionBuffer, "subscription_buffer", "", controller.SubscriptionBuffer, "Max events waiting to be received by each subscriber, the events are dropped when it's full.")
+	cmd.PersistentFlags().IntVarP(&controller.SubscriptionMaxSubscribers, "subscription_max_subscribers", "", controller.SubscriptionMaxSubscribers, "Max subscribers of the subscription api, the new subscribers are rejected when it's reached, 0 is unlimited.")
+	cmd.PersistentFlags().StringVarP(&controller.SubscriptionToken, "subscription_token", "", controller.SubscriptionToken, "Bearer token required in the Authorization header of subscribers, the subscription api is unauthenticated when it's empty.")
 
 	// cluster configuration manager config
 	cmd.PersistentFlags().StringVarP(&controller.ClusterCfgManagerCMNamespace, "ccm_namespace", "", controller.ClusterCfgManagerCMNamespace, "Multi cluster manager connect info, filter configmap with namespace.")
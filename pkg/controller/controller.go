@@ -111,7 +111,7 @@ func (ctrl *Controller) Reconcile(ctx context.Context, req api.WrapNamespacedNam
 	tr.Step("GetLabelsAndAnnotations")
 
 	klog.V(4).Infof("Send enhanced event %s/%s to engine.", ev.Namespace, ev.Name)
-	ctrl.engine.OnEvent(ev)
+	ctrl.engine.OnEvent(ctx, ev)
 	tr.Step("Send Event")
 
 	return api.Done, 0, nil
@@ -6,12 +6,15 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/champly/eventexporter/pkg/exporter"
 	"github.com/champly/eventexporter/pkg/kube"
 	"github.com/symcn/api"
 	"github.com/symcn/pkg/clustermanager/handler"
 	"github.com/symcn/pkg/clustermanager/predicate"
 	"github.com/symcn/pkg/clustermanager/workqueue"
 	"github.com/symcn/pkg/metrics"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
 )
@@ -22,7 +25,7 @@ var (
 
 func (ctrl *Controller) registryBeforAfterHandler() {
 	// start metrics server & probe server
-	go startMetricsServer(ctrl.ctx)
+	go startMetricsServer(ctrl.ctx, ctrl.engine.Broker)
 
 	ctrl.RegistryBeforeStartHandler(func(ctx context.Context, cli api.MingleClient) error {
 		// build queue
@@ -35,7 +38,7 @@ func (ctrl *Controller) registryBeforAfterHandler() {
 		// build labels & annotations cache
 		ctrl.Lock()
 		if _, ok := ctrl.metadataHandler[cli.GetClusterCfgInfo().GetName()]; !ok {
-			ctrl.metadataHandler[cli.GetClusterCfgInfo().GetName()] = kube.NewMetadataHandler(ctrl.ctx, cli)
+			ctrl.metadataHandler[cli.GetClusterCfgInfo().GetName()] = kube.NewMetadataHandler(ctrl.ctx, cli, ctrl.engine.OnObjectDeleted)
 		}
 		ctrl.Unlock()
 
@@ -66,8 +69,9 @@ func transformLabelsArrayToMap(ss []string) map[string]string {
 	return labels
 }
 
-// startMetricsServer start http server with prometheus route
-func startMetricsServer(ctx context.Context) {
+// startMetricsServer start http server with prometheus route, the subscription api is
+// served with h2c when it's enabled.
+func startMetricsServer(ctx context.Context, broker *exporter.Broker) {
 	server := &http.Server{
 		Addr: fmt.Sprintf(":%d", HttpPort),
 	}
@@ -78,6 +82,9 @@ func startMetricsServer(ctx context.Context) {
 	registryProbleCheck(mux)
 	initDebug(mux)
 	server.Handler = mux
+	if EnableSubscription {
+		server.Handler = h2c.NewHandler(registrySubscription(mux, broker), &http2.Server{})
+	}
 
 	go func() {
 		if err := server.ListenAndServe(); err != nil {
@@ -0,0 +1,289 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	eventexporterv1 "github.com/champly/eventexporter/api/eventexporter/v1"
+	"github.com/champly/eventexporter/pkg/exporter"
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+const (
+	subscribePath      = "/api/v1/events"
+	subscribeKeepalive = time.Second * 15
+)
+
+var (
+	EnableSubscription = false
+	SubscriptionBuffer = 100
+	// SubscriptionMaxSubscribers limits the subscribers of all the protocols, zero is unlimited.
+	SubscriptionMaxSubscribers = 100
+	// SubscriptionToken is the bearer token of subscribers, the api is unauthenticated when
+	// it's empty.
+	SubscriptionToken = ""
+)
+
+var upgrader = websocket.Upgrader{}
+
+// registrySubscription serves the subscribers with sse, websocket and grpc, the grpc
+// requests are routed by content type.
+func registrySubscription(mux *http.ServeMux, broker *exporter.Broker) http.Handler {
+	mux.HandleFunc(subscribePath, func(rw http.ResponseWriter, r *http.Request) {
+		if !validToken(r.Header.Get("Authorization")) {
+			rw.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(rw, "invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		rule, err := parseRuleQuery(r.URL.Query())
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if websocket.IsWebSocketUpgrade(r) {
+			serveWebSocket(rw, r, broker, rule)
+			return
+		}
+		serveSSE(rw, r, broker, rule)
+	})
+
+	grpcServer := grpc.NewServer(grpc.StreamInterceptor(authStreamInterceptor))
+	eventexporterv1.RegisterEventSubscriberServer(grpcServer, &subscriberServer{broker: broker})
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcServer.ServeHTTP(rw, r)
+			return
+		}
+		mux.ServeHTTP(rw, r)
+	})
+}
+
+// validToken checks the bearer token of authorization when the token is set.
+func validToken(authorization string) bool {
+	if SubscriptionToken == "" {
+		return true
+	}
+	token := strings.TrimPrefix(authorization, "Bearer ")
+	return token != authorization && subtle.ConstantTimeCompare([]byte(token), []byte(SubscriptionToken)) == 1
+}
+
+func authStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	authorization := ""
+	if md, ok := metadata.FromIncomingContext(ss.Context()); ok && len(md.Get("authorization")) > 0 {
+		authorization = md.Get("authorization")[0]
+	}
+	if !validToken(authorization) {
+		return status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+	return handler(srv, ss)
+}
+
+// subscribe registers the subscription with the limit of subscribers.
+func subscribe(broker *exporter.Broker, rule exporter.Rule) (*exporter.Subscription, error) {
+	return broker.Subscribe(rule, SubscriptionBuffer, SubscriptionMaxSubscribers)
+}
+
+// subscribeStatus is the http status code of subscribe error.
+func subscribeStatus(err error) int {
+	if errors.Is(err, exporter.ErrTooManySubscriptions) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
+// parseRuleQuery parses the rule from query, the keys are the same as exporter config,
+// labels and annotations are repeated key=value.
+func parseRuleQuery(query url.Values) (exporter.Rule, error) {
+	rule := exporter.Rule{}
+	for key, values := range query {
+		value := values[0]
+		switch strings.ToLower(key) {
+		case "labels", "annotations":
+			m := map[string]string{}
+			for _, v := range values {
+				kv := strings.SplitN(v, "=", 2)
+				if len(kv) != 2 {
+					return rule, fmt.Errorf("%s %q is not key=value", key, v)
+				}
+				m[kv[0]] = kv[1]
+			}
+			if strings.EqualFold(key, "labels") {
+				rule.Labels = m
+			} else {
+				rule.Annotations = m
+			}
+		case "message":
+			rule.Message = value
+		case "apiversion":
+			rule.APIVersion = value
+		case "kind":
+			rule.Kind = value
+		case "namespace":
+			rule.Namespace = value
+		case "reason":
+			rule.Reason = value
+		case "type":
+			rule.Type = value
+		case "mincount":
+			count, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return rule, fmt.Errorf("invalid minCount %q: %v", value, err)
+			}
+			rule.MinCount = int32(count)
+		case "component":
+			rule.Component = value
+		case "host":
+			rule.Host = value
+		default:
+			return rule, fmt.Errorf("unknown rule field %s", key)
+		}
+	}
+	return rule, rule.Validate()
+}
+
+func serveSSE(rw http.ResponseWriter, r *http.Request, broker *exporter.Broker, rule exporter.Rule) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	sub, err := subscribe(broker, rule)
+	if err != nil {
+		http.Error(rw, err.Error(), subscribeStatus(err))
+		return
+	}
+	defer closeSubscription(sub, "sse", r.RemoteAddr)
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(subscribeKeepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case ev := <-sub.Events():
+			if _, err := fmt.Fprintf(rw, "data: %s\n\n", ev.ToJSON()); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(rw, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func serveWebSocket(rw http.ResponseWriter, r *http.Request, broker *exporter.Broker, rule exporter.Rule) {
+	sub, err := subscribe(broker, rule)
+	if err != nil {
+		http.Error(rw, err.Error(), subscribeStatus(err))
+		return
+	}
+	defer closeSubscription(sub, "websocket", r.RemoteAddr)
+
+	conn, err := upgrader.Upgrade(rw, r, nil)
+	if err != nil {
+		klog.Errorf("Upgrade websocket %s failed: %+v", r.RemoteAddr, err)
+		return
+	}
+	defer conn.Close()
+
+	// the messages of client are discarded, read fails when the client closes.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(subscribeKeepalive)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case ev := <-sub.Events():
+			err = conn.WriteMessage(websocket.TextMessage, ev.ToJSON())
+		case <-ticker.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(subscribeKeepalive))
+		case <-closed:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+type subscriberServer struct {
+	eventexporterv1.UnimplementedEventSubscriberServer
+	broker *exporter.Broker
+}
+
+func (s *subscriberServer) Subscribe(req *eventexporterv1.SubscribeRequest, stream eventexporterv1.EventSubscriber_SubscribeServer) error {
+	rule := exporter.Rule{}
+	if r := req.GetRule(); r != nil {
+		rule = exporter.Rule{
+			Labels:      r.Labels,
+			Annotations: r.Annotations,
+			Message:     r.Message,
+			APIVersion:  r.ApiVersion,
+			Kind:        r.Kind,
+			Namespace:   r.Namespace,
+			Reason:      r.Reason,
+			Type:        r.Type,
+			MinCount:    r.MinCount,
+			Component:   r.Component,
+			Host:        r.Host,
+		}
+	}
+	sub, err := subscribe(s.broker, rule)
+	if errors.Is(err, exporter.ErrTooManySubscriptions) {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	remote := ""
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		remote = p.Addr.String()
+	}
+	defer closeSubscription(sub, "grpc", remote)
+
+	for {
+		select {
+		case ev := <-sub.Events():
+			if err := stream.Send(ev.ToProto()); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func closeSubscription(sub *exporter.Subscription, protocol, remote string) {
+	sub.Close()
+	if dropped := sub.Dropped(); dropped > 0 {
+		klog.Warningf("Subscriber %s %s dropped %d events", protocol, remote, dropped)
+	}
+}
@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	eventexporterv1 "github.com/champly/eventexporter/api/eventexporter/v1"
+	"github.com/champly/eventexporter/pkg/exporter"
+	"github.com/champly/eventexporter/pkg/kube"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newSubscribeTestEvent(namespace, reason string) *kube.EnhancedEvent {
+	return &kube.EnhancedEvent{
+		Event: corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "nginx." + reason, Namespace: namespace},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: namespace, Name: "nginx"},
+			Reason:         reason,
+			Type:           corev1.EventTypeWarning,
+			Count:          1,
+		},
+		InvolvedObject: kube.EnhancedObjectReference{ClusterName: "test", Labels: map[string]string{"app": "nginx"}},
+	}
+}
+
+func startSubscribeServer(t *testing.T) (*httptest.Server, *exporter.Broker) {
+	broker := exporter.NewBroker()
+	srv := httptest.NewServer(h2c.NewHandler(registrySubscription(http.NewServeMux(), broker), &http2.Server{}))
+	t.Cleanup(srv.Close)
+	return srv, broker
+}
+
+// publish publishes the events once the subscriber is registered.
+func publish(t *testing.T, broker *exporter.Broker, events ...*kube.EnhancedEvent) {
+	require.Eventually(t, func() bool { return broker.Len() == 1 }, time.Second*5, time.Millisecond*10)
+	for _, ev := range events {
+		broker.Publish(ev)
+	}
+}
+
+func TestSubscribeSSE(t *testing.T) {
+	srv, broker := startSubscribeServer(t)
+
+	resp, err := http.Get(srv.URL + subscribePath + "?namespace=^kube-system$&labels=app=nginx")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	publish(t, broker, newSubscribeTestEvent("default", "BackOff"), newSubscribeTestEvent("kube-system", "OOMKilling"))
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	require.NoError(t, err)
+	ev := &kube.EnhancedEvent{}
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), ev))
+	require.Equal(t, "OOMKilling", ev.Reason)
+
+	resp, err = http.Get(srv.URL + subscribePath + "?reason=(")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestSubscribeWebSocket(t *testing.T) {
+	srv, broker := startSubscribeServer(t)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+subscribePath+"?reason=OOM", nil)
+	require.NoError(t, err)
+	publish(t, broker, newSubscribeTestEvent("default", "BackOff"), newSubscribeTestEvent("default", "OOMKilling"))
+
+	ev := &kube.EnhancedEvent{}
+	require.NoError(t, conn.ReadJSON(ev))
+	require.Equal(t, "OOMKilling", ev.Reason)
+
+	// the subscription is closed with the connection.
+	conn.Close()
+	require.Eventually(t, func() bool { return broker.Len() == 0 }, time.Second*5, time.Millisecond*10)
+}
+
+func TestSubscribeGRPC(t *testing.T) {
+	srv, broker := startSubscribeServer(t)
+
+	conn, err := grpc.Dial(strings.TrimPrefix(srv.URL, "http://"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	stream, err := eventexporterv1.NewEventSubscriberClient(conn).Subscribe(ctx, &eventexporterv1.SubscribeRequest{
+		Rule: &eventexporterv1.Rule{Type: "Warning", Kind: "Pod", Reason: "BackOff"},
+	})
+	require.NoError(t, err)
+	publish(t, broker, newSubscribeTestEvent("default", "OOMKilling"), newSubscribeTestEvent("default", "BackOff"))
+
+	ev, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "BackOff", ev.Reason)
+	require.Equal(t, "test", ev.ClusterName)
+	require.Equal(t, map[string]string{"app": "nginx"}, ev.InvolvedObject.Labels)
+}
+
+func TestSubscribeTokenAndLimit(t *testing.T) {
+	token, max := SubscriptionToken, SubscriptionMaxSubscribers
+	SubscriptionToken, SubscriptionMaxSubscribers = "secret", 1
+	defer func() { SubscriptionToken, SubscriptionMaxSubscribers = token, max }()
+	srv, broker := startSubscribeServer(t)
+
+	get := func(authorization string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+subscribePath, nil)
+		require.NoError(t, err)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+	for _, authorization := range []string{"", "secret", "Bearer invalid"} {
+		resp := get(authorization)
+		resp.Body.Close()
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode, authorization)
+	}
+
+	resp := get("Bearer secret")
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Eventually(t, func() bool { return broker.Len() == 1 }, time.Second*5, time.Millisecond*10)
+
+	// the subscribers of all the protocols are limited.
+	resp = get("Bearer secret")
+	resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	conn, err := grpc.Dial(strings.TrimPrefix(srv.URL, "http://"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	for code, authorization := range map[codes.Code]string{codes.Unauthenticated: "Bearer invalid", codes.ResourceExhausted: "Bearer secret"} {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", authorization)
+		stream, err := eventexporterv1.NewEventSubscriberClient(conn).Subscribe(ctx, &eventexporterv1.SubscribeRequest{})
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		require.Equal(t, code, status.Code(err))
+	}
+}
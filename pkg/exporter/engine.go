@@ -1,17 +1,21 @@
 package exporter
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 
 	"github.com/champly/eventexporter/pkg/kube"
 	"github.com/champly/eventexporter/pkg/sinks"
 	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
 )
 
 var (
 	ConfigPath = "/etc/eventexporter/exporter.yaml"
+	// PluginDir is the directory of sink plugins, see sinks.LoadPlugins.
+	PluginDir = "/etc/eventexporter/plugins"
 )
 
 type Config struct {
@@ -21,6 +25,8 @@ type Config struct {
 
 type Engine struct {
 	Route Route
+	// Broker publishes the events to the subscribers of http server.
+	Broker *Broker
 }
 
 func NewEngine() (*Engine, error) {
@@ -33,6 +39,9 @@ func NewEngine() (*Engine, error) {
 	if err != nil {
 		return nil, fmt.Errorf("YAML unmarshal %s failed: %+v", string(b), err)
 	}
+	if err = sinks.LoadPlugins(PluginDir); err != nil {
+		return nil, err
+	}
 	for _, rcfg := range cfg.ReceiverConfig {
 		err = sinks.InitReceiver(rcfg)
 		if err != nil {
@@ -40,12 +49,19 @@ func NewEngine() (*Engine, error) {
 		}
 	}
 
-	return &Engine{Route: cfg.Route}, nil
+	return &Engine{Route: cfg.Route, Broker: NewBroker()}, nil
 }
 
 // OnEvent does not care whether event is add or update. Prior filtering should be done int the controller/watcher
-func (e *Engine) OnEvent(ev *kube.EnhancedEvent) {
-	e.Route.ProcessEvent(ev)
+func (e *Engine) OnEvent(ctx context.Context, ev *kube.EnhancedEvent) {
+	e.Route.ProcessEvent(ctx, ev)
+	e.Broker.Publish(ev)
+}
+
+// OnObjectDeleted notifies sinks that an involved object is gone, so that state kept for it
+// (e.g. firing alerts) can be resolved.
+func (e *Engine) OnObjectDeleted(clusterName string, reference *corev1.ObjectReference) {
+	sinks.ObjectDeleted(clusterName, reference)
 }
 
 func (e *Engine) Stop() {
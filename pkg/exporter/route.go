@@ -1,6 +1,8 @@
 package exporter
 
 import (
+	"context"
+
 	"github.com/champly/eventexporter/pkg/kube"
 	"github.com/champly/eventexporter/pkg/sinks"
 	"k8s.io/klog/v2"
@@ -15,7 +17,7 @@ type Route struct {
 	Routes []Route
 }
 
-func (r *Route) ProcessEvent(ev *kube.EnhancedEvent) {
+func (r *Route) ProcessEvent(ctx context.Context, ev *kube.EnhancedEvent) {
 	// First determine whether we will drop the event: If any of the drop is matched, we break the loop
 	for _, v := range r.Drop {
 		if v.MatchesEvent(ev) {
@@ -30,7 +32,7 @@ func (r *Route) ProcessEvent(ev *kube.EnhancedEvent) {
 		if rule.MatchesEvent(ev) {
 			if rule.Receiver != "" {
 				klog.V(4).Infof("Send event %s/%s to %s receiver.", ev.Namespace, ev.Name, rule.Receiver)
-				sinks.SendEvent(rule.Receiver, ev)
+				sinks.SendEvent(ctx, rule.Receiver, ev)
 				// Send the event down the hole
 			}
 		} else {
@@ -42,7 +44,7 @@ func (r *Route) ProcessEvent(ev *kube.EnhancedEvent) {
 	if matchedAll {
 		for _, subRoute := range r.Routes {
 			klog.V(4).Infof("Send event %s/%s down to the rabbit hole.", ev.Namespace, ev.Name)
-			subRoute.ProcessEvent(ev)
+			subRoute.ProcessEvent(ctx, ev)
 		}
 	}
 }
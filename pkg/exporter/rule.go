@@ -1,6 +1,7 @@
 package exporter
 
 import (
+	"fmt"
 	"regexp"
 
 	"github.com/champly/eventexporter/pkg/kube"
@@ -83,6 +84,32 @@ func (r *Rule) MatchesEvent(ev *kube.EnhancedEvent) bool {
 	return true
 }
 
+// Validate checks whether all the patterns of rule compile.
+func (r *Rule) Validate() error {
+	patterns := map[string]string{
+		"message":    r.Message,
+		"apiVersion": r.APIVersion,
+		"kind":       r.Kind,
+		"namespace":  r.Namespace,
+		"reason":     r.Reason,
+		"type":       r.Type,
+		"component":  r.Component,
+		"host":       r.Host,
+	}
+	for k, v := range r.Labels {
+		patterns["labels."+k] = v
+	}
+	for k, v := range r.Annotations {
+		patterns["annotations."+k] = v
+	}
+	for field, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid %s pattern %q: %v", field, pattern, err)
+		}
+	}
+	return nil
+}
+
 // matchString is a method to clean the code. Error handling is omitted here because these
 // rules are validated before use. According to regexp.MatchString, the only way it fails its
 // that the pattern does not compile.
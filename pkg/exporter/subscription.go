@@ -0,0 +1,96 @@
+package exporter
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/champly/eventexporter/pkg/kube"
+)
+
+// ErrTooManySubscriptions is returned when the subscriptions reach the max.
+var ErrTooManySubscriptions = errors.New("too many subscriptions")
+
+// Broker fans out the events to the subscribers whose rule matches, the events are
+// dropped for the subscribers which are too slow to receive them.
+type Broker struct {
+	sync.RWMutex
+	subscribers map[*Subscription]struct{}
+}
+
+// Subscription receives the matched events until it's closed.
+type Subscription struct {
+	rule    Rule
+	events  chan *kube.EnhancedEvent
+	dropped uint64
+	broker  *Broker
+	once    sync.Once
+}
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: map[*Subscription]struct{}{}}
+}
+
+// Subscribe registers a subscription with the rule, buffer is the max events waiting
+// to be received. It fails with ErrTooManySubscriptions when there are max subscriptions
+// already, zero max is unlimited.
+func (b *Broker) Subscribe(rule Rule, buffer, max int) (*Subscription, error) {
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+	s := &Subscription{
+		rule:   rule,
+		events: make(chan *kube.EnhancedEvent, buffer),
+		broker: b,
+	}
+	b.Lock()
+	defer b.Unlock()
+	if max > 0 && len(b.subscribers) >= max {
+		return nil, ErrTooManySubscriptions
+	}
+	b.subscribers[s] = struct{}{}
+	return s, nil
+}
+
+// Publish sends the event to the matched subscriptions without blocking.
+func (b *Broker) Publish(ev *kube.EnhancedEvent) {
+	b.RLock()
+	defer b.RUnlock()
+	for s := range b.subscribers {
+		if !s.rule.MatchesEvent(ev) {
+			continue
+		}
+		select {
+		case s.events <- ev:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+// Len returns the number of subscriptions.
+func (b *Broker) Len() int {
+	b.RLock()
+	defer b.RUnlock()
+	return len(b.subscribers)
+}
+
+// Events returns the channel of matched events, it's closed when the subscription is closed.
+func (s *Subscription) Events() <-chan *kube.EnhancedEvent {
+	return s.events
+}
+
+// Dropped returns the number of events dropped because the buffer is full.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close unregisters the subscription.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.broker.Lock()
+		delete(s.broker.subscribers, s)
+		s.broker.Unlock()
+		close(s.events)
+	})
+}
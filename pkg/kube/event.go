@@ -28,3 +28,17 @@ func (e *EnhancedEvent) ToJSON() []byte {
 func (e *EnhancedEvent) GetTimestampMs() int64 {
 	return e.FirstTimestamp.UnixNano() / (int64(time.Millisecond) / int64(time.Nanosecond))
 }
+
+// GetLastTimestamp returns the last time the event was observed, events reported with
+// events.k8s.io api only set the series or event time.
+func (e *EnhancedEvent) GetLastTimestamp() time.Time {
+	switch {
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case e.Series != nil && !e.Series.LastObservedTime.IsZero():
+		return e.Series.LastObservedTime.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	}
+	return e.FirstTimestamp.Time
+}
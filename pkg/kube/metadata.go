@@ -16,22 +16,29 @@ import (
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 )
 
+// ObjectDeleteHandler is invoked when an involved object watched by the
+// MetadataHandler has been deleted from the cluster.
+type ObjectDeleteHandler func(clusterName string, reference *corev1.ObjectReference)
+
 type MetadataHandler struct {
 	ctx               context.Context
 	cli               api.MingleClient
+	onDelete          ObjectDeleteHandler
 	informers         dynamicinformer.DynamicSharedInformerFactory
 	rm                meta.RESTMapper
 	sharedInformerMap map[schema.GroupVersionResource]informers.GenericInformer
 	sync.RWMutex
 }
 
-func NewMetadataHandler(ctx context.Context, cli api.MingleClient) *MetadataHandler {
+func NewMetadataHandler(ctx context.Context, cli api.MingleClient, onDelete ObjectDeleteHandler) *MetadataHandler {
 	a := &MetadataHandler{
 		ctx:               ctx,
 		cli:               cli,
+		onDelete:          onDelete,
 		sharedInformerMap: map[schema.GroupVersionResource]informers.GenericInformer{},
 	}
 
@@ -135,6 +142,17 @@ func (m *MetadataHandler) getGenericInfomer(reference *corev1.ObjectReference) (
 
 	klog.Infof("Build cluster [%s] new dynamic informer for -> %s", m.cli.GetClusterCfgInfo().GetName(), mapping.Resource.String())
 	informer = m.informers.ForResource(mapping.Resource)
+	if m.onDelete != nil {
+		gvk := mapping.GroupVersionKind
+		_, err = informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			DeleteFunc: func(obj interface{}) {
+				m.handleDelete(gvk, obj)
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	go informer.Informer().Run(m.ctx.Done())
 
@@ -145,3 +163,23 @@ func (m *MetadataHandler) getGenericInfomer(reference *corev1.ObjectReference) (
 	m.sharedInformerMap[mapping.Resource] = informer
 	return informer, nil
 }
+
+func (m *MetadataHandler) handleDelete(gvk schema.GroupVersionKind, obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		klog.Errorf("Cluster [%s] deleted %s is not a kubernetes object: %+v", m.cli.GetClusterCfgInfo().GetName(), gvk.String(), err)
+		return
+	}
+
+	apiVersion, kind := gvk.ToAPIVersionAndKind()
+	m.onDelete(m.cli.GetClusterCfgInfo().GetName(), &corev1.ObjectReference{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Namespace:  accessor.GetNamespace(),
+		Name:       accessor.GetName(),
+		UID:        accessor.GetUID(),
+	})
+}
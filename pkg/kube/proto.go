@@ -0,0 +1,73 @@
+package kube
+
+import (
+	"time"
+
+	eventexporterv1 "github.com/champly/eventexporter/api/eventexporter/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ToProto converts the event to the published protobuf message.
+func (e *EnhancedEvent) ToProto() *eventexporterv1.Event {
+	pe := &eventexporterv1.Event{
+		ClusterName: e.InvolvedObject.ClusterName,
+		Metadata: &eventexporterv1.ObjectMeta{
+			Name:              e.Name,
+			Namespace:         e.Namespace,
+			Uid:               string(e.UID),
+			ResourceVersion:   e.ResourceVersion,
+			CreationTimestamp: protoTime(e.CreationTimestamp.Time),
+			Labels:            e.Labels,
+			Annotations:       e.Annotations,
+		},
+		InvolvedObject: ObjectReferenceToProto(&e.Event.InvolvedObject),
+		Reason:         e.Reason,
+		Message:        e.Message,
+		Source: &eventexporterv1.EventSource{
+			Component: e.Source.Component,
+			Host:      e.Source.Host,
+		},
+		FirstTimestamp:      protoTime(e.FirstTimestamp.Time),
+		LastTimestamp:       protoTime(e.LastTimestamp.Time),
+		Count:               e.Count,
+		Type:                e.Type,
+		EventTime:           protoTime(e.EventTime.Time),
+		Action:              e.Action,
+		ReportingController: e.ReportingController,
+		ReportingInstance:   e.ReportingInstance,
+	}
+	pe.InvolvedObject.Labels = e.InvolvedObject.Labels
+	pe.InvolvedObject.Annotations = e.InvolvedObject.Annotations
+	if e.Series != nil {
+		pe.Series = &eventexporterv1.EventSeries{
+			Count:            e.Series.Count,
+			LastObservedTime: protoTime(e.Series.LastObservedTime.Time),
+		}
+	}
+	if e.Related != nil {
+		pe.Related = ObjectReferenceToProto(e.Related)
+	}
+	return pe
+}
+
+// ObjectReferenceToProto converts the object reference without labels and annotations.
+func ObjectReferenceToProto(ref *corev1.ObjectReference) *eventexporterv1.ObjectReference {
+	return &eventexporterv1.ObjectReference{
+		Kind:            ref.Kind,
+		Namespace:       ref.Namespace,
+		Name:            ref.Name,
+		Uid:             string(ref.UID),
+		ApiVersion:      ref.APIVersion,
+		ResourceVersion: ref.ResourceVersion,
+		FieldPath:       ref.FieldPath,
+	}
+}
+
+// protoTime returns nil for the zero time, so unset timestamps are omitted.
+func protoTime(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
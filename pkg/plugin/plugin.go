@@ -0,0 +1,115 @@
+// Package plugin serves the out of process sinks of eventexporter. A plugin is an
+// executable named eventexporter-sink-<name> in the plugin directory, it's configured
+// as the receiver <name> and its main calls Serve.
+package plugin
+
+import (
+	"context"
+	"errors"
+
+	eventexporterv1 "github.com/champly/eventexporter/api/eventexporter/v1"
+	goplugin "github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PluginName is the name of sink in the plugin set.
+const PluginName = "sink"
+
+// Handshake is shared by eventexporter and plugins, the protocol version is increased
+// when the SinkPlugin service breaks compatibility.
+var Handshake = goplugin.HandshakeConfig{
+	ProtocolVersion:  1,
+	MagicCookieKey:   "EVENTEXPORTER_PLUGIN",
+	MagicCookieValue: "sink",
+}
+
+// Sink is implemented by plugins.
+type Sink interface {
+	// Configure is called once with the JSON of receiver config.
+	Configure(config []byte) error
+	Send(ctx context.Context, ev *eventexporterv1.Event) error
+	Close() error
+}
+
+// ObjectDeleteNotifier is optionally implemented by the sinks which keep state for
+// the involved objects.
+type ObjectDeleteNotifier interface {
+	OnObjectDeleted(ctx context.Context, clusterName string, reference *eventexporterv1.ObjectReference) error
+}
+
+// Serve serves the sink until eventexporter kills the plugin.
+func Serve(sink Sink) {
+	goplugin.Serve(&goplugin.ServeConfig{
+		HandshakeConfig: Handshake,
+		Plugins:         goplugin.PluginSet{PluginName: &SinkPlugin{Impl: sink}},
+		GRPCServer:      goplugin.DefaultGRPCServer,
+	})
+}
+
+// Retryable marks err as temporary, eventexporter sends the event again.
+func Retryable(err error) error {
+	return status.Error(codes.Unavailable, err.Error())
+}
+
+// SinkPlugin is the go-plugin plugin of sink, the client is a SinkPluginClient.
+type SinkPlugin struct {
+	goplugin.NetRPCUnsupportedPlugin
+	Impl Sink
+}
+
+func (p *SinkPlugin) GRPCServer(broker *goplugin.GRPCBroker, s *grpc.Server) error {
+	eventexporterv1.RegisterSinkPluginServer(s, &sinkServer{impl: p.Impl})
+	return nil
+}
+
+func (p *SinkPlugin) GRPCClient(ctx context.Context, broker *goplugin.GRPCBroker, conn *grpc.ClientConn) (interface{}, error) {
+	return eventexporterv1.NewSinkPluginClient(conn), nil
+}
+
+type sinkServer struct {
+	eventexporterv1.UnimplementedSinkPluginServer
+	impl Sink
+}
+
+func (s *sinkServer) Configure(ctx context.Context, req *eventexporterv1.ConfigureRequest) (*eventexporterv1.ConfigureResponse, error) {
+	if err := s.impl.Configure(req.Config); err != nil {
+		return nil, toStatus(err, codes.InvalidArgument)
+	}
+	return &eventexporterv1.ConfigureResponse{}, nil
+}
+
+func (s *sinkServer) Send(ctx context.Context, req *eventexporterv1.SendRequest) (*eventexporterv1.SendResponse, error) {
+	if err := s.impl.Send(ctx, req.Event); err != nil {
+		return nil, toStatus(err, codes.Unknown)
+	}
+	return &eventexporterv1.SendResponse{}, nil
+}
+
+func (s *sinkServer) ObjectDeleted(ctx context.Context, req *eventexporterv1.ObjectDeletedRequest) (*eventexporterv1.ObjectDeletedResponse, error) {
+	notifier, ok := s.impl.(ObjectDeleteNotifier)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "object deleted is not implemented")
+	}
+	if err := notifier.OnObjectDeleted(ctx, req.ClusterName, req.Object); err != nil {
+		return nil, toStatus(err, codes.Unknown)
+	}
+	return &eventexporterv1.ObjectDeletedResponse{}, nil
+}
+
+func (s *sinkServer) Close(ctx context.Context, req *eventexporterv1.CloseRequest) (*eventexporterv1.CloseResponse, error) {
+	if err := s.impl.Close(); err != nil {
+		return nil, toStatus(err, codes.Unknown)
+	}
+	return &eventexporterv1.CloseResponse{}, nil
+}
+
+// toStatus keeps the status of err, the other errors are converted with code.
+func toStatus(err error, code codes.Code) error {
+	var se interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &se) {
+		return se.GRPCStatus().Err()
+	}
+	return status.Error(code, err.Error())
+}
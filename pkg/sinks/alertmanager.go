@@ -4,24 +4,42 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
+	"path"
+	"reflect"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/champly/eventexporter/pkg/kube"
+	"github.com/go-openapi/runtime"
+	clientruntime "github.com/go-openapi/runtime/client"
 	"github.com/go-openapi/strfmt"
 	"github.com/prometheus/alertmanager/api/v2/client"
 	"github.com/prometheus/alertmanager/api/v2/client/alert"
 	"github.com/prometheus/alertmanager/api/v2/models"
-	"github.com/prometheus/alertmanager/cli"
-	"gopkg.in/yaml.v3"
 	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/klog/v2"
 )
 
-const AlertmanagerSinkName = "alertmanager"
+const (
+	AlertmanagerSinkName = "alertmanager"
+
+	defaultAlertLifetime       = time.Minute * 5
+	defaultAlertmanagerAPIv2   = "/api/v2"
+	defaultAlertmanagerBatch   = 64
+	defaultAlertmanagerTimeout = time.Second * 10
+	defaultAlertmanagerRetry   = 2
+	alertmanagerQueueCapacity  = 10
+	severityLabel              = "severity"
+)
 
 var (
+	// defaultLayoutLabelMap identifies the alert, it must not change when the event repeats,
+	// so count and message are annotations.
 	defaultLayoutLabelMap = map[string]string{
 		"alertname": "eventexporter",
 		"type":      "{{ .Event.Type }}",
@@ -30,14 +48,19 @@ var (
 		"reason":    "{{ .Event.Reason }}",
 		"name":      "{{ .Event.Name }}",
 		"namespace": "{{ .Event.Namespace }}",
-		"count":     "{{ .Event.Count }}",
-		"message":   "{{ .Event.Message }}",
 		"component": "{{ .Event.Source.Component }}",
 		"host":      "{{ .Event.Source.Host }}",
 	}
 
 	defaultLayoutAnnotationMap = map[string]string{
 		"message": "{{ .Event.Message }}",
+		"count":   "{{ .Event.Count }}",
+	}
+
+	// defaultSeverityRules is used when severityRules is not configured.
+	defaultSeverityRules = []severityRule{
+		{Type: corev1.EventTypeWarning, Severity: "warning"},
+		{Severity: "info"},
 	}
 )
 
@@ -46,50 +69,439 @@ func init() {
 }
 
 type alertmanagerConfig struct {
-	Host             string            `yaml:"host"`
-	LabelLayout      map[string]string `yaml:"laybelLayout"`
-	AnnotationLayout map[string]string `yaml:"annotationLayout"`
+	// Host is kept for compatibility, it's merged into Hosts.
+	Host string `yaml:"host"`
+	// Hosts are the replicas of alertmanager HA cluster, alerts are sent to all of them.
+	// Use scheme://host:port for https, default is http.
+	Hosts []string `yaml:"hosts"`
+	// Discovery finds alertmanager in the manager plane cluster when no host is configured.
+	Discovery alertmanagerDiscovery `yaml:"discovery"`
+	// PathPrefix is the route prefix when alertmanager is served behind a proxy.
+	PathPrefix       string            `yaml:"pathPrefix"`
+	HTTPClientConfig httpClientConfig  `yaml:",inline"`
+	LabelLayout      map[string]string `yaml:"labelLayout"`
+	// LegacyLabelLayout is the misspelled key of LabelLayout, deprecated.
+	LegacyLabelLayout map[string]string `yaml:"laybelLayout"`
+	AnnotationLayout  map[string]string `yaml:"annotationLayout"`
+	// AlertLifetime is how long an alert stays active after the last time the event was seen,
+	// every repeat of the event extends it again.
+	AlertLifetime time.Duration `yaml:"alertLifetime"`
+	// ResolveRules resolve active alerts of an involved object when a recovery event shows up,
+	// e.g. BackOff followed by Started.
+	ResolveRules []resolveRule `yaml:"resolveRules"`
+	// GeneratorURL is the template of the link back to the event source, e.g. a dashboard.
+	GeneratorURL string `yaml:"generatorURL"`
+	// SeverityRules map event type and reason to severity label, the first matched rule wins.
+	// It's ignored when severity is set with label layout.
+	SeverityRules []severityRule `yaml:"severityRules"`
+	// BatchInterval enables batching, alerts are posted every interval or when
+	// BatchSize alerts are queued.
+	BatchInterval time.Duration `yaml:"batchInterval"`
+	BatchSize     int           `yaml:"batchSize"`
+	// Timeout limits every single post request.
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxRetries is the retry times of server and network errors for every endpoint.
+	MaxRetries *int `yaml:"maxRetries"`
+}
+
+type resolveRule struct {
+	Reason         string `yaml:"reason"`
+	RecoveryReason string `yaml:"recoveryReason"`
+
+	reasonRegexp         *regexp.Regexp
+	recoveryReasonRegexp *regexp.Regexp
+}
+
+type severityRule struct {
+	Type     string `yaml:"type"`
+	Reason   string `yaml:"reason"`
+	Severity string `yaml:"severity"`
+
+	typeRegexp   *regexp.Regexp
+	reasonRegexp *regexp.Regexp
+}
+
+func (r *severityRule) matches(ev *kube.EnhancedEvent) bool {
+	if r.typeRegexp != nil && !r.typeRegexp.MatchString(ev.Type) {
+		return false
+	}
+	if r.reasonRegexp != nil && !r.reasonRegexp.MatchString(ev.Reason) {
+		return false
+	}
+	return true
 }
 
 type alertmanager struct {
 	*alertmanagerConfig
+	httpClient *http.Client
+	maxRetries int
+	// discovered is true when hosts come from discovery and should be refreshed.
+	discovered bool
+
+	endpointsLock sync.RWMutex
+	hosts         []string
+	endpoints     []*alertmanagerEndpoint
+	// batcher queues alerts when batching is enabled, it's nil otherwise.
+	batcher *batcher[*models.PostableAlert]
+
+	// activeAlerts records the last alert posted for every event, so that it
+	// can be extended or resolved later.
+	activeAlerts map[string]*activeAlert
+	stopCh       chan struct{}
+	sync.Mutex
+}
+
+type alertmanagerEndpoint struct {
+	url      string
 	amclient *client.AlertmanagerAPI
 }
 
+type activeAlert struct {
+	clusterName string
+	reference   corev1.ObjectReference
+	reason      string
+	count       int32
+	alert       *models.PostableAlert
+}
+
 func NewAlertmanagerSink(cfg interface{}) (Sink, error) {
 	alertCfg, err := parse(cfg)
 	if err != nil {
 		return nil, err
 	}
-	amclient := cli.NewAlertmanagerClient(&url.URL{Host: alertCfg.Host})
+	httpClient, err := alertCfg.HTTPClientConfig.newHTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s http client failed: %v", AlertmanagerSinkName, err)
+	}
 
-	return &alertmanager{
+	am := &alertmanager{
 		alertmanagerConfig: alertCfg,
-		amclient:           amclient,
+		httpClient:         httpClient,
+		maxRetries:         defaultAlertmanagerRetry,
+		activeAlerts:       map[string]*activeAlert{},
+		stopCh:             make(chan struct{}),
+	}
+	if alertCfg.MaxRetries != nil {
+		am.maxRetries = *alertCfg.MaxRetries
+	}
+
+	hosts := alertCfg.Hosts
+	if len(hosts) == 0 {
+		hosts, err = alertCfg.Discovery.discover(context.TODO(), kube.ManagerPlaneClusterClient.GetKubeInterface())
+		if err != nil {
+			return nil, err
+		}
+		klog.Infof("Not config endpoint, use manager plane cluster %s as endpoint", strings.Join(hosts, ","))
+		am.discovered = true
+	}
+	if err = am.setEndpoints(hosts); err != nil {
+		return nil, err
+	}
+
+	go am.gcExpiredAlerts()
+	if am.discovered {
+		go am.refreshEndpoints()
+	}
+	if alertCfg.BatchInterval > 0 {
+		am.batcher = newBatcher(alertCfg.BatchSize, alertCfg.BatchInterval, alertCfg.BatchSize*alertmanagerQueueCapacity, am.flushBatch)
+	}
+	return am, nil
+}
+
+func (am *alertmanager) setEndpoints(hosts []string) error {
+	endpoints := make([]*alertmanagerEndpoint, 0, len(hosts))
+	for _, host := range hosts {
+		ep, err := newAlertmanagerEndpoint(host, am.PathPrefix, am.httpClient)
+		if err != nil {
+			return err
+		}
+		endpoints = append(endpoints, ep)
+	}
+
+	am.endpointsLock.Lock()
+	am.hosts = hosts
+	am.endpoints = endpoints
+	am.endpointsLock.Unlock()
+	klog.Infof("Alertmanager urls: %s", strings.Join(hosts, ","))
+	return nil
+}
+
+func (am *alertmanager) getEndpoints() []*alertmanagerEndpoint {
+	am.endpointsLock.RLock()
+	defer am.endpointsLock.RUnlock()
+	return am.endpoints
+}
+
+// refreshEndpoints resolves discovered alertmanager again, the old endpoints
+// are kept when discovery failed.
+func (am *alertmanager) refreshEndpoints() {
+	ticker := time.NewTicker(am.Discovery.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-am.stopCh:
+			return
+		case <-ticker.C:
+			hosts, err := am.Discovery.discover(context.TODO(), kube.ManagerPlaneClusterClient.GetKubeInterface())
+			if err != nil {
+				klog.Errorf("Refresh alertmanager endpoints failed, keep the old ones: %+v", err)
+				continue
+			}
+			am.endpointsLock.RLock()
+			changed := !reflect.DeepEqual(hosts, am.hosts)
+			am.endpointsLock.RUnlock()
+			if !changed {
+				continue
+			}
+			if err = am.setEndpoints(hosts); err != nil {
+				klog.Errorf("Update alertmanager endpoints failed: %+v", err)
+			}
+		}
+	}
+}
+
+func newAlertmanagerEndpoint(host, pathPrefix string, httpClient *http.Client) (*alertmanagerEndpoint, error) {
+	u := &url.URL{Scheme: "http", Host: host}
+	if strings.Contains(host, "://") {
+		var err error
+		u, err = url.Parse(host)
+		if err != nil {
+			return nil, fmt.Errorf("init receiver %s, parse host %s failed: %v", AlertmanagerSinkName, host, err)
+		}
+	}
+	u.Path = path.Join("/", u.Path, pathPrefix, defaultAlertmanagerAPIv2)
+
+	cr := clientruntime.NewWithClient(u.Host, u.Path, []string{u.Scheme}, httpClient)
+	return &alertmanagerEndpoint{
+		url:      u.String(),
+		amclient: client.New(cr, strfmt.Default),
 	}, nil
 }
 
 func (am *alertmanager) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	if rules := am.matchRecoveryRules(ev); len(rules) > 0 {
+		return am.resolveRecovered(ctx, ev, rules)
+	}
+
+	key := alertKey(ev)
+	am.Lock()
+	prev, ok := am.activeAlerts[key]
+	if ok && time.Now().After(time.Time(prev.alert.EndsAt)) {
+		// already expired in alertmanager, treat as a new alert.
+		delete(am.activeAlerts, key)
+		ok = false
+	}
+	am.Unlock()
+	if ok && ev.Count <= prev.count {
+		klog.V(4).Infof("Event %s -> %s/%s count not increased, skip re-post alert.", ev.InvolvedObject.ClusterName, ev.Namespace, ev.Name)
+		return nil
+	}
+
 	pa, err := am.buildPostableAlertData(ev)
 	if err != nil {
 		return err
 	}
-	alertParams := alert.NewPostAlertsParams().WithContext(context.TODO()).
-		WithAlerts(models.PostableAlerts{pa})
-	r, err := am.amclient.Alert.PostAlerts(alertParams)
-	if err != nil {
+	alerts := models.PostableAlerts{pa}
+	if ok && !reflect.DeepEqual(prev.alert.Labels, pa.Labels) {
+		// labels changed (e.g. count is added to the label layout), the previous alert is a
+		// different alert in alertmanager, resolve it instead of letting it linger.
+		alerts = append(alerts, resolvedAlert(prev.alert))
+	}
+	if err = am.dispatch(ctx, alerts); err != nil {
 		return err
 	}
-	if !strings.Contains(r.Error(), "postAlertsOK") {
-		return errors.New(r.Error())
+
+	am.Lock()
+	am.activeAlerts[key] = &activeAlert{
+		clusterName: ev.InvolvedObject.ClusterName,
+		reference:   ev.Event.InvolvedObject,
+		reason:      ev.Reason,
+		count:       ev.Count,
+		alert:       pa,
 	}
+	am.Unlock()
 
 	klog.Infof("Send %s -> %s/%s event success.", ev.InvolvedObject.ClusterName, ev.Namespace, ev.Name)
 	return nil
 }
 
+// OnObjectDeleted resolves all active alerts of the deleted involved object.
+func (am *alertmanager) OnObjectDeleted(ctx context.Context, clusterName string, reference *corev1.ObjectReference) error {
+	alerts := am.popActiveAlerts(func(a *activeAlert) bool {
+		return a.clusterName == clusterName && sameObject(&a.reference, reference)
+	})
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	klog.Infof("Resolve %d alerts of deleted object %s -> %s %s/%s.", len(alerts), clusterName, reference.Kind, reference.Namespace, reference.Name)
+	return am.dispatch(ctx, alerts)
+}
+
+// Close stops background goroutines and flushes queued alerts.
 func (alert *alertmanager) Close() {
-	// TODO: close connected.
+	close(alert.stopCh)
+	if alert.batcher != nil {
+		alert.batcher.stop()
+	}
+}
+
+// dispatch posts alerts directly, or queues them up when batching is enabled.
+func (am *alertmanager) dispatch(ctx context.Context, alerts models.PostableAlerts) error {
+	if am.batcher == nil {
+		return am.postAlerts(ctx, alerts)
+	}
+	return am.batcher.add(alerts...)
+}
+
+func (am *alertmanager) flushBatch(alerts []*models.PostableAlert) {
+	if err := am.postAlerts(context.Background(), alerts); err != nil {
+		klog.Errorf("Post batch of %d alerts failed: %+v", len(alerts), err)
+		return
+	}
+	klog.V(4).Infof("Post batch of %d alerts success.", len(alerts))
+}
+
+// postAlerts sends alerts to every alertmanager endpoint, alertmanager HA cluster
+// deduplicates them with gossip. It only fails when all the endpoints failed.
+func (am *alertmanager) postAlerts(ctx context.Context, alerts models.PostableAlerts) error {
+	endpoints := am.getEndpoints()
+	if len(endpoints) == 0 {
+		return newNetworkError(errors.New("no alertmanager endpoint available"))
+	}
+	errs := make([]error, len(endpoints))
+	wg := sync.WaitGroup{}
+	for i, ep := range endpoints {
+		wg.Add(1)
+		go func(i int, ep *alertmanagerEndpoint) {
+			defer wg.Done()
+			errs[i] = sendWithRetry(ctx, am.maxRetries, func(ctx context.Context) error {
+				ctx, cancel := context.WithTimeout(ctx, am.Timeout)
+				defer cancel()
+				return ep.postAlerts(ctx, alerts)
+			})
+		}(i, ep)
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			klog.Errorf("Post %d alerts to alertmanager %s failed: %+v", len(alerts), endpoints[i].url, err)
+		}
+	}
+	if failed < len(endpoints) {
+		return nil
+	}
+
+	// all endpoints failed, keep a retryable error in the chain if there is one.
+	cause := errs[0]
+	for _, err := range errs {
+		if IsRetryable(err) {
+			cause = err
+			break
+		}
+	}
+	if len(errs) == 1 {
+		return fmt.Errorf("post %d alerts to alertmanager failed: %w", len(alerts), cause)
+	}
+	return fmt.Errorf("post %d alerts to all alertmanagers failed: %w, all errors: %v", len(alerts), cause, utilerrors.NewAggregate(errs))
+}
+
+func (ep *alertmanagerEndpoint) postAlerts(ctx context.Context, alerts models.PostableAlerts) error {
+	alertParams := alert.NewPostAlertsParams().WithContext(ctx).
+		WithAlerts(alerts)
+	_, err := ep.amclient.Alert.PostAlerts(alertParams)
+	if err != nil {
+		return classifyAlertmanagerError(err)
+	}
+	return nil
+}
+
+// classifyAlertmanagerError converts the errors of the generated client to SendError.
+func classifyAlertmanagerError(err error) error {
+	var apiErr *runtime.APIError
+	switch e := err.(type) {
+	case *alert.PostAlertsBadRequest:
+		return newStatusError(http.StatusBadRequest, errors.New(e.Payload))
+	case *alert.PostAlertsInternalServerError:
+		return newStatusError(http.StatusInternalServerError, errors.New(e.Payload))
+	}
+	if errors.As(err, &apiErr) {
+		return newStatusError(apiErr.Code, err)
+	}
+	return newNetworkError(err)
+}
+
+func (am *alertmanager) matchRecoveryRules(ev *kube.EnhancedEvent) []resolveRule {
+	var rules []resolveRule
+	for _, rule := range am.ResolveRules {
+		if rule.recoveryReasonRegexp.MatchString(ev.Reason) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// resolveRecovered resolves the active alerts of the event's involved object whose
+// reason is recovered by the matched rules.
+func (am *alertmanager) resolveRecovered(ctx context.Context, ev *kube.EnhancedEvent, rules []resolveRule) error {
+	alerts := am.popActiveAlerts(func(a *activeAlert) bool {
+		if a.clusterName != ev.InvolvedObject.ClusterName || !sameObject(&a.reference, &ev.Event.InvolvedObject) {
+			return false
+		}
+		for _, rule := range rules {
+			if rule.reasonRegexp.MatchString(a.reason) {
+				return true
+			}
+		}
+		return false
+	})
+	if len(alerts) == 0 {
+		klog.V(4).Infof("Recovery event %s -> %s/%s has no active alert, skip.", ev.InvolvedObject.ClusterName, ev.Namespace, ev.Name)
+		return nil
+	}
+
+	klog.Infof("Resolve %d alerts with recovery event %s -> %s/%s.", len(alerts), ev.InvolvedObject.ClusterName, ev.Namespace, ev.Name)
+	return am.dispatch(ctx, alerts)
+}
+
+// popActiveAlerts removes the matched active alerts and returns them as resolved alerts.
+func (am *alertmanager) popActiveAlerts(match func(a *activeAlert) bool) models.PostableAlerts {
+	am.Lock()
+	defer am.Unlock()
+
+	var alerts models.PostableAlerts
+	for key, a := range am.activeAlerts {
+		if match(a) {
+			alerts = append(alerts, resolvedAlert(a.alert))
+			delete(am.activeAlerts, key)
+		}
+	}
+	return alerts
+}
+
+func (am *alertmanager) gcExpiredAlerts() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-am.stopCh:
+			return
+		case <-ticker.C:
+			now := time.Now()
+			am.Lock()
+			for key, a := range am.activeAlerts {
+				if now.After(time.Time(a.alert.EndsAt)) {
+					delete(am.activeAlerts, key)
+				}
+			}
+			am.Unlock()
+		}
+	}
 }
 
 func (am *alertmanager) buildPostableAlertData(ev *kube.EnhancedEvent) (*models.PostableAlert, error) {
@@ -103,66 +515,137 @@ func (am *alertmanager) buildPostableAlertData(ev *kube.EnhancedEvent) (*models.
 		return nil, err
 	}
 
+	if _, ok := labels[severityLabel]; !ok {
+		if severity := am.getSeverity(ev); severity != "" {
+			labels[severityLabel] = severity
+		}
+	}
+
+	var generatorURL string
+	if am.GeneratorURL != "" {
+		generatorURL, err = getLayoutString(ev, am.GeneratorURL)
+		if err != nil {
+			return nil, fmt.Errorf("render generatorURL failed: %v", err)
+		}
+	}
+
+	lastSeen := ev.GetLastTimestamp()
+	if lastSeen.IsZero() {
+		lastSeen = time.Now()
+	}
 	pa := &models.PostableAlert{
 		Alert: models.Alert{
-			// GeneratorURL: strfmt.URI("http://xxxx.com"),
-			Labels: labels,
+			GeneratorURL: strfmt.URI(generatorURL),
+			Labels:       labels,
 		},
 		Annotations: annotations,
 		StartsAt:    strfmt.DateTime(ev.Event.CreationTimestamp.Time),
-		EndsAt:      strfmt.DateTime(ev.Event.LastTimestamp.Add(time.Minute * 5)),
+		EndsAt:      strfmt.DateTime(lastSeen.Add(am.AlertLifetime)),
 	}
 
 	return pa, nil
 }
 
-func parse(cfg interface{}) (*alertmanagerConfig, error) {
-	b, err := yaml.Marshal(cfg)
-	if err != nil {
-		return nil, fmt.Errorf("init receiver, marshal interface{} to yaml %s config {%+v} failed: %v", AlertmanagerSinkName, cfg, err)
+func (am *alertmanager) getSeverity(ev *kube.EnhancedEvent) string {
+	for i := range am.SeverityRules {
+		if am.SeverityRules[i].matches(ev) {
+			return am.SeverityRules[i].Severity
+		}
 	}
+	return ""
+}
+
+// resolvedAlert returns a copy of the alert which ends now.
+func resolvedAlert(pa *models.PostableAlert) *models.PostableAlert {
+	resolved := *pa
+	resolved.EndsAt = strfmt.DateTime(time.Now())
+	return &resolved
+}
+
+// alertKey identifies an event across updates, the event name is unique per
+// involved object, reason and source.
+func alertKey(ev *kube.EnhancedEvent) string {
+	return ev.InvolvedObject.ClusterName + "/" + ev.Namespace + "/" + ev.Name
+}
+
+func sameObject(a, b *corev1.ObjectReference) bool {
+	if a.UID != "" && b.UID != "" {
+		return a.UID == b.UID
+	}
+	return a.Kind == b.Kind && a.Namespace == b.Namespace && a.Name == b.Name
+}
 
+func parse(cfg interface{}) (*alertmanagerConfig, error) {
 	alertCfg := &alertmanagerConfig{}
-	err = yaml.Unmarshal(b, alertCfg)
+	err := unmarshalConfig(AlertmanagerSinkName, cfg, alertCfg)
 	if err != nil {
-		return nil, fmt.Errorf("init receiver, unmarshal yaml to alertmanagerConfig %s failed config -> %s", AlertmanagerSinkName, cfg)
+		return nil, err
 	}
 
-	if alertCfg.Host == "" {
-		host, err := getAlertManagerHost()
-		if err != nil {
-			return nil, err
+	if err = alertCfg.HTTPClientConfig.validate(); err != nil {
+		return nil, fmt.Errorf("init receiver %s, invalid http config: %v", AlertmanagerSinkName, err)
+	}
+	if len(alertCfg.LegacyLabelLayout) > 0 {
+		klog.Warningf("Receiver %s config laybelLayout is deprecated, use labelLayout instead.", AlertmanagerSinkName)
+		layout := make(map[string]string, len(alertCfg.LegacyLabelLayout)+len(alertCfg.LabelLayout))
+		for k, v := range alertCfg.LegacyLabelLayout {
+			layout[k] = v
 		}
-		klog.Infof("Not config endpoint, use manager plane cluster \"%s\" as endpoint", host)
-		alertCfg.Host = host
+		for k, v := range alertCfg.LabelLayout {
+			layout[k] = v
+		}
+		alertCfg.LabelLayout = layout
 	}
-	klog.Infof("Alertmanager url: %s", alertCfg.Host)
-
-	return alertCfg, nil
-}
-
-func getAlertManagerHost() (host string, err error) {
-	svcList := &corev1.ServiceList{}
-	err = kube.ManagerPlaneClusterClient.List(
-		svcList,
-		// &rtclient.ListOptions{
-		// FieldSelector: fields.SelectorFromSet(fields.Set{
-		// "spec.selector.app": "alertmanager",
-		// }),
-		// },
-	)
-	if err != nil {
-		return "", fmt.Errorf("get manager plane cluster svc failed: %s", err.Error())
+	if alertCfg.Timeout <= 0 {
+		alertCfg.Timeout = defaultAlertmanagerTimeout
+	}
+	if alertCfg.BatchInterval > 0 && alertCfg.BatchSize <= 0 {
+		alertCfg.BatchSize = defaultAlertmanagerBatch
+	}
+	if alertCfg.AlertLifetime <= 0 {
+		alertCfg.AlertLifetime = defaultAlertLifetime
+	}
+	for i := range alertCfg.ResolveRules {
+		rule := &alertCfg.ResolveRules[i]
+		if rule.Reason == "" || rule.RecoveryReason == "" {
+			return nil, fmt.Errorf("init receiver %s, resolve rule %d must set both reason and recoveryReason", AlertmanagerSinkName, i)
+		}
+		if rule.reasonRegexp, err = regexp.Compile(rule.Reason); err != nil {
+			return nil, fmt.Errorf("init receiver %s, resolve rule %d reason %q is invalid: %v", AlertmanagerSinkName, i, rule.Reason, err)
+		}
+		if rule.recoveryReasonRegexp, err = regexp.Compile(rule.RecoveryReason); err != nil {
+			return nil, fmt.Errorf("init receiver %s, resolve rule %d recoveryReason %q is invalid: %v", AlertmanagerSinkName, i, rule.RecoveryReason, err)
+		}
 	}
 
-	for _, svc := range svcList.Items {
-		// https://github.com/helm/charts/blob/f4f301ae450101b981805bd045451f08c0d74afa/stable/prometheus-operator/templates/alertmanager/service.yaml?_pjax=%23js-repo-pjax-container%2C%20div%5Bitemtype%3D%22http%3A%2F%2Fschema.org%2FSoftwareSourceCode%22%5D%20main%2C%20%5Bdata-pjax-container%5D#L44
-		if len(svc.Spec.Selector) > 0 && svc.Spec.Selector["app"] == "alertmanager" {
-			return fmt.Sprintf("%s.%s.svc:9093", svc.Name, svc.Namespace), nil
+	if len(alertCfg.SeverityRules) == 0 {
+		alertCfg.SeverityRules = append([]severityRule(nil), defaultSeverityRules...)
+	}
+	for i := range alertCfg.SeverityRules {
+		rule := &alertCfg.SeverityRules[i]
+		if rule.Severity == "" {
+			return nil, fmt.Errorf("init receiver %s, severity rule %d must set severity", AlertmanagerSinkName, i)
+		}
+		if rule.Type != "" {
+			if rule.typeRegexp, err = regexp.Compile(rule.Type); err != nil {
+				return nil, fmt.Errorf("init receiver %s, severity rule %d type %q is invalid: %v", AlertmanagerSinkName, i, rule.Type, err)
+			}
+		}
+		if rule.Reason != "" {
+			if rule.reasonRegexp, err = regexp.Compile(rule.Reason); err != nil {
+				return nil, fmt.Errorf("init receiver %s, severity rule %d reason %q is invalid: %v", AlertmanagerSinkName, i, rule.Reason, err)
+			}
 		}
 	}
 
-	return "", errors.New("not found alertmanager in manager plane cluster with svc spec.selector.app == alertmanager")
+	if alertCfg.Host != "" {
+		alertCfg.Hosts = append([]string{alertCfg.Host}, alertCfg.Hosts...)
+	}
+	if alertCfg.Discovery.RefreshInterval <= 0 {
+		alertCfg.Discovery.RefreshInterval = defaultAlertmanagerRefreshInterval
+	}
+
+	return alertCfg, nil
 }
 
 func buildInputLabelsField(name, value string) string {
@@ -171,18 +654,7 @@ func buildInputLabelsField(name, value string) string {
 
 // parseLabels parses a list of labels (cli arguments).
 func parseLabels(ev *kube.EnhancedEvent, inputLabels ...map[string]string) (models.LabelSet, error) {
-	labelSet := make(models.LabelSet)
-
-	for _, inputLabel := range inputLabels {
-		for key, value := range inputLabel {
-			m, _ := getLayoutString(ev, value)
-			if len(m) > 0 {
-				labelSet[key] = m
-			}
-		}
-	}
-
-	return labelSet, nil
+	return models.LabelSet(getLayoutLabels(ev, inputLabels...)), nil
 }
 
 /*
@@ -0,0 +1,131 @@
+package sinks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultAlertmanagerPort            = 9093
+	defaultAlertmanagerRefreshInterval = time.Minute
+)
+
+// defaultAlertmanagerPortNames are the port names used by helm charts and prometheus-operator.
+var defaultAlertmanagerPortNames = []string{"web", "http"}
+
+// alertmanagerDiscovery finds alertmanager in the manager plane cluster when hosts
+// are not configured.
+type alertmanagerDiscovery struct {
+	// Namespace limits the services to look up, default is all namespaces.
+	Namespace string `yaml:"namespace"`
+	// LabelSelector selects alertmanager services by labels, e.g. prometheus-operator
+	// uses "operated-alertmanager=true". When it's empty the services with
+	// spec.selector.app == alertmanager are used.
+	LabelSelector string `yaml:"labelSelector"`
+	// PortName is the service port of alertmanager api, default is web or http,
+	// then 9093.
+	PortName string `yaml:"portName"`
+	// RefreshInterval is how often the endpoints are resolved again.
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+}
+
+// discover returns ready endpoint addresses of the alertmanager services, the
+// service address is used when there is no ready endpoint.
+func (d *alertmanagerDiscovery) discover(ctx context.Context, cli kubernetes.Interface) ([]string, error) {
+	svcList, err := cli.CoreV1().Services(d.Namespace).List(ctx, metav1.ListOptions{LabelSelector: d.LabelSelector})
+	if err != nil {
+		return nil, fmt.Errorf("get manager plane cluster svc failed: %s", err.Error())
+	}
+
+	svcs := make([]corev1.Service, 0, len(svcList.Items))
+	for _, svc := range svcList.Items {
+		// https://github.com/helm/charts/blob/f4f301ae450101b981805bd045451f08c0d74afa/stable/prometheus-operator/templates/alertmanager/service.yaml#L44
+		if d.LabelSelector == "" && svc.Spec.Selector["app"] != "alertmanager" {
+			continue
+		}
+		svcs = append(svcs, svc)
+	}
+	if len(svcs) == 0 {
+		if d.LabelSelector == "" {
+			return nil, errors.New("not found alertmanager in manager plane cluster with svc spec.selector.app == alertmanager")
+		}
+		return nil, fmt.Errorf("not found alertmanager in manager plane cluster with svc labels %s", d.LabelSelector)
+	}
+	sort.Slice(svcs, func(i, j int) bool {
+		if svcs[i].Namespace != svcs[j].Namespace {
+			return svcs[i].Namespace < svcs[j].Namespace
+		}
+		return svcs[i].Name < svcs[j].Name
+	})
+
+	hosts := []string{}
+	for _, svc := range svcs {
+		ep, err := cli.CoreV1().Endpoints(svc.Namespace).Get(ctx, svc.Name, metav1.GetOptions{})
+		if err != nil {
+			klog.Warningf("Get alertmanager endpoints %s/%s failed: %v", svc.Namespace, svc.Name, err)
+			continue
+		}
+		for _, subset := range ep.Subsets {
+			port, ok := d.endpointPort(subset.Ports)
+			if !ok {
+				continue
+			}
+			for _, addr := range subset.Addresses {
+				hosts = append(hosts, addr.IP+":"+strconv.Itoa(int(port)))
+			}
+		}
+	}
+
+	if len(hosts) == 0 {
+		svc := svcs[0]
+		host := fmt.Sprintf("%s.%s.svc:%d", svc.Name, svc.Namespace, d.servicePort(svc.Spec.Ports))
+		klog.Warningf("Not found ready alertmanager endpoints, use service %s", host)
+		return []string{host}, nil
+	}
+	sort.Strings(hosts)
+	return hosts, nil
+}
+
+func (d *alertmanagerDiscovery) endpointPort(ports []corev1.EndpointPort) (int32, bool) {
+	names := d.portNames()
+	for _, name := range names {
+		for _, p := range ports {
+			if p.Name == name {
+				return p.Port, true
+			}
+		}
+	}
+	for _, p := range ports {
+		if p.Port == defaultAlertmanagerPort || (d.PortName == "" && len(ports) == 1) {
+			return p.Port, true
+		}
+	}
+	return 0, false
+}
+
+func (d *alertmanagerDiscovery) servicePort(ports []corev1.ServicePort) int32 {
+	for _, name := range d.portNames() {
+		for _, p := range ports {
+			if p.Name == name {
+				return p.Port
+			}
+		}
+	}
+	return defaultAlertmanagerPort
+}
+
+func (d *alertmanagerDiscovery) portNames() []string {
+	if d.PortName != "" {
+		return []string{d.PortName}
+	}
+	return defaultAlertmanagerPortNames
+}
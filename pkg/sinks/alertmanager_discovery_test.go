@@ -0,0 +1,61 @@
+package sinks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func buildTestAlertmanagerService(namespace, name string, labels, selector map[string]string, ready ...string) (*corev1.Service, *corev1.Endpoints) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+		Spec: corev1.ServiceSpec{
+			Selector: selector,
+			Ports:    []corev1.ServicePort{{Name: "web", Port: 9093}},
+		},
+	}
+	ep := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Subsets: []corev1.EndpointSubset{{
+			Ports: []corev1.EndpointPort{{Name: "mesh", Port: 9094}, {Name: "web", Port: 9093}},
+		}},
+	}
+	for _, ip := range ready {
+		ep.Subsets[0].Addresses = append(ep.Subsets[0].Addresses, corev1.EndpointAddress{IP: ip})
+	}
+	ep.Subsets[0].NotReadyAddresses = []corev1.EndpointAddress{{IP: "10.0.0.100"}}
+	return svc, ep
+}
+
+func TestAlertmanagerDiscovery(t *testing.T) {
+	operatedSvc, operatedEp := buildTestAlertmanagerService("monitoring", "alertmanager-operated",
+		map[string]string{"operated-alertmanager": "true"}, map[string]string{"app.kubernetes.io/name": "alertmanager"}, "10.0.0.2", "10.0.0.1")
+	legacySvc, legacyEp := buildTestAlertmanagerService("default", "alertmanager",
+		nil, map[string]string{"app": "alertmanager"})
+	cli := fake.NewSimpleClientset(operatedSvc, operatedEp, legacySvc, legacyEp)
+
+	// prometheus-operator labels, ready endpoints only
+	d := &alertmanagerDiscovery{Namespace: "monitoring", LabelSelector: "operated-alertmanager=true"}
+	hosts, err := d.discover(context.TODO(), cli)
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.1:9093", "10.0.0.2:9093"}, hosts)
+
+	// legacy selector without ready endpoints falls back to service address
+	d = &alertmanagerDiscovery{}
+	hosts, err = d.discover(context.TODO(), cli)
+	require.NoError(t, err)
+	require.Equal(t, []string{"alertmanager.default.svc:9093"}, hosts)
+
+	d = &alertmanagerDiscovery{Namespace: "default", LabelSelector: "operated-alertmanager=true"}
+	_, err = d.discover(context.TODO(), cli)
+	require.Error(t, err)
+
+	d = &alertmanagerDiscovery{Namespace: "monitoring", LabelSelector: "operated-alertmanager=true", PortName: "mesh"}
+	hosts, err = d.discover(context.TODO(), cli)
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.1:9094", "10.0.0.2:9094"}, hosts)
+}
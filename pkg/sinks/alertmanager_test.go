@@ -2,14 +2,20 @@ package sinks
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
 	"net/url"
 	"testing"
 	"time"
 
+	"github.com/champly/eventexporter/pkg/kube"
 	"github.com/go-openapi/strfmt"
 	"github.com/prometheus/alertmanager/api/v2/client/alert"
 	"github.com/prometheus/alertmanager/api/v2/models"
 	"github.com/prometheus/alertmanager/cli"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestSendToAlertManager(t *testing.T) {
@@ -44,11 +50,265 @@ func TestSendToAlertManager(t *testing.T) {
 	alertParams := alert.NewPostAlertsParams().WithContext(context.TODO()).
 		WithAlerts(models.PostableAlerts{pa})
 
-	amclient := cli.NewAlertmanagerClient(&url.URL{Host: "127.0.0.1:9093"})
+	fam := newFakeAlertmanager()
+	defer fam.Close()
+
+	amclient := cli.NewAlertmanagerClient(&url.URL{Host: fam.host()})
 	r, err := amclient.Alert.PostAlerts(alertParams)
 	if err != nil {
 		t.Error(err)
 		return
 	}
 	t.Log(r.Error())
+	require.Len(t, fam.getPosts(), 1)
+}
+
+// fakeAlertmanager accepts the alerts unless status is set.
+type fakeAlertmanager struct {
+	*recordingServer
+	// status is the response status code, default is 200.
+	status int
+}
+
+func newFakeAlertmanager() *fakeAlertmanager {
+	fam := &fakeAlertmanager{}
+	fam.recordingServer = newRecordingServer(func(rw http.ResponseWriter, req *recordedRequest) {
+		if !json.Valid(req.Body) {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if fam.status != 0 {
+			rw.WriteHeader(fam.status)
+			json.NewEncoder(rw).Encode("injected failure")
+		}
+	})
+	return fam
+}
+
+// getPosts returns the accepted alerts.
+func (fam *fakeAlertmanager) getPosts() []models.PostableAlerts {
+	var posts []models.PostableAlerts
+	for _, req := range fam.requests() {
+		alerts := models.PostableAlerts{}
+		if req.Status == http.StatusOK && json.Unmarshal(req.Body, &alerts) == nil {
+			posts = append(posts, alerts)
+		}
+	}
+	return posts
+}
+
+func (fam *fakeAlertmanager) setStatus(status int) {
+	fam.Lock()
+	defer fam.Unlock()
+	fam.status = status
+}
+
+func (fam *fakeAlertmanager) getPaths() []string {
+	var paths []string
+	for _, req := range fam.requests() {
+		paths = append(paths, req.URL.Path)
+	}
+	return paths
+}
+
+func (fam *fakeAlertmanager) getAuthLogs() []string {
+	var authLogs []string
+	for _, req := range fam.requests() {
+		if req.Status == http.StatusOK {
+			authLogs = append(authLogs, req.Header.Get("Authorization"))
+		}
+	}
+	return authLogs
+}
+
+func buildTestEvent(name, reason string, count int32) *kube.EnhancedEvent {
+	ev := &kube.EnhancedEvent{}
+	ev.Namespace = "default"
+	ev.Name = name
+	ev.Type = "Warning"
+	ev.Reason = reason
+	ev.Count = count
+	ev.LastTimestamp = metav1.Now()
+	ev.Event.InvolvedObject = corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "nginx", UID: "uid-1"}
+	ev.InvolvedObject.ClusterName = "test"
+	return ev
+}
+
+func TestAlertmanagerExtendAndResolve(t *testing.T) {
+	fam := newFakeAlertmanager()
+	defer fam.Close()
+
+	sink, err := NewAlertmanagerSink(map[string]interface{}{
+		"host":          fam.host(),
+		"alertLifetime": "10m",
+		"resolveRules": []interface{}{
+			map[string]interface{}{"reason": "BackOff", "recoveryReason": "Started"},
+		},
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	backoff := buildTestEvent("nginx.backoff", "BackOff", 1)
+	require.NoError(t, sink.Send(context.TODO(), backoff))
+	// count not increased, should not re-post
+	require.NoError(t, sink.Send(context.TODO(), backoff))
+	require.Len(t, fam.getPosts(), 1)
+	endsAt := time.Time(fam.getPosts()[0][0].EndsAt)
+	require.WithinDuration(t, backoff.LastTimestamp.Add(time.Minute*10), endsAt, time.Second)
+
+	// count increased, re-post to extend the same alert without resolving it
+	backoff = buildTestEvent("nginx.backoff", "BackOff", 2)
+	require.NoError(t, sink.Send(context.TODO(), backoff))
+	posts := fam.getPosts()
+	require.Len(t, posts, 2)
+	require.Len(t, posts[1], 1)
+	require.Equal(t, posts[0][0].Labels, posts[1][0].Labels)
+	require.True(t, time.Time(posts[1][0].EndsAt).After(time.Now()))
+	require.Equal(t, "2", posts[1][0].Annotations["count"])
+
+	// recovery event resolves the alert
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.started", "Started", 1)))
+	posts = fam.getPosts()
+	require.Len(t, posts, 3)
+	require.Len(t, posts[2], 1)
+	require.Equal(t, "BackOff", posts[2][0].Labels["reason"])
+	require.WithinDuration(t, time.Now(), time.Time(posts[2][0].EndsAt), time.Second)
+
+	// nothing left to resolve when object deleted
+	notifier := sink.(ObjectDeleteNotifier)
+	require.NoError(t, notifier.OnObjectDeleted(context.TODO(), "test", &corev1.ObjectReference{UID: "uid-1"}))
+	require.Len(t, fam.getPosts(), 3)
+
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.failed", "Failed", 1)))
+	require.NoError(t, notifier.OnObjectDeleted(context.TODO(), "test", &corev1.ObjectReference{UID: "uid-1"}))
+	posts = fam.getPosts()
+	require.Len(t, posts, 5)
+	require.Equal(t, "Failed", posts[4][0].Labels["reason"])
+	require.WithinDuration(t, time.Now(), time.Time(posts[4][0].EndsAt), time.Second)
+}
+
+func TestAlertmanagerBatchFanOut(t *testing.T) {
+	fam1 := newFakeAlertmanager()
+	defer fam1.Close()
+	fam2 := newFakeAlertmanager()
+	defer fam2.Close()
+
+	sink, err := NewAlertmanagerSink(map[string]interface{}{
+		"hosts":         []interface{}{fam1.host(), fam2.URL},
+		"pathPrefix":    "/alertmanager",
+		"bearerToken":   "token",
+		"batchInterval": "1h",
+		"batchSize":     2,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.1", "BackOff", 1)))
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.2", "BackOff", 1)))
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.3", "BackOff", 1)))
+	// the first batch is full, the last alert is flushed when closed.
+	require.Eventually(t, func() bool { return len(fam1.getPosts()) == 1 && len(fam2.getPosts()) == 1 }, time.Second, time.Millisecond*10)
+	sink.Close()
+
+	for _, fam := range []*fakeAlertmanager{fam1, fam2} {
+		posts := fam.getPosts()
+		require.Len(t, posts, 2)
+		require.Len(t, posts[0], 2)
+		require.Len(t, posts[1], 1)
+		require.Equal(t, "/alertmanager/api/v2/alerts", fam.getPaths()[0])
+		require.Equal(t, "Bearer token", fam.getAuthLogs()[0])
+	}
+}
+
+func TestAlertmanagerSeverityAndGeneratorURL(t *testing.T) {
+	cfg := map[string]interface{}{
+		"host":         "127.0.0.1:9093",
+		"generatorURL": "https://grafana.example.com/d/events?var-cluster={{ .InvolvedObject.ClusterName }}&var-namespace={{ .Namespace }}",
+		"severityRules": []interface{}{
+			map[string]interface{}{"type": "Warning", "reason": "^OOMKilling$", "severity": "critical"},
+			map[string]interface{}{"type": "Warning", "severity": "warning"},
+		},
+	}
+	sink, err := NewAlertmanagerSink(cfg)
+	require.NoError(t, err)
+	defer sink.Close()
+	am := sink.(*alertmanager)
+
+	pa, err := am.buildPostableAlertData(buildTestEvent("nginx.oom", "OOMKilling", 1))
+	require.NoError(t, err)
+	require.Equal(t, "critical", pa.Labels["severity"])
+	require.Equal(t, "https://grafana.example.com/d/events?var-cluster=test&var-namespace=default", pa.GeneratorURL.String())
+
+	pa, err = am.buildPostableAlertData(buildTestEvent("nginx.backoff", "BackOff", 1))
+	require.NoError(t, err)
+	require.Equal(t, "warning", pa.Labels["severity"])
+
+	ev := buildTestEvent("nginx.started", "Started", 1)
+	ev.Type = "Normal"
+	pa, err = am.buildPostableAlertData(ev)
+	require.NoError(t, err)
+	_, ok := pa.Labels["severity"]
+	require.False(t, ok)
+
+	// severity from label layout takes precedence
+	cfg["labelLayout"] = map[string]interface{}{"severity": "page"}
+	sink, err = NewAlertmanagerSink(cfg)
+	require.NoError(t, err)
+	defer sink.Close()
+	pa, err = sink.(*alertmanager).buildPostableAlertData(buildTestEvent("nginx.oom", "OOMKilling", 1))
+	require.NoError(t, err)
+	require.Equal(t, "page", pa.Labels["severity"])
+}
+
+func TestAlertmanagerLegacyLabelLayout(t *testing.T) {
+	sink, err := NewAlertmanagerSink(map[string]interface{}{
+		"host":         "127.0.0.1:9093",
+		"laybelLayout": map[string]interface{}{"app": "legacy", "group": "legacy"},
+		"labelLayout":  map[string]interface{}{"app": "{{ .Name }}"},
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	pa, err := sink.(*alertmanager).buildPostableAlertData(buildTestEvent("nginx.backoff", "BackOff", 1))
+	require.NoError(t, err)
+	require.Equal(t, "nginx.backoff", pa.Labels["app"])
+	require.Equal(t, "legacy", pa.Labels["group"])
+}
+
+func TestAlertmanagerErrorClassify(t *testing.T) {
+	fam := newFakeAlertmanager()
+	defer fam.Close()
+
+	sink, err := NewAlertmanagerSink(map[string]interface{}{
+		"host":       fam.host(),
+		"maxRetries": 1,
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	// bad request is not retried
+	fam.setStatus(http.StatusBadRequest)
+	err = sink.Send(context.TODO(), buildTestEvent("nginx.1", "BackOff", 1))
+	require.Error(t, err)
+	require.False(t, IsRetryable(err))
+	var se *SendError
+	require.ErrorAs(t, err, &se)
+	require.Equal(t, ErrorKindClient, se.Kind)
+	require.Len(t, fam.getPaths(), 1)
+
+	// internal server error is retried
+	fam.setStatus(http.StatusInternalServerError)
+	err = sink.Send(context.TODO(), buildTestEvent("nginx.2", "BackOff", 1))
+	require.Error(t, err)
+	require.True(t, IsRetryable(err))
+	require.Len(t, fam.getPaths(), 3)
+
+	// canceled context is honored
+	fam.setStatus(0)
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	err = sink.Send(ctx, buildTestEvent("nginx.3", "BackOff", 1))
+	require.Error(t, err)
+	require.ErrorAs(t, err, &se)
+	require.Equal(t, ErrorKindNetwork, se.Kind)
+	require.ErrorIs(t, err, context.Canceled)
 }
@@ -0,0 +1,95 @@
+package sinks
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// batcher queues items and flushes them when size items are queued or every interval.
+type batcher[T any] struct {
+	size     int
+	interval time.Duration
+	queue    chan T
+	flush    func(items []T)
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// newBatcher starts a batcher, capacity is the max queued items.
+func newBatcher[T any](size int, interval time.Duration, capacity int, flush func(items []T)) *batcher[T] {
+	b := &batcher[T]{
+		size:     size,
+		interval: interval,
+		queue:    make(chan T, capacity),
+		flush:    flush,
+		stopCh:   make(chan struct{}),
+	}
+	b.wg.Add(1)
+	go b.run()
+	return b
+}
+
+// add queues items without blocking, it fails when the queue is full.
+func (b *batcher[T]) add(items ...T) error {
+	for i, item := range items {
+		select {
+		case b.queue <- item:
+		default:
+			return fmt.Errorf("batch queue is full, drop %d items", len(items)-i)
+		}
+	}
+	return nil
+}
+
+// stop flushes the queued items and waits for the last flush.
+func (b *batcher[T]) stop() {
+	b.stopOnce.Do(func() {
+		close(b.stopCh)
+	})
+	b.wg.Wait()
+}
+
+func (b *batcher[T]) run() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	batch := make([]T, 0, b.size)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		items := batch
+		batch = make([]T, 0, b.size)
+		b.flush(items)
+	}
+
+	for {
+		select {
+		case item := <-b.queue:
+			batch = append(batch, item)
+			if len(batch) >= b.size {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-b.stopCh:
+			// drain the queue before exit.
+			for {
+				select {
+				case item := <-b.queue:
+					batch = append(batch, item)
+					if len(batch) >= b.size {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
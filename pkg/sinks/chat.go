@@ -0,0 +1,368 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/champly/eventexporter/pkg/kube"
+	"golang.org/x/time/rate"
+	"k8s.io/klog/v2"
+)
+
+const (
+	SlackSinkName    = "slack"
+	TeamsSinkName    = "teams"
+	DingTalkSinkName = "dingtalk"
+	WeComSinkName    = "wecom"
+	FeishuSinkName   = "feishu"
+
+	defaultChatTemplate = `[{{ .Type }}] {{ .InvolvedObject.ClusterName }} {{ .Event.InvolvedObject.Kind }} {{ .Namespace }}/{{ .Event.InvolvedObject.Name }}
+{{ .Reason }}: {{ .Message }}`
+	defaultChatTitle      = "{{ .Reason }} {{ .Event.InvolvedObject.Kind }}/{{ .Event.InvolvedObject.Name }}"
+	defaultChatQueueSize  = 100
+	defaultChatTimeout    = time.Second * 10
+	defaultChatRetry      = 2
+	chatErrCodeThrottling = http.StatusTooManyRequests
+)
+
+// chatProvider describes the incoming webhook api of a chat tool.
+type chatProvider struct {
+	name string
+	// rateLimit and burst are the default limits of the webhook, these apis throttle
+	// aggressively so messages are queued and sent with the limits.
+	rateLimit rate.Limit
+	burst     int
+	// buildRequest returns the request url and json body of the message.
+	buildRequest func(c *chatConfig, title, text string) (string, interface{}, error)
+	// checkResponse checks the api error of a 2xx response body.
+	checkResponse func(body []byte) error
+}
+
+var chatProviders = []*chatProvider{
+	{
+		name:      SlackSinkName,
+		rateLimit: 1,
+		burst:     1,
+		buildRequest: func(c *chatConfig, title, text string) (string, interface{}, error) {
+			return c.Webhook, map[string]string{"text": text}, nil
+		},
+	},
+	{
+		name:      TeamsSinkName,
+		rateLimit: 4,
+		burst:     4,
+		buildRequest: func(c *chatConfig, title, text string) (string, interface{}, error) {
+			return c.Webhook, map[string]string{
+				"@type":    "MessageCard",
+				"@context": "https://schema.org/extensions",
+				"summary":  title,
+				"title":    title,
+				"text":     text,
+			}, nil
+		},
+	},
+	{
+		// https://open.dingtalk.com/document/robots/custom-robot-access
+		name:      DingTalkSinkName,
+		rateLimit: rate.Every(time.Minute / 20),
+		burst:     1,
+		buildRequest: func(c *chatConfig, title, text string) (string, interface{}, error) {
+			webhook := c.Webhook
+			if c.Secret != "" {
+				u, err := url.Parse(c.Webhook)
+				if err != nil {
+					return "", nil, err
+				}
+				timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+				query := u.Query()
+				query.Set("timestamp", timestamp)
+				query.Set("sign", dingTalkSign(timestamp, c.Secret))
+				u.RawQuery = query.Encode()
+				webhook = u.String()
+			}
+			return webhook, map[string]interface{}{
+				"msgtype":  "markdown",
+				"markdown": map[string]string{"title": title, "text": text},
+			}, nil
+		},
+		// 130101: send too fast
+		checkResponse: errCodeResponseChecker(130101),
+	},
+	{
+		// https://developer.work.weixin.qq.com/document/path/91770
+		name:      WeComSinkName,
+		rateLimit: rate.Every(time.Minute / 20),
+		burst:     1,
+		buildRequest: func(c *chatConfig, title, text string) (string, interface{}, error) {
+			return c.Webhook, map[string]interface{}{
+				"msgtype":  "markdown",
+				"markdown": map[string]string{"content": text},
+			}, nil
+		},
+		// 45009: api freq out of limit
+		checkResponse: errCodeResponseChecker(45009),
+	},
+	{
+		// https://open.feishu.cn/document/client-docs/bot-v3/add-custom-bot
+		name:      FeishuSinkName,
+		rateLimit: 5,
+		burst:     1,
+		buildRequest: func(c *chatConfig, title, text string) (string, interface{}, error) {
+			body := map[string]interface{}{
+				"msg_type": "text",
+				"content":  map[string]string{"text": text},
+			}
+			if c.Secret != "" {
+				timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+				body["timestamp"] = timestamp
+				body["sign"] = feishuSign(timestamp, c.Secret)
+			}
+			return c.Webhook, body, nil
+		},
+		checkResponse: func(body []byte) error {
+			resp := struct {
+				Code int    `json:"code"`
+				Msg  string `json:"msg"`
+			}{}
+			if err := json.Unmarshal(body, &resp); err != nil {
+				return fmt.Errorf("unmarshal response %s failed: %v", body, err)
+			}
+			switch resp.Code {
+			case 0:
+				return nil
+			case 9499, 11232:
+				// too many requests
+				return newStatusError(chatErrCodeThrottling, errors.New(resp.Msg))
+			}
+			return newStatusError(http.StatusBadRequest, fmt.Errorf("code %d: %s", resp.Code, resp.Msg))
+		},
+	},
+}
+
+func init() {
+	for _, provider := range chatProviders {
+		provider := provider
+		factory[provider.name] = func(cfg interface{}) (Sink, error) {
+			return newChatSink(provider, cfg)
+		}
+	}
+}
+
+type chatConfig struct {
+	Webhook string `yaml:"webhook"`
+	// Template is the message text template with sprig functions, it's markdown for
+	// teams, dingtalk and wecom.
+	Template string `yaml:"template"`
+	// Title is the template of message title, used by teams and dingtalk.
+	Title string `yaml:"title"`
+	// Secret is the signing secret of dingtalk and feishu.
+	Secret string `yaml:"secret"`
+	// RateLimit is the max messages per second, default is the limit of the chat api.
+	RateLimit float64 `yaml:"rateLimit"`
+	Burst     int     `yaml:"burst"`
+	// QueueSize is the max queued messages, messages are dropped when it's full.
+	QueueSize        int              `yaml:"queueSize"`
+	HTTPClientConfig httpClientConfig `yaml:",inline"`
+	Timeout          time.Duration    `yaml:"timeout"`
+	MaxRetries       *int             `yaml:"maxRetries"`
+}
+
+type chat struct {
+	*chatConfig
+	provider   *chatProvider
+	client     *http.Client
+	limiter    *rate.Limiter
+	maxRetries int
+	queue      chan *chatMessage
+	ctx        context.Context
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+type chatMessage struct {
+	title string
+	text  string
+}
+
+func newChatSink(provider *chatProvider, cfg interface{}) (Sink, error) {
+	chatCfg := &chatConfig{}
+	if err := unmarshalConfig(provider.name, cfg, chatCfg); err != nil {
+		return nil, err
+	}
+	if chatCfg.Webhook == "" {
+		return nil, fmt.Errorf("init receiver %s, webhook must be set", provider.name)
+	}
+	if chatCfg.Template == "" {
+		chatCfg.Template = defaultChatTemplate
+	}
+	if chatCfg.Title == "" {
+		chatCfg.Title = defaultChatTitle
+	}
+	if chatCfg.QueueSize <= 0 {
+		chatCfg.QueueSize = defaultChatQueueSize
+	}
+	if chatCfg.Timeout <= 0 {
+		chatCfg.Timeout = defaultChatTimeout
+	}
+
+	limit, burst := provider.rateLimit, provider.burst
+	if chatCfg.RateLimit > 0 {
+		limit = rate.Limit(chatCfg.RateLimit)
+	}
+	if chatCfg.Burst > 0 {
+		burst = chatCfg.Burst
+	}
+
+	client, err := chatCfg.HTTPClientConfig.newHTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s http client failed: %v", provider.name, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &chat{
+		chatConfig: chatCfg,
+		provider:   provider,
+		client:     client,
+		limiter:    rate.NewLimiter(limit, burst),
+		maxRetries: defaultChatRetry,
+		queue:      make(chan *chatMessage, chatCfg.QueueSize),
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	if chatCfg.MaxRetries != nil {
+		c.maxRetries = *chatCfg.MaxRetries
+	}
+	go c.run()
+	return c, nil
+}
+
+// Send renders the message and queues it, the message is sent within rate limit.
+func (c *chat) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	text, err := getLayoutString(ev, c.Template)
+	if err != nil {
+		return fmt.Errorf("render message failed: %v", err)
+	}
+	title, err := getLayoutString(ev, c.Title)
+	if err != nil {
+		return fmt.Errorf("render title failed: %v", err)
+	}
+
+	select {
+	case c.queue <- &chatMessage{title: title, text: text}:
+		return nil
+	default:
+		return fmt.Errorf("receiver %s queue is full, drop message of %s/%s", c.provider.name, ev.Namespace, ev.Name)
+	}
+}
+
+// Close stops sending, the queued messages are dropped because sending them
+// within rate limit may take a long time.
+func (c *chat) Close() {
+	c.cancel()
+	<-c.done
+	if n := len(c.queue); n > 0 {
+		klog.Warningf("Receiver %s closed, drop %d queued messages.", c.provider.name, n)
+	}
+}
+
+func (c *chat) run() {
+	defer close(c.done)
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case msg := <-c.queue:
+			if err := c.limiter.Wait(c.ctx); err != nil {
+				return
+			}
+			err := sendWithRetry(c.ctx, c.maxRetries, func(ctx context.Context) error {
+				ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+				defer cancel()
+				return c.post(ctx, msg)
+			})
+			if err != nil {
+				klog.Errorf("Receiver %s send message %q failed: %+v", c.provider.name, msg.title, err)
+			}
+		}
+	}
+}
+
+func (c *chat) post(ctx context.Context, msg *chatMessage) error {
+	webhook, payload, err := c.provider.buildRequest(c.chatConfig, msg.title, msg.text)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return newNetworkError(err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return newNetworkError(err)
+	}
+	if resp.StatusCode >= 300 {
+		return newStatusError(resp.StatusCode, errors.New(string(b)))
+	}
+	if c.provider.checkResponse != nil {
+		return c.provider.checkResponse(b)
+	}
+	return nil
+}
+
+// errCodeResponseChecker checks the errcode of dingtalk and wecom response.
+func errCodeResponseChecker(throttlingCode int) func(body []byte) error {
+	return func(body []byte) error {
+		resp := struct {
+			ErrCode int    `json:"errcode"`
+			ErrMsg  string `json:"errmsg"`
+		}{}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return fmt.Errorf("unmarshal response %s failed: %v", body, err)
+		}
+		switch resp.ErrCode {
+		case 0:
+			return nil
+		case throttlingCode:
+			return newStatusError(chatErrCodeThrottling, errors.New(resp.ErrMsg))
+		}
+		return newStatusError(http.StatusBadRequest, fmt.Errorf("errcode %d: %s", resp.ErrCode, resp.ErrMsg))
+	}
+}
+
+// dingTalkSign signs "timestamp\nsecret" with secret.
+func dingTalkSign(timestamp, secret string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// feishuSign uses "timestamp\nsecret" as key to sign empty data.
+func feishuSign(timestamp, secret string) string {
+	h := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
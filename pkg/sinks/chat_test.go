@@ -0,0 +1,83 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeChatServer replies the responses in order, the last one is repeated.
+func newFakeChatServer(responses ...string) *recordingServer {
+	return newRecordingServer(func(rw http.ResponseWriter, req *recordedRequest) {
+		resp := responses[0]
+		if len(responses) > 1 {
+			responses = responses[1:]
+		}
+		fmt.Fprint(rw, resp)
+	})
+}
+
+func TestDingTalkSignedAndThrottled(t *testing.T) {
+	fcs := newFakeChatServer(`{"errcode":130101,"errmsg":"send too fast"}`, `{"errcode":0,"errmsg":"ok"}`)
+	defer fcs.Close()
+
+	sink, err := newSinkForTest(DingTalkSinkName, map[string]interface{}{
+		"webhook":   fcs.URL + "/robot/send?access_token=token",
+		"secret":    "SEC",
+		"template":  "{{ .Reason }} {{ .Message | upper }}",
+		"rateLimit": 100,
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	ev := buildTestEvent("nginx.backoff", "BackOff", 1)
+	ev.Message = "restarting"
+	require.NoError(t, sink.Send(context.TODO(), ev))
+	// throttled message is retried
+	require.Eventually(t, func() bool { return fcs.count() == 2 }, time.Second*5, time.Millisecond*10)
+
+	req := fcs.requests()[1]
+	markdown := req.jsonBody(t)["markdown"].(map[string]interface{})
+	require.Equal(t, "BackOff RESTARTING", markdown["text"])
+	require.Equal(t, "BackOff Pod/nginx", markdown["title"])
+	query := req.URL.Query()
+	require.Equal(t, dingTalkSign(query.Get("timestamp"), "SEC"), query.Get("sign"))
+}
+
+func TestChatRateLimit(t *testing.T) {
+	fcs := newFakeChatServer("ok")
+	defer fcs.Close()
+
+	sink, err := newSinkForTest(SlackSinkName, map[string]interface{}{
+		"webhook":   fcs.URL,
+		"rateLimit": 10,
+		"burst":     1,
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)))
+	}
+	require.Eventually(t, func() bool { return fcs.count() == 3 }, time.Second*5, time.Millisecond*10)
+	require.GreaterOrEqual(t, time.Since(start), time.Millisecond*190)
+
+	require.Equal(t, "[Warning] test Pod default/nginx\nBackOff: ", fcs.payloads(t)[0]["text"])
+}
+
+func TestWeComErrCode(t *testing.T) {
+	checker := errCodeResponseChecker(45009)
+	require.NoError(t, checker([]byte(`{"errcode":0,"errmsg":"ok"}`)))
+	require.True(t, IsRetryable(checker([]byte(`{"errcode":45009,"errmsg":"api freq out of limit"}`))))
+	require.False(t, IsRetryable(checker([]byte(`{"errcode":93000,"errmsg":"invalid webhook url"}`))))
+}
+
+// newSinkForTest builds the sink registered with name.
+func newSinkForTest(name string, cfg interface{}) (Sink, error) {
+	return factory[name](cfg)
+}
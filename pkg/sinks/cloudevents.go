@@ -0,0 +1,160 @@
+package sinks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/champly/eventexporter/pkg/kube"
+)
+
+const (
+	CloudEventsSinkName = "cloudevents"
+
+	// https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/bindings/http-protocol-binding.md
+	cloudEventsModeStructured   = "structured"
+	cloudEventsModeBinary       = "binary"
+	cloudEventsSpecVersion      = "1.0"
+	cloudEventsContentType      = "application/cloudevents+json"
+	cloudEventsDataContentType  = "application/json"
+	cloudEventsHeaderPrefix     = "ce-"
+	defaultCloudEventsType      = "io.k8s.event.{{ .Reason }}"
+	defaultCloudEventsSubject   = "{{ .Event.InvolvedObject.Kind }}/{{ .Event.InvolvedObject.Name }}"
+	cloudEventsClusterExtension = "cluster"
+)
+
+func init() {
+	factory[CloudEventsSinkName] = NewCloudEventsSink
+}
+
+// cloudEventsConfig encodes events as CloudEvents with the http binding.
+type cloudEventsConfig struct {
+	// Mode is structured (default) or binary.
+	Mode string `yaml:"mode"`
+	// Source is the template of source, default is
+	// /clusters/<cluster>/namespaces/<namespace>/<kind>/<name> of the involved object.
+	Source string `yaml:"source"`
+	// Type is the template of type, default is io.k8s.event.<reason>.
+	Type    string `yaml:"type"`
+	Subject string `yaml:"subject"`
+}
+
+func (c *cloudEventsConfig) complete() error {
+	switch c.Mode {
+	case "":
+		c.Mode = cloudEventsModeStructured
+	case cloudEventsModeStructured, cloudEventsModeBinary:
+	default:
+		return fmt.Errorf("cloudevents mode %s not supported, must be %s or %s", c.Mode, cloudEventsModeStructured, cloudEventsModeBinary)
+	}
+	if c.Type == "" {
+		c.Type = defaultCloudEventsType
+	}
+	if c.Subject == "" {
+		c.Subject = defaultCloudEventsSubject
+	}
+	return nil
+}
+
+// encode returns the http headers and body of the event, data is the JSON payload.
+func (c *cloudEventsConfig) encode(ev *kube.EnhancedEvent, data []byte) (http.Header, []byte, error) {
+	attributes, err := c.attributes(ev)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := http.Header{}
+	if c.Mode == cloudEventsModeBinary {
+		for k, v := range attributes {
+			header.Set(cloudEventsHeaderPrefix+k, v)
+		}
+		header.Set("Content-Type", cloudEventsDataContentType)
+		return header, data, nil
+	}
+
+	envelope := map[string]interface{}{
+		"datacontenttype": cloudEventsDataContentType,
+		"data":            json.RawMessage(data),
+	}
+	for k, v := range attributes {
+		envelope[k] = v
+	}
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, nil, err
+	}
+	header.Set("Content-Type", cloudEventsContentType)
+	return header, body, nil
+}
+
+// attributes returns the context attributes except data and datacontenttype.
+func (c *cloudEventsConfig) attributes(ev *kube.EnhancedEvent) (map[string]string, error) {
+	source := cloudEventsSource(ev)
+	if c.Source != "" {
+		s, err := getLayoutString(ev, c.Source)
+		if err != nil {
+			return nil, fmt.Errorf("render cloudevents source failed: %v", err)
+		}
+		source = s
+	}
+	typ, err := getLayoutString(ev, c.Type)
+	if err != nil {
+		return nil, fmt.Errorf("render cloudevents type failed: %v", err)
+	}
+	subject, err := getLayoutString(ev, c.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("render cloudevents subject failed: %v", err)
+	}
+	if source == "" || typ == "" {
+		return nil, fmt.Errorf("cloudevents source and type must not be empty")
+	}
+
+	attributes := map[string]string{
+		"specversion": cloudEventsSpecVersion,
+		// the same event with the same count is delivered only once.
+		"id":     string(ev.UID) + "-" + strconv.Itoa(int(ev.Count)),
+		"source": source,
+		"type":   typ,
+	}
+	if subject != "" {
+		attributes["subject"] = subject
+	}
+	if ts := ev.GetLastTimestamp(); !ts.IsZero() {
+		attributes["time"] = ts.UTC().Format(time.RFC3339Nano)
+	}
+	if ev.InvolvedObject.ClusterName != "" {
+		attributes[cloudEventsClusterExtension] = ev.InvolvedObject.ClusterName
+	}
+	return attributes, nil
+}
+
+// cloudEventsSource is the uri-reference of the involved object.
+func cloudEventsSource(ev *kube.EnhancedEvent) string {
+	ref := ev.Event.InvolvedObject
+	elems := []string{"/"}
+	if ev.InvolvedObject.ClusterName != "" {
+		elems = append(elems, "clusters", ev.InvolvedObject.ClusterName)
+	}
+	if ref.Namespace != "" {
+		elems = append(elems, "namespaces", ref.Namespace)
+	}
+	elems = append(elems, strings.ToLower(ref.Kind), ref.Name)
+	return path.Join(elems...)
+}
+
+// NewCloudEventsSink is the webhook sink which always encodes events as CloudEvents.
+func NewCloudEventsSink(cfg interface{}) (Sink, error) {
+	ceCfg := &struct {
+		webhookConfig     `yaml:",inline"`
+		cloudEventsConfig `yaml:",inline"`
+	}{}
+	if err := unmarshalConfig(CloudEventsSinkName, cfg, ceCfg); err != nil {
+		return nil, err
+	}
+	ceCfg.webhookConfig.CloudEvents = &ceCfg.cloudEventsConfig
+	return newWebhookSink(CloudEventsSinkName, &ceCfg.webhookConfig)
+}
@@ -0,0 +1,71 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloudEventsStructured(t *testing.T) {
+	server := newRecordingServer(nil)
+	defer server.Close()
+
+	sink, err := NewCloudEventsSink(map[string]interface{}{
+		"url":    server.URL,
+		"layout": map[string]interface{}{"reason": "{{ .Reason }}"},
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 3)))
+	require.Eventually(t, func() bool { return server.count() == 1 }, time.Second*5, time.Millisecond*10)
+	req := server.requests()[0]
+	require.Equal(t, cloudEventsContentType, req.Header.Get("Content-Type"))
+
+	ce := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(req.Body, &ce))
+	require.Equal(t, "1.0", ce["specversion"])
+	require.Equal(t, "/clusters/test/namespaces/default/pod/nginx", ce["source"])
+	require.Equal(t, "io.k8s.event.BackOff", ce["type"])
+	require.Equal(t, "Pod/nginx", ce["subject"])
+	require.Equal(t, "test", ce["cluster"])
+	require.Equal(t, map[string]interface{}{"reason": "BackOff"}, ce["data"])
+	require.NotEmpty(t, ce["time"])
+}
+
+func TestWebhookCloudEventsBinary(t *testing.T) {
+	server := newRecordingServer(nil)
+	defer server.Close()
+
+	sink, err := NewWebhookSink(map[string]interface{}{
+		"url":     server.URL,
+		"headers": map[string]interface{}{"X-Cluster": "{{ .InvolvedObject.ClusterName }}"},
+		"layout":  map[string]interface{}{"reason": "{{ .Reason }}"},
+		"cloudEvents": map[string]interface{}{
+			"mode": "binary",
+			"type": "com.example.{{ .Reason | lower }}",
+		},
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	ev := buildTestEvent("nginx.backoff", "BackOff", 3)
+	ev.UID = "event-uid"
+	require.NoError(t, sink.Send(context.TODO(), ev))
+	require.Eventually(t, func() bool { return server.count() == 1 }, time.Second*5, time.Millisecond*10)
+	req := server.requests()[0]
+	require.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	require.Equal(t, "test", req.Header.Get("X-Cluster"))
+	require.Equal(t, "event-uid-3", req.Header.Get("Ce-Id"))
+	require.Equal(t, "com.example.backoff", req.Header.Get("Ce-Type"))
+	require.Equal(t, "/clusters/test/namespaces/default/pod/nginx", req.Header.Get("Ce-Source"))
+	require.JSONEq(t, `{"reason":"BackOff"}`, string(req.Body))
+}
+
+func TestWebhookInvalidCloudEventsMode(t *testing.T) {
+	_, err := NewCloudEventsSink(map[string]interface{}{"url": "http://127.0.0.1", "mode": "batch"})
+	require.Error(t, err)
+}
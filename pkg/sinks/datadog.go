@@ -0,0 +1,260 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/champly/eventexporter/pkg/kube"
+	"k8s.io/klog/v2"
+)
+
+const (
+	DatadogSinkName = "datadog"
+
+	defaultDatadogSite           = "datadoghq.com"
+	defaultDatadogTitle          = "{{ .Event.InvolvedObject.Kind }} {{ .Event.InvolvedObject.Namespace }}/{{ .Event.InvolvedObject.Name }}: {{ .Reason }}"
+	defaultDatadogText           = "{{ .Message }}"
+	defaultDatadogAlertType      = `{{ if eq .Type "Warning" }}warning{{ else }}info{{ end }}`
+	defaultDatadogAggregationKey = "{{ .InvolvedObject.ClusterName }}/{{ .Event.InvolvedObject.Namespace }}/{{ .Event.InvolvedObject.Kind }}/{{ .Event.InvolvedObject.Name }}"
+	defaultDatadogTimeout        = time.Second * 10
+	defaultDatadogRetry          = 2
+
+	datadogSourceTypeName = "kubernetes"
+	// datadogMaxAggregationKey is the max length of aggregation key accepted by events api.
+	datadogMaxAggregationKey = 100
+	datadogMaxTitle          = 100
+	datadogMaxText           = 4000
+)
+
+var datadogAlertTypes = map[string]bool{"error": true, "warning": true, "info": true, "success": true}
+
+func init() {
+	factory[DatadogSinkName] = NewDatadogSink
+}
+
+type datadogConfig struct {
+	// Site is the datadog site, e.g. datadoghq.eu, the events are posted to
+	// https://api.<site>/api/v1/events.
+	Site string `yaml:"site"`
+	// URL overrides the events api address built from site.
+	URL    string `yaml:"url"`
+	APIKey string `yaml:"apiKey"`
+	// Title, Text, Host, AlertType and AggregationKey are templates, alert type
+	// must be rendered to one of error, warning, info and success.
+	Title          string `yaml:"title"`
+	Text           string `yaml:"text"`
+	Host           string `yaml:"host"`
+	AlertType      string `yaml:"alertType"`
+	AggregationKey string `yaml:"aggregationKey"`
+	// Priority is normal or low.
+	Priority string `yaml:"priority"`
+	// Tags are the templates of extra tags.
+	Tags map[string]string `yaml:"tags"`
+	// LabelTags adds the labels of involved object as tags, default is true.
+	LabelTags        *bool            `yaml:"labelTags"`
+	HTTPClientConfig httpClientConfig `yaml:",inline"`
+	Timeout          time.Duration    `yaml:"timeout"`
+	MaxRetries       *int             `yaml:"maxRetries"`
+}
+
+type datadogEvent struct {
+	Title          string   `json:"title"`
+	Text           string   `json:"text"`
+	DateHappened   int64    `json:"date_happened,omitempty"`
+	Priority       string   `json:"priority,omitempty"`
+	Host           string   `json:"host,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	AlertType      string   `json:"alert_type,omitempty"`
+	AggregationKey string   `json:"aggregation_key,omitempty"`
+	SourceTypeName string   `json:"source_type_name"`
+}
+
+type datadog struct {
+	*datadogConfig
+	client     *http.Client
+	maxRetries int
+}
+
+func NewDatadogSink(cfg interface{}) (Sink, error) {
+	datadogCfg := &datadogConfig{}
+	if err := unmarshalConfig(DatadogSinkName, cfg, datadogCfg); err != nil {
+		return nil, err
+	}
+	if datadogCfg.APIKey == "" {
+		return nil, fmt.Errorf("init receiver %s, apiKey must be set", DatadogSinkName)
+	}
+	if datadogCfg.Priority != "" && datadogCfg.Priority != "normal" && datadogCfg.Priority != "low" {
+		return nil, fmt.Errorf("init receiver %s, unsupported priority %s", DatadogSinkName, datadogCfg.Priority)
+	}
+	if datadogCfg.Site == "" {
+		datadogCfg.Site = defaultDatadogSite
+	}
+	if datadogCfg.URL == "" {
+		datadogCfg.URL = fmt.Sprintf("https://api.%s/api/v1/events", datadogCfg.Site)
+	}
+	if datadogCfg.Title == "" {
+		datadogCfg.Title = defaultDatadogTitle
+	}
+	if datadogCfg.Text == "" {
+		datadogCfg.Text = defaultDatadogText
+	}
+	if datadogCfg.AlertType == "" {
+		datadogCfg.AlertType = defaultDatadogAlertType
+	}
+	if datadogCfg.AggregationKey == "" {
+		datadogCfg.AggregationKey = defaultDatadogAggregationKey
+	}
+	if datadogCfg.Timeout <= 0 {
+		datadogCfg.Timeout = defaultDatadogTimeout
+	}
+	if datadogCfg.LabelTags == nil {
+		labelTags := true
+		datadogCfg.LabelTags = &labelTags
+	}
+
+	client, err := datadogCfg.HTTPClientConfig.newHTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s http client failed: %v", DatadogSinkName, err)
+	}
+	d := &datadog{
+		datadogConfig: datadogCfg,
+		client:        client,
+		maxRetries:    defaultDatadogRetry,
+	}
+	if datadogCfg.MaxRetries != nil {
+		d.maxRetries = *datadogCfg.MaxRetries
+	}
+	klog.Infof("Datadog url: %s", datadogCfg.URL)
+	return d, nil
+}
+
+func (d *datadog) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	event, err := d.buildEvent(ev)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return sendWithRetry(ctx, d.maxRetries, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+		return d.post(ctx, body)
+	})
+}
+
+func (d *datadog) Close() {
+	d.client.CloseIdleConnections()
+}
+
+func (d *datadog) buildEvent(ev *kube.EnhancedEvent) (*datadogEvent, error) {
+	event := &datadogEvent{
+		Priority:       d.Priority,
+		Tags:           d.buildTags(ev),
+		SourceTypeName: datadogSourceTypeName,
+	}
+	if ts := ev.GetLastTimestamp(); !ts.IsZero() {
+		event.DateHappened = ts.Unix()
+	}
+	for _, f := range []struct {
+		name string
+		text string
+		out  *string
+	}{
+		{"title", d.Title, &event.Title},
+		{"text", d.Text, &event.Text},
+		{"host", d.Host, &event.Host},
+		{"alertType", d.AlertType, &event.AlertType},
+		{"aggregationKey", d.AggregationKey, &event.AggregationKey},
+	} {
+		if f.text == "" {
+			continue
+		}
+		v, err := getLayoutString(ev, f.text)
+		if err != nil {
+			return nil, fmt.Errorf("render %s failed: %v", f.name, err)
+		}
+		*f.out = strings.TrimSpace(v)
+	}
+
+	if !datadogAlertTypes[event.AlertType] {
+		return nil, fmt.Errorf("unsupported alert type %q", event.AlertType)
+	}
+	event.Title = truncate(event.Title, datadogMaxTitle)
+	event.Text = truncate(event.Text, datadogMaxText)
+	// the long key is hashed to keep the events of the object in one aggregation.
+	if len(event.AggregationKey) > datadogMaxAggregationKey {
+		sum := sha256.Sum256([]byte(event.AggregationKey))
+		event.AggregationKey = hex.EncodeToString(sum[:])[:datadogMaxAggregationKey/2]
+	}
+	return event, nil
+}
+
+// buildTags returns the tags of involved object, the labels of object and the
+// extra tags are appended in key order.
+func (d *datadog) buildTags(ev *kube.EnhancedEvent) []string {
+	tags := []string{}
+	for _, tag := range [][2]string{
+		{"kube_cluster_name", ev.InvolvedObject.ClusterName},
+		{"kube_namespace", ev.Event.InvolvedObject.Namespace},
+		{"kube_kind", ev.Event.InvolvedObject.Kind},
+		{"kube_name", ev.Event.InvolvedObject.Name},
+		{"event_type", ev.Type},
+		{"event_reason", ev.Reason},
+	} {
+		if tag[1] != "" {
+			tags = append(tags, tag[0]+":"+tag[1])
+		}
+	}
+	if *d.LabelTags {
+		for _, k := range sortedKeys(ev.InvolvedObject.Labels) {
+			tags = append(tags, k+":"+ev.InvolvedObject.Labels[k])
+		}
+	}
+	extra := getLayoutLabels(ev, d.Tags)
+	for _, k := range sortedKeys(extra) {
+		tags = append(tags, k+":"+extra[k])
+	}
+	return tags
+}
+
+func (d *datadog) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("DD-API-KEY", d.APIKey)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return newNetworkError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		return newStatusError(resp.StatusCode, errors.New(string(b)))
+	}
+	return nil
+}
+
+// truncate cuts the string to max runes.
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max])
+}
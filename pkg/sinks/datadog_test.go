@@ -0,0 +1,79 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatadogSend(t *testing.T) {
+	srv := newRecordingServer(func(rw http.ResponseWriter, req *recordedRequest) {
+		rw.WriteHeader(http.StatusAccepted)
+	})
+	defer srv.Close()
+
+	sink, err := NewDatadogSink(map[string]interface{}{
+		"url":    srv.URL,
+		"apiKey": "key",
+		"tags":   map[string]string{"owner": "{{ index .InvolvedObject.Labels \"team\" }}"},
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	ev := buildTestEvent("nginx.backoff", "BackOff", 1)
+	ev.InvolvedObject.Labels = map[string]string{"app": "nginx", "team": "infra"}
+	require.NoError(t, sink.Send(context.TODO(), ev))
+
+	requests := srv.requests()
+	require.Len(t, requests, 1)
+	require.Equal(t, "key", requests[0].Header.Get("DD-API-KEY"))
+	event := datadogEvent{}
+	require.NoError(t, json.Unmarshal(requests[0].Body, &event))
+	require.Equal(t, "Pod default/nginx: BackOff", event.Title)
+	require.Equal(t, ev.Message, event.Text)
+	require.Equal(t, "warning", event.AlertType)
+	require.Equal(t, "test/default/Pod/nginx", event.AggregationKey)
+	require.Equal(t, ev.LastTimestamp.Unix(), event.DateHappened)
+	require.Equal(t, datadogSourceTypeName, event.SourceTypeName)
+	require.Equal(t, []string{
+		"kube_cluster_name:test",
+		"kube_namespace:default",
+		"kube_kind:Pod",
+		"kube_name:nginx",
+		"event_type:Warning",
+		"event_reason:BackOff",
+		"app:nginx",
+		"team:infra",
+		"owner:infra",
+	}, event.Tags)
+}
+
+func TestDatadogBuildEvent(t *testing.T) {
+	sink, err := NewDatadogSink(map[string]interface{}{"apiKey": "key", "labelTags": false})
+	require.NoError(t, err)
+	d := sink.(*datadog)
+	require.Equal(t, "https://api.datadoghq.com/api/v1/events", d.URL)
+
+	ev := buildTestEvent("nginx.pulled", "Pulled", 1)
+	ev.Type = "Normal"
+	ev.InvolvedObject.Labels = map[string]string{"app": "nginx"}
+	ev.Event.InvolvedObject.Name = strings.Repeat("x", 120)
+	event, err := d.buildEvent(ev)
+	require.NoError(t, err)
+	require.Equal(t, "info", event.AlertType)
+	// the long aggregation key is hashed.
+	require.Len(t, event.AggregationKey, datadogMaxAggregationKey/2)
+	require.Len(t, event.Title, datadogMaxTitle)
+	require.NotContains(t, event.Tags, "app:nginx")
+
+	d.AlertType = "{{ .Reason }}"
+	_, err = d.buildEvent(ev)
+	require.Error(t, err)
+
+	_, err = NewDatadogSink(map[string]interface{}{"apiKey": "key", "priority": "high"})
+	require.Error(t, err)
+}
@@ -0,0 +1,281 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/Masterminds/sprig"
+	"github.com/champly/eventexporter/pkg/kube"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ElasticsearchSinkName = "elasticsearch"
+	OpenSearchSinkName    = "opensearch"
+
+	defaultElasticsearchIndex         = `k8s-events-{{ .Time.Format "2006.01.02" }}`
+	defaultElasticsearchBatchSize     = 500
+	defaultElasticsearchBatchInterval = time.Second * 5
+	defaultElasticsearchTimeout       = time.Second * 30
+	defaultElasticsearchRetry         = 3
+	elasticsearchQueueCapacity        = 10
+)
+
+func init() {
+	// opensearch keeps the bulk api of elasticsearch.
+	factory[ElasticsearchSinkName] = NewElasticsearchSink
+	factory[OpenSearchSinkName] = NewElasticsearchSink
+}
+
+type elasticsearchConfig struct {
+	// Hosts are the urls of cluster nodes, requests are balanced over them.
+	Hosts []string `yaml:"hosts"`
+	// Index is the template of index name, the event time in UTC is .Time, e.g.
+	// k8s-events-{{ .InvolvedObject.ClusterName }}-{{ .Time.Format "2006.01.02" }}.
+	Index string `yaml:"index"`
+	// Layout is the document layout, the whole event is indexed when it's empty.
+	Layout map[string]interface{} `yaml:"layout"`
+	// APIKey is the base64 encoded api key, it's exclusive with basicAuth.
+	APIKey           string           `yaml:"apiKey"`
+	HTTPClientConfig httpClientConfig `yaml:",inline"`
+	BatchSize        int              `yaml:"batchSize"`
+	BatchInterval    time.Duration    `yaml:"batchInterval"`
+	// Timeout limits every single bulk request.
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxRetries is the retry times of the bulk request and of every failed document.
+	MaxRetries *int `yaml:"maxRetries"`
+}
+
+type elasticsearch struct {
+	*elasticsearchConfig
+	indexTmpl  *template.Template
+	client     *http.Client
+	maxRetries int
+	batcher    *batcher[*elasticsearchDoc]
+	// next is used to balance requests over hosts.
+	next uint32
+}
+
+type elasticsearchDoc struct {
+	index   string
+	id      string
+	body    []byte
+	retries int
+}
+
+type elasticsearchBulkResponse struct {
+	Errors bool                                     `json:"errors"`
+	Items  []map[string]elasticsearchBulkItemResult `json:"items"`
+}
+
+type elasticsearchBulkItemResult struct {
+	Index  string          `json:"_index"`
+	ID     string          `json:"_id"`
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+func NewElasticsearchSink(cfg interface{}) (Sink, error) {
+	esCfg := &elasticsearchConfig{}
+	if err := unmarshalConfig(ElasticsearchSinkName, cfg, esCfg); err != nil {
+		return nil, err
+	}
+	if len(esCfg.Hosts) == 0 {
+		return nil, fmt.Errorf("init receiver %s, hosts must be set", ElasticsearchSinkName)
+	}
+	if esCfg.APIKey != "" && esCfg.HTTPClientConfig.BasicAuth != nil {
+		return nil, fmt.Errorf("init receiver %s, apiKey and basicAuth are mutually exclusive", ElasticsearchSinkName)
+	}
+	if esCfg.Index == "" {
+		esCfg.Index = defaultElasticsearchIndex
+	}
+	if esCfg.BatchSize <= 0 {
+		esCfg.BatchSize = defaultElasticsearchBatchSize
+	}
+	if esCfg.BatchInterval <= 0 {
+		esCfg.BatchInterval = defaultElasticsearchBatchInterval
+	}
+	if esCfg.Timeout <= 0 {
+		esCfg.Timeout = defaultElasticsearchTimeout
+	}
+	for i := range esCfg.Hosts {
+		esCfg.Hosts[i] = strings.TrimSuffix(esCfg.Hosts[i], "/")
+	}
+
+	indexTmpl, err := template.New("index").Funcs(sprig.TxtFuncMap()).Option("missingkey=zero").Parse(esCfg.Index)
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s, parse index template failed: %v", ElasticsearchSinkName, err)
+	}
+	client, err := esCfg.HTTPClientConfig.newHTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s http client failed: %v", ElasticsearchSinkName, err)
+	}
+
+	es := &elasticsearch{
+		elasticsearchConfig: esCfg,
+		indexTmpl:           indexTmpl,
+		client:              client,
+		maxRetries:          defaultElasticsearchRetry,
+	}
+	if esCfg.MaxRetries != nil {
+		es.maxRetries = *esCfg.MaxRetries
+	}
+	es.batcher = newBatcher(esCfg.BatchSize, esCfg.BatchInterval, esCfg.BatchSize*elasticsearchQueueCapacity, es.flush)
+	klog.Infof("Elasticsearch urls: %s", strings.Join(esCfg.Hosts, ","))
+	return es, nil
+}
+
+// Send queues the event as a document, the documents are indexed with bulk api.
+func (es *elasticsearch) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	doc, err := es.buildDoc(ev)
+	if err != nil {
+		return err
+	}
+	return es.batcher.add(doc)
+}
+
+// Close flushes the queued documents.
+func (es *elasticsearch) Close() {
+	es.batcher.stop()
+}
+
+func (es *elasticsearch) buildDoc(ev *kube.EnhancedEvent) (*elasticsearchDoc, error) {
+	body, err := serializeEventWithLayout(es.Layout, ev)
+	if err != nil {
+		return nil, err
+	}
+	index, err := renderIndexTemplate(es.indexTmpl, ev)
+	if err != nil {
+		return nil, fmt.Errorf("render index %s failed: %v", es.Index, err)
+	}
+
+	return &elasticsearchDoc{
+		index: index,
+		// the same event with the same count is indexed only once.
+		id:   string(ev.UID) + "-" + strconv.Itoa(int(ev.Count)),
+		body: body,
+	}, nil
+}
+
+// flush indexes documents, the documents failed with retryable status are queued
+// again until retries are used up.
+func (es *elasticsearch) flush(docs []*elasticsearchDoc) {
+	failed, err := es.bulk(context.Background(), docs)
+	if err != nil {
+		klog.Errorf("Receiver %s bulk %d documents failed: %+v", ElasticsearchSinkName, len(docs), err)
+		return
+	}
+
+	for _, doc := range failed {
+		doc.retries++
+		if doc.retries > es.maxRetries {
+			klog.Errorf("Receiver %s drop document %s/%s, retries are used up.", ElasticsearchSinkName, doc.index, doc.id)
+			continue
+		}
+		if err = es.batcher.add(doc); err != nil {
+			klog.Errorf("Receiver %s requeue document %s/%s failed: %v", ElasticsearchSinkName, doc.index, doc.id, err)
+		}
+	}
+	klog.V(4).Infof("Receiver %s bulk %d documents, %d failed.", ElasticsearchSinkName, len(docs), len(failed))
+}
+
+// bulk sends documents with bulk api and returns the documents which should be retried.
+func (es *elasticsearch) bulk(ctx context.Context, docs []*elasticsearchDoc) ([]*elasticsearchDoc, error) {
+	body := &bytes.Buffer{}
+	encoder := json.NewEncoder(body)
+	for _, doc := range docs {
+		action := map[string]map[string]string{"index": {"_index": doc.index, "_id": doc.id}}
+		if err := encoder.Encode(action); err != nil {
+			return nil, err
+		}
+		body.Write(doc.body)
+		body.WriteByte('\n')
+	}
+
+	resp := &elasticsearchBulkResponse{}
+	err := sendWithRetry(ctx, es.maxRetries, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, es.Timeout)
+		defer cancel()
+		return es.post(ctx, body.Bytes(), resp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Errors {
+		return nil, nil
+	}
+
+	var failed []*elasticsearchDoc
+	for i, item := range resp.Items {
+		if i >= len(docs) {
+			break
+		}
+		for _, result := range item {
+			if result.Status < 300 {
+				continue
+			}
+			if newStatusError(result.Status, nil).Retryable() {
+				failed = append(failed, docs[i])
+				continue
+			}
+			klog.Errorf("Receiver %s index document %s/%s failed with status %d: %s", ElasticsearchSinkName, result.Index, result.ID, result.Status, result.Error)
+		}
+	}
+	return failed, nil
+}
+
+func (es *elasticsearch) post(ctx context.Context, body []byte, out interface{}) error {
+	host := es.Hosts[int(atomic.AddUint32(&es.next, 1))%len(es.Hosts)]
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, host+"/_bulk", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if es.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+es.APIKey)
+	}
+
+	resp, err := es.client.Do(req)
+	if err != nil {
+		return newNetworkError(err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return newNetworkError(err)
+	}
+	if resp.StatusCode >= 300 {
+		return newStatusError(resp.StatusCode, errors.New(string(b)))
+	}
+	return json.Unmarshal(b, out)
+}
+
+// indexData is the data of index template.
+type indexData struct {
+	*kube.EnhancedEvent
+	// Time is the event time in UTC.
+	Time time.Time
+}
+
+func renderIndexTemplate(tmpl *template.Template, ev *kube.EnhancedEvent) (string, error) {
+	ts := ev.GetLastTimestamp().UTC()
+	if ts.IsZero() {
+		ts = time.Now().UTC()
+	}
+	buf := &strings.Builder{}
+	if err := tmpl.Execute(buf, &indexData{EnhancedEvent: ev, Time: ts}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
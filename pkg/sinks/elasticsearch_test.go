@@ -0,0 +1,107 @@
+package sinks
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestRenderIndexTemplate(t *testing.T) {
+	ev := buildTestEvent("nginx.backoff", "BackOff", 1)
+	ev.LastTimestamp.Time = time.Date(2023, 5, 12, 10, 0, 0, 0, time.UTC)
+
+	tmpl, err := template.New("index").Parse(defaultElasticsearchIndex)
+	require.NoError(t, err)
+	index, err := renderIndexTemplate(tmpl, ev)
+	require.NoError(t, err)
+	require.Equal(t, "k8s-events-2023.05.12", index)
+
+	// the literals are kept.
+	tmpl, err = template.New("index").Parse(`k8s-events-v2-Mon-{{ .InvolvedObject.ClusterName }}-{{ .Time.Format "2006.01.02" }}`)
+	require.NoError(t, err)
+	index, err = renderIndexTemplate(tmpl, ev)
+	require.NoError(t, err)
+	require.Equal(t, "k8s-events-v2-Mon-test-2023.05.12", index)
+}
+
+func TestElasticsearchBulkPartialFailure(t *testing.T) {
+	calls := 0
+	server := newRecordingServer(func(rw http.ResponseWriter, req *recordedRequest) {
+		calls++
+		first := calls == 1
+		lines := bulkLines(t, req.Body)
+		items := []interface{}{}
+		for i := 0; i < len(lines); i += 2 {
+			status := 201
+			switch {
+			case first && i == 2:
+				// throttled, should be retried
+				status = 429
+			case first && i == 4:
+				// mapping error, should be dropped
+				status = 400
+			}
+			items = append(items, map[string]interface{}{"index": map[string]interface{}{"status": status}})
+		}
+		fmt.Fprint(rw, mustJSON(t, map[string]interface{}{"errors": first, "items": items}))
+	})
+	defer server.Close()
+
+	sink, err := NewElasticsearchSink(map[string]interface{}{
+		"hosts":         []interface{}{server.URL},
+		"index":         `k8s-events-{{ .InvolvedObject.ClusterName }}-{{ .Time.Format "2006.01.02" }}`,
+		"apiKey":        "key",
+		"batchSize":     3,
+		"batchInterval": "10ms",
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		ev := buildTestEvent(fmt.Sprintf("nginx.%d", i), "BackOff", 2)
+		ev.UID = types.UID(fmt.Sprintf("uid-%d", i))
+		require.NoError(t, sink.Send(context.TODO(), ev))
+	}
+	require.Eventually(t, func() bool { return server.count() == 2 }, time.Second*5, time.Millisecond*10)
+	sink.Close()
+
+	requests := [][]map[string]interface{}{}
+	for _, req := range server.requests() {
+		require.Equal(t, "/_bulk", req.URL.Path)
+		require.Equal(t, "ApiKey key", req.Header.Get("Authorization"))
+		requests = append(requests, bulkLines(t, req.Body))
+	}
+	require.Len(t, requests[0], 6)
+	action := requests[0][0]["index"].(map[string]interface{})
+	require.Equal(t, "uid-0-2", action["_id"])
+	require.Equal(t, "k8s-events-test-"+time.Now().UTC().Format("2006.01.02"), action["_index"])
+	// only the throttled document is retried
+	require.Len(t, requests[1], 2)
+	require.Equal(t, "uid-1-2", requests[1][0]["index"].(map[string]interface{})["_id"])
+}
+
+// bulkLines decodes the NDJSON body of bulk request.
+func bulkLines(t *testing.T, body []byte) []map[string]interface{} {
+	lines := []map[string]interface{}{}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(b)
+}
@@ -0,0 +1,604 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Masterminds/sprig"
+	"github.com/champly/eventexporter/pkg/kube"
+	"k8s.io/klog/v2"
+)
+
+const (
+	EmailSinkName = "email"
+
+	emailTLSStartTLS = "starttls"
+	emailTLSImplicit = "implicit"
+	emailTLSNone     = "none"
+
+	defaultEmailTimeout         = time.Second * 30
+	defaultEmailRetry           = 2
+	defaultEmailDigestMaxEvents = 500
+
+	defaultEmailSubject = "[{{ .InvolvedObject.ClusterName }}] {{ .Reason }} {{ .Event.InvolvedObject.Kind }} {{ .Event.InvolvedObject.Namespace }}/{{ .Event.InvolvedObject.Name }}"
+	defaultEmailText    = `Cluster:   {{ .InvolvedObject.ClusterName }}
+Namespace: {{ .Event.InvolvedObject.Namespace }}
+Object:    {{ .Event.InvolvedObject.Kind }}/{{ .Event.InvolvedObject.Name }}
+Type:      {{ .Type }}
+Reason:    {{ .Reason }}
+Count:     {{ .Count }}
+Message:   {{ .Message }}`
+
+	defaultEmailDigestSubject = "[eventexporter] {{ .Count }} events since {{ .Since.Format \"2006-01-02 15:04\" }}"
+	defaultEmailDigestText    = `{{ .Count }} events from {{ .Since.Format "2006-01-02 15:04:05" }} to {{ .Until.Format "2006-01-02 15:04:05" }}
+{{ range .Groups }}
+== {{ .Cluster }}/{{ .Namespace }} ({{ len .Events }}) ==
+{{ range .Events }}- [{{ .Type }}] {{ .Event.InvolvedObject.Kind }}/{{ .Event.InvolvedObject.Name }} {{ .Reason }} x{{ .Count }}: {{ .Message }}
+{{ end }}{{ end }}{{ if .Dropped }}
+{{ .Dropped }} more events are dropped.
+{{ end }}`
+	defaultEmailDigestHTML = `<p>{{ .Count }} events from {{ .Since.Format "2006-01-02 15:04:05" }} to {{ .Until.Format "2006-01-02 15:04:05" }}</p>
+{{ range .Groups }}<h3>{{ .Cluster }}/{{ .Namespace }} ({{ len .Events }})</h3>
+<table border="1" cellspacing="0" cellpadding="4">
+<tr><th>Type</th><th>Object</th><th>Reason</th><th>Count</th><th>Message</th></tr>
+{{ range .Events }}<tr><td>{{ .Type }}</td><td>{{ .Event.InvolvedObject.Kind }}/{{ .Event.InvolvedObject.Name }}</td><td>{{ .Reason }}</td><td>{{ .Count }}</td><td>{{ .Message }}</td></tr>
+{{ end }}</table>
+{{ end }}{{ if .Dropped }}<p>{{ .Dropped }} more events are dropped.</p>{{ end }}`
+)
+
+func init() {
+	factory[EmailSinkName] = NewEmailSink
+}
+
+type emailConfig struct {
+	// Host and Port are the address of smtp server.
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	// TLS is starttls (default), implicit or none.
+	TLS       string     `yaml:"tls"`
+	TLSConfig *tlsConfig `yaml:"tlsConfig"`
+	// Username enables PLAIN auth.
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"passwordFile"`
+	From         string `yaml:"from"`
+	// To are the templates of recipients, every template may render comma separated addresses.
+	To []string `yaml:"to"`
+	// Subject, Text and HTML are the templates of mail, HTML is rendered with html/template.
+	Subject string `yaml:"subject"`
+	Text    string `yaml:"text"`
+	HTML    string `yaml:"html"`
+	// Digest collects events per recipient and sends one summary mail every interval.
+	Digest     *emailDigestConfig `yaml:"digest"`
+	Timeout    time.Duration      `yaml:"timeout"`
+	MaxRetries *int               `yaml:"maxRetries"`
+}
+
+type emailDigestConfig struct {
+	Interval time.Duration `yaml:"interval"`
+	// Subject, Text and HTML are the templates of summary mail with emailDigest.
+	Subject   string `yaml:"subject"`
+	Text      string `yaml:"text"`
+	HTML      string `yaml:"html"`
+	MaxEvents int    `yaml:"maxEvents"`
+}
+
+// emailDigest is the data of summary mail templates.
+type emailDigest struct {
+	Recipient string
+	Since     time.Time
+	Until     time.Time
+	Count     int
+	Dropped   int
+	Groups    []*emailDigestGroup
+}
+
+type emailDigestGroup struct {
+	Cluster   string
+	Namespace string
+	Events    []*kube.EnhancedEvent
+}
+
+type emailMessage struct {
+	to      []*mail.Address
+	subject string
+	text    string
+	html    string
+}
+
+type email struct {
+	*emailConfig
+	from       *mail.Address
+	addr       string
+	tlsConfig  *tls.Config
+	maxRetries int
+
+	digestSubject *template.Template
+	digestText    *template.Template
+	digestHTML    *htmltemplate.Template
+	// pending are the digest events of every recipient.
+	pending      map[string][]*kube.EnhancedEvent
+	dropped      map[string]int
+	pendingSince time.Time
+	sync.Mutex
+	stopCh chan struct{}
+	done   chan struct{}
+}
+
+func NewEmailSink(cfg interface{}) (Sink, error) {
+	emailCfg := &emailConfig{}
+	if err := unmarshalConfig(EmailSinkName, cfg, emailCfg); err != nil {
+		return nil, err
+	}
+	if emailCfg.Host == "" || emailCfg.From == "" || len(emailCfg.To) == 0 {
+		return nil, fmt.Errorf("init receiver %s, host, from and to must be set", EmailSinkName)
+	}
+	from, err := mail.ParseAddress(emailCfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s, invalid from %s: %v", EmailSinkName, emailCfg.From, err)
+	}
+	if emailCfg.TLS == "" {
+		emailCfg.TLS = emailTLSStartTLS
+	}
+	if emailCfg.Port == 0 {
+		emailCfg.Port = 587
+		if emailCfg.TLS == emailTLSImplicit {
+			emailCfg.Port = 465
+		}
+	}
+	if emailCfg.Subject == "" {
+		emailCfg.Subject = defaultEmailSubject
+	}
+	if emailCfg.Text == "" && emailCfg.HTML == "" {
+		emailCfg.Text = defaultEmailText
+	}
+	if emailCfg.Timeout <= 0 {
+		emailCfg.Timeout = defaultEmailTimeout
+	}
+
+	e := &email{
+		emailConfig: emailCfg,
+		from:        from,
+		addr:        net.JoinHostPort(emailCfg.Host, fmt.Sprint(emailCfg.Port)),
+		maxRetries:  defaultEmailRetry,
+	}
+	if emailCfg.MaxRetries != nil {
+		e.maxRetries = *emailCfg.MaxRetries
+	}
+
+	switch emailCfg.TLS {
+	case emailTLSStartTLS, emailTLSImplicit:
+		tlsCfg := &tlsConfig{}
+		if emailCfg.TLSConfig != nil {
+			tlsCfg = emailCfg.TLSConfig
+		}
+		c, err := tlsCfg.build()
+		if err != nil {
+			return nil, fmt.Errorf("init receiver %s tls config failed: %v", EmailSinkName, err)
+		}
+		if c.ServerName == "" {
+			c.ServerName = emailCfg.Host
+		}
+		e.tlsConfig = c
+	case emailTLSNone:
+	default:
+		return nil, fmt.Errorf("init receiver %s, tls %s not supported, must be %s, %s or %s", EmailSinkName, emailCfg.TLS, emailTLSStartTLS, emailTLSImplicit, emailTLSNone)
+	}
+
+	if emailCfg.Digest != nil {
+		if err := e.initDigest(); err != nil {
+			return nil, fmt.Errorf("init receiver %s digest failed: %v", EmailSinkName, err)
+		}
+	}
+	klog.Infof("Email smtp address: %s", e.addr)
+	return e, nil
+}
+
+func (e *email) initDigest() error {
+	d := e.Digest
+	if d.Interval <= 0 {
+		return fmt.Errorf("interval must be set")
+	}
+	if d.Subject == "" {
+		d.Subject = defaultEmailDigestSubject
+	}
+	if d.Text == "" && d.HTML == "" {
+		d.Text, d.HTML = defaultEmailDigestText, defaultEmailDigestHTML
+	}
+	if d.MaxEvents <= 0 {
+		d.MaxEvents = defaultEmailDigestMaxEvents
+	}
+
+	var err error
+	if e.digestSubject, err = template.New("subject").Funcs(sprig.TxtFuncMap()).Parse(d.Subject); err != nil {
+		return err
+	}
+	if e.digestText, err = template.New("text").Funcs(sprig.TxtFuncMap()).Parse(d.Text); err != nil {
+		return err
+	}
+	if e.digestHTML, err = htmltemplate.New("html").Funcs(sprig.HtmlFuncMap()).Parse(d.HTML); err != nil {
+		return err
+	}
+
+	e.pending = map[string][]*kube.EnhancedEvent{}
+	e.dropped = map[string]int{}
+	e.pendingSince = time.Now()
+	e.stopCh = make(chan struct{})
+	e.done = make(chan struct{})
+	go e.digestLoop()
+	return nil
+}
+
+func (e *email) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	to, err := e.recipients(ev)
+	if err != nil {
+		return err
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("no recipient of %s/%s", ev.Namespace, ev.Name)
+	}
+
+	if e.Digest != nil {
+		e.Lock()
+		for _, addr := range to {
+			rcpt := addr.Address
+			if len(e.pending[rcpt]) >= e.Digest.MaxEvents {
+				e.dropped[rcpt]++
+				continue
+			}
+			e.pending[rcpt] = append(e.pending[rcpt], ev)
+		}
+		e.Unlock()
+		return nil
+	}
+
+	msg := &emailMessage{to: to}
+	if msg.subject, err = getLayoutString(ev, e.Subject); err != nil {
+		return fmt.Errorf("render subject failed: %v", err)
+	}
+	if e.Text != "" {
+		if msg.text, err = getLayoutString(ev, e.Text); err != nil {
+			return fmt.Errorf("render text failed: %v", err)
+		}
+	}
+	if e.HTML != "" {
+		if msg.html, err = renderHTMLTemplate(e.HTML, ev); err != nil {
+			return fmt.Errorf("render html failed: %v", err)
+		}
+	}
+	return e.send(ctx, msg)
+}
+
+// Close sends the pending digest.
+func (e *email) Close() {
+	if e.Digest != nil {
+		close(e.stopCh)
+		<-e.done
+	}
+}
+
+// recipients renders the recipients, the invalid addresses are dropped since the templates
+// may render the labels or annotations of involved object.
+func (e *email) recipients(ev *kube.EnhancedEvent) ([]*mail.Address, error) {
+	seen := map[string]bool{}
+	to := []*mail.Address{}
+	for _, text := range e.To {
+		rendered, err := getLayoutString(ev, text)
+		if err != nil {
+			return nil, fmt.Errorf("render recipient %s failed: %v", text, err)
+		}
+		for _, item := range strings.Split(rendered, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			addr, err := mail.ParseAddress(item)
+			if err != nil {
+				klog.Warningf("Receiver %s drop invalid recipient %q of %s/%s: %v", EmailSinkName, item, ev.Namespace, ev.Name, err)
+				continue
+			}
+			if !seen[addr.Address] {
+				seen[addr.Address] = true
+				to = append(to, addr)
+			}
+		}
+	}
+	return to, nil
+}
+
+func (e *email) digestLoop() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.Digest.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stopCh:
+			e.flushDigest()
+			return
+		case <-ticker.C:
+			e.flushDigest()
+		}
+	}
+}
+
+// flushDigest sends one summary mail to every recipient, events are grouped by
+// cluster and namespace.
+func (e *email) flushDigest() {
+	now := time.Now()
+	e.Lock()
+	pending, dropped, since := e.pending, e.dropped, e.pendingSince
+	e.pending = map[string][]*kube.EnhancedEvent{}
+	e.dropped = map[string]int{}
+	e.pendingSince = now
+	e.Unlock()
+
+	for rcpt, events := range pending {
+		digest := buildEmailDigest(rcpt, events, since, now)
+		digest.Dropped = dropped[rcpt]
+
+		msg, err := e.renderDigest(digest)
+		if err != nil {
+			klog.Errorf("Receiver %s render digest of %s failed: %+v", EmailSinkName, rcpt, err)
+			continue
+		}
+		if err = e.send(context.Background(), msg); err != nil {
+			klog.Errorf("Receiver %s send digest of %d events to %s failed: %+v", EmailSinkName, digest.Count, rcpt, err)
+			continue
+		}
+		klog.V(4).Infof("Receiver %s send digest of %d events to %s.", EmailSinkName, digest.Count, rcpt)
+	}
+}
+
+func buildEmailDigest(rcpt string, events []*kube.EnhancedEvent, since, until time.Time) *emailDigest {
+	digest := &emailDigest{Recipient: rcpt, Since: since, Until: until, Count: len(events)}
+	groups := map[string]*emailDigestGroup{}
+	for _, ev := range events {
+		key := ev.InvolvedObject.ClusterName + "/" + ev.Event.InvolvedObject.Namespace
+		group, ok := groups[key]
+		if !ok {
+			group = &emailDigestGroup{Cluster: ev.InvolvedObject.ClusterName, Namespace: ev.Event.InvolvedObject.Namespace}
+			groups[key] = group
+			digest.Groups = append(digest.Groups, group)
+		}
+		group.Events = append(group.Events, ev)
+	}
+	sort.Slice(digest.Groups, func(i, j int) bool {
+		if digest.Groups[i].Cluster != digest.Groups[j].Cluster {
+			return digest.Groups[i].Cluster < digest.Groups[j].Cluster
+		}
+		return digest.Groups[i].Namespace < digest.Groups[j].Namespace
+	})
+	return digest
+}
+
+func (e *email) renderDigest(digest *emailDigest) (*emailMessage, error) {
+	msg := &emailMessage{to: []*mail.Address{{Address: digest.Recipient}}}
+	buf := &bytes.Buffer{}
+	if err := e.digestSubject.Execute(buf, digest); err != nil {
+		return nil, err
+	}
+	msg.subject = buf.String()
+	if e.Digest.Text != "" {
+		buf.Reset()
+		if err := e.digestText.Execute(buf, digest); err != nil {
+			return nil, err
+		}
+		msg.text = buf.String()
+	}
+	if e.Digest.HTML != "" {
+		buf.Reset()
+		if err := e.digestHTML.Execute(buf, digest); err != nil {
+			return nil, err
+		}
+		msg.html = buf.String()
+	}
+	return msg, nil
+}
+
+func (e *email) send(ctx context.Context, msg *emailMessage) error {
+	body, err := e.buildMessage(msg)
+	if err != nil {
+		return err
+	}
+	return sendWithRetry(ctx, e.maxRetries, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+		return e.deliver(ctx, msg.to, body)
+	})
+}
+
+// deliver sends the mail with one smtp session.
+func (e *email) deliver(ctx context.Context, to []*mail.Address, body []byte) error {
+	dialer := &net.Dialer{}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if e.TLS == emailTLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: e.tlsConfig}).DialContext(ctx, "tcp", e.addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", e.addr)
+	}
+	if err != nil {
+		return newNetworkError(err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, e.Host)
+	if err != nil {
+		conn.Close()
+		return classifySMTPError(err)
+	}
+	defer c.Close()
+
+	if e.TLS == emailTLSStartTLS {
+		if err = c.StartTLS(e.tlsConfig); err != nil {
+			return classifySMTPError(err)
+		}
+	}
+	if e.Username != "" {
+		password := e.Password
+		if e.PasswordFile != "" {
+			b, err := os.ReadFile(e.PasswordFile)
+			if err != nil {
+				return fmt.Errorf("read password file %s failed: %v", e.PasswordFile, err)
+			}
+			password = strings.TrimSpace(string(b))
+		}
+		if err = c.Auth(smtp.PlainAuth("", e.Username, password, e.Host)); err != nil {
+			return classifySMTPError(err)
+		}
+	}
+	if err = c.Mail(e.from.Address); err != nil {
+		return classifySMTPError(err)
+	}
+	for _, rcpt := range to {
+		if err = c.Rcpt(rcpt.Address); err != nil {
+			return classifySMTPError(err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return classifySMTPError(err)
+	}
+	if _, err = w.Write(body); err != nil {
+		return newNetworkError(err)
+	}
+	if err = w.Close(); err != nil {
+		return classifySMTPError(err)
+	}
+	return classifySMTPError(c.Quit())
+}
+
+// buildMessage builds the mime message, the text and html are multipart/alternative.
+func (e *email) buildMessage(msg *emailMessage) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	header := textproto.MIMEHeader{}
+	to := make([]string, 0, len(msg.to))
+	for _, addr := range msg.to {
+		to = append(to, addr.String())
+	}
+	header.Set("From", e.from.String())
+	header.Set("To", strings.Join(to, ", "))
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", msg.subject))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("Message-ID", fmt.Sprintf("<%s@%s>", hex.EncodeToString(id), e.Host))
+	header.Set("MIME-Version", "1.0")
+
+	writePart := func(w *bytes.Buffer, content string) error {
+		qw := quotedprintable.NewWriter(w)
+		if _, err := qw.Write([]byte(content)); err != nil {
+			return err
+		}
+		return qw.Close()
+	}
+
+	if msg.text == "" || msg.html == "" {
+		contentType, content := "text/plain; charset=utf-8", msg.text
+		if msg.html != "" {
+			contentType, content = "text/html; charset=utf-8", msg.html
+		}
+		header.Set("Content-Type", contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		writeMIMEHeader(buf, header)
+		if err := writePart(buf, content); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	header.Set("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	writeMIMEHeader(buf, header)
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", msg.text},
+		{"text/html; charset=utf-8", msg.html},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		partBuf := &bytes.Buffer{}
+		if err = writePart(partBuf, part.content); err != nil {
+			return nil, err
+		}
+		pw.Write(partBuf.Bytes())
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
+
+func writeMIMEHeader(buf *bytes.Buffer, header textproto.MIMEHeader) {
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(buf, "%s: %s\r\n", k, header.Get(k))
+	}
+	buf.WriteString("\r\n")
+}
+
+// renderHTMLTemplate renders the event with html/template which escapes the values.
+func renderHTMLTemplate(text string, ev *kube.EnhancedEvent) (string, error) {
+	tmpl, err := htmltemplate.New("html").Funcs(sprig.HtmlFuncMap()).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	if err = tmpl.Execute(buf, ev); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// classifySMTPError treats 4xx replies as retryable and 5xx replies as rejected.
+func classifySMTPError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if tpErr, ok := err.(*textproto.Error); ok {
+		if tpErr.Code >= 400 && tpErr.Code < 500 {
+			return newStatusError(http.StatusServiceUnavailable, err)
+		}
+		return newStatusError(http.StatusBadRequest, err)
+	}
+	return newNetworkError(err)
+}
@@ -0,0 +1,272 @@
+package sinks
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSMTPMail struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTPServer accepts the mails without tls.
+type fakeSMTPServer struct {
+	net.Listener
+	sync.Mutex
+	mails []*fakeSMTPMail
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeSMTPServer{Listener: lis}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	m := &fakeSMTPMail{}
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO":
+			reply("250-fake")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			m.auth = line
+			reply("235 ok")
+		case "MAIL":
+			m.from = line
+			reply("250 ok")
+		case "RCPT":
+			m.to = append(m.to, line)
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			data := &strings.Builder{}
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			m.data = data.String()
+			s.Lock()
+			s.mails = append(s.mails, m)
+			s.Unlock()
+			m = &fakeSMTPMail{}
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) received() []*fakeSMTPMail {
+	s.Lock()
+	defer s.Unlock()
+	return append([]*fakeSMTPMail{}, s.mails...)
+}
+
+func (s *fakeSMTPServer) hostPort() (string, int) {
+	addr := s.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+// readMailParts returns the subject and the decoded parts keyed by media type.
+func readMailParts(t *testing.T, data string) (string, map[string]string) {
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	require.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+
+	parts := map[string]string{}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		b, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+		require.NoError(t, err)
+		// the line ending before the terminator of DATA.
+		parts[mediaType] = strings.TrimSuffix(string(b), "\r\n")
+		return subject, parts
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		partType, _, err := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		// multipart.Reader decodes quoted-printable parts.
+		b, err := io.ReadAll(p)
+		require.NoError(t, err)
+		parts[partType] = string(b)
+	}
+	return subject, parts
+}
+
+func TestEmailSend(t *testing.T) {
+	srv := newFakeSMTPServer(t)
+	defer srv.Close()
+	host, port := srv.hostPort()
+
+	sink, err := NewEmailSink(map[string]interface{}{
+		"host":     host,
+		"port":     port,
+		"tls":      "none",
+		"username": "user",
+		"password": "pass",
+		"from":     "eventexporter@example.com",
+		"to":       []interface{}{"ops@example.com", "{{ .InvolvedObject.Labels.owner }}, ops@example.com"},
+		"html":     "<b>{{ .Message }}</b>",
+		"text":     "{{ .Message }}",
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	ev := buildTestEvent("nginx.backoff", "BackOff", 2)
+	ev.Message = "Back-off <restarting>"
+	ev.InvolvedObject.Labels = map[string]string{"owner": "dev@example.com"}
+	require.NoError(t, sink.Send(context.TODO(), ev))
+
+	mails := srv.received()
+	require.Len(t, mails, 1)
+	require.True(t, strings.HasPrefix(mails[0].auth, "AUTH PLAIN "), mails[0].auth)
+	require.True(t, strings.HasPrefix(mails[0].from, "MAIL FROM:<eventexporter@example.com>"), mails[0].from)
+	require.Equal(t, []string{"RCPT TO:<ops@example.com>", "RCPT TO:<dev@example.com>"}, mails[0].to)
+
+	subject, parts := readMailParts(t, mails[0].data)
+	require.Equal(t, "[test] BackOff Pod default/nginx", subject)
+	require.Equal(t, "Back-off <restarting>", parts["text/plain"])
+	require.Equal(t, "<b>Back-off &lt;restarting&gt;</b>", parts["text/html"])
+}
+
+func TestEmailInvalidRecipients(t *testing.T) {
+	srv := newFakeSMTPServer(t)
+	defer srv.Close()
+	host, port := srv.hostPort()
+
+	_, err := NewEmailSink(map[string]interface{}{
+		"host": host,
+		"from": "eventexporter",
+		"to":   []interface{}{"ops@example.com"},
+	})
+	require.Error(t, err)
+
+	sink, err := NewEmailSink(map[string]interface{}{
+		"host": host,
+		"port": port,
+		"tls":  "none",
+		"from": "Event Exporter <eventexporter@example.com>",
+		"to":   []interface{}{"{{ .InvolvedObject.Labels.owner }}", "{{ .InvolvedObject.Annotations.owner }}"},
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	ev := buildTestEvent("nginx.backoff", "BackOff", 2)
+	ev.InvolvedObject.Labels = map[string]string{"owner": "dev@example.com\r\nBcc: evil@example.com"}
+	ev.InvolvedObject.Annotations = map[string]string{"owner": "Dev <dev@example.com>, not-an-address"}
+	require.NoError(t, sink.Send(context.TODO(), ev))
+
+	mails := srv.received()
+	require.Len(t, mails, 1)
+	require.Equal(t, []string{"RCPT TO:<dev@example.com>"}, mails[0].to)
+	msg, err := mail.ReadMessage(strings.NewReader(mails[0].data))
+	require.NoError(t, err)
+	require.Equal(t, `"Dev" <dev@example.com>`, msg.Header.Get("To"))
+	require.Equal(t, `"Event Exporter" <eventexporter@example.com>`, msg.Header.Get("From"))
+	require.Empty(t, msg.Header.Get("Bcc"))
+}
+
+func TestEmailDigest(t *testing.T) {
+	srv := newFakeSMTPServer(t)
+	defer srv.Close()
+	host, port := srv.hostPort()
+
+	sink, err := NewEmailSink(map[string]interface{}{
+		"host": host,
+		"port": port,
+		"tls":  "none",
+		"from": "eventexporter@example.com",
+		"to":   []interface{}{"ops@example.com"},
+		"digest": map[string]interface{}{
+			"interval":  "1h",
+			"text":      "{{ range .Groups }}{{ .Cluster }}/{{ .Namespace }}:{{ range .Events }} {{ .Reason }}{{ end }};{{ end }} dropped {{ .Dropped }}",
+			"maxEvents": 3,
+		},
+	})
+	require.NoError(t, err)
+
+	for _, item := range []struct {
+		cluster   string
+		namespace string
+		reason    string
+	}{
+		{"b", "default", "BackOff"},
+		{"a", "kube-system", "Failed"},
+		{"a", "default", "Unhealthy"},
+		{"a", "default", "Dropped"},
+	} {
+		ev := buildTestEvent("nginx."+item.reason, item.reason, 1)
+		ev.InvolvedObject.ClusterName = item.cluster
+		ev.Event.InvolvedObject.Namespace = item.namespace
+		require.NoError(t, sink.Send(context.TODO(), ev))
+	}
+	require.Empty(t, srv.received())
+
+	// the pending digest is sent on close.
+	sink.Close()
+	mails := srv.received()
+	require.Len(t, mails, 1)
+	subject, parts := readMailParts(t, mails[0].data)
+	require.True(t, strings.HasPrefix(subject, "[eventexporter] 3 events since "), subject)
+	require.Equal(t, "a/default: Unhealthy;a/kube-system: Failed;b/default: BackOff; dropped 1", parts["text/plain"])
+}
+
+func TestClassifySMTPError(t *testing.T) {
+	require.True(t, IsRetryable(classifySMTPError(&textproto.Error{Code: 421, Msg: "try again later"})))
+	require.False(t, IsRetryable(classifySMTPError(&textproto.Error{Code: 550, Msg: "mailbox unavailable"})))
+	require.True(t, IsRetryable(classifySMTPError(io.ErrUnexpectedEOF)))
+}
@@ -0,0 +1,100 @@
+package sinks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// ErrorKind classifies send failures, sinks use it to decide whether to retry.
+type ErrorKind string
+
+const (
+	// ErrorKindClient is a 4xx response, the request is rejected and retry won't help.
+	ErrorKindClient ErrorKind = "client"
+	// ErrorKindServer is a 5xx response.
+	ErrorKindServer ErrorKind = "server"
+	// ErrorKindNetwork is a connection failure or timeout.
+	ErrorKindNetwork ErrorKind = "network"
+)
+
+const (
+	defaultRetryBackoff    = time.Millisecond * 500
+	defaultRetryMaxBackoff = time.Second * 10
+)
+
+// SendError is the classified error returned by sinks.
+type SendError struct {
+	Kind       ErrorKind
+	StatusCode int
+	Err        error
+}
+
+func (e *SendError) Error() string {
+	if e.StatusCode > 0 {
+		return fmt.Sprintf("%s error (status %d): %v", e.Kind, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("%s error: %v", e.Kind, e.Err)
+}
+
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the same request may succeed later. Client errors are
+// not retryable except request timeout and too many requests.
+func (e *SendError) Retryable() bool {
+	if e.Kind != ErrorKindClient {
+		return true
+	}
+	return e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests
+}
+
+// IsRetryable reports whether err is a retryable SendError.
+func IsRetryable(err error) bool {
+	var se *SendError
+	if errors.As(err, &se) {
+		return se.Retryable()
+	}
+	return false
+}
+
+// newStatusError classifies a non 2xx http response.
+func newStatusError(code int, err error) *SendError {
+	kind := ErrorKindServer
+	if code >= 400 && code < 500 {
+		kind = ErrorKindClient
+	}
+	return &SendError{Kind: kind, StatusCode: code, Err: err}
+}
+
+func newNetworkError(err error) *SendError {
+	return &SendError{Kind: ErrorKindNetwork, Err: err}
+}
+
+// sendWithRetry invokes send until it succeeds, returns a non retryable error,
+// retries are used up or ctx is done. The backoff doubles after every failure.
+func sendWithRetry(ctx context.Context, maxRetries int, send func(ctx context.Context) error) error {
+	backoff := defaultRetryBackoff
+	for i := 0; ; i++ {
+		err := send(ctx)
+		if err == nil || !IsRetryable(err) || i >= maxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		klog.V(4).Infof("Send failed, retry %d/%d after %s: %v", i+1, maxRetries, backoff, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > defaultRetryMaxBackoff {
+			backoff = defaultRetryMaxBackoff
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/champly/eventexporter/pkg/kube"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ExecSinkName = "exec"
+
+	defaultExecConcurrency    = 4
+	defaultExecQueueSize      = 100
+	defaultExecTimeout        = time.Second * 30
+	defaultExecMaxOutputBytes = 64 * 1024
+	// execWaitDelay is the max time waiting for the output pipes after the command
+	// is killed, the children of command may keep them open.
+	execWaitDelay = time.Second * 5
+
+	execResultSuccess = "success"
+	execResultFailure = "failure"
+	execResultTimeout = "timeout"
+	execResultError   = "error"
+)
+
+var (
+	execRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "eventexporter_exec_runs_total",
+		Help: "Runs of exec sink by command and result.",
+	}, []string{"command", "result"})
+	execDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "eventexporter_exec_duration_seconds",
+		Help: "Duration of exec sink runs by command.",
+	}, []string{"command"})
+	execOutputBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "eventexporter_exec_output_bytes_total",
+		Help: "Output bytes of exec sink runs by command and stream.",
+	}, []string{"command", "stream"})
+)
+
+func init() {
+	factory[ExecSinkName] = NewExecSink
+	prometheus.MustRegister(execRuns, execDuration, execOutputBytes)
+}
+
+type execConfig struct {
+	// Command is the path of executable, it's looked up in PATH when it has no slash.
+	Command string `yaml:"command"`
+	// Args and Env are templates, Env is added to PATH of exporter, the whole environment
+	// of exporter is inherited when InheritEnv is set.
+	Args       []string          `yaml:"args"`
+	Env        map[string]string `yaml:"env"`
+	InheritEnv bool              `yaml:"inheritEnv"`
+	Dir        string            `yaml:"dir"`
+	// Layout is the JSON layout of stdin, the whole event is written when it's empty.
+	Layout map[string]interface{} `yaml:"layout"`
+	// Concurrency is the max running commands, QueueSize is the max events waiting to run.
+	Concurrency int           `yaml:"concurrency"`
+	QueueSize   int           `yaml:"queueSize"`
+	Timeout     time.Duration `yaml:"timeout"`
+	// MaxOutputBytes is the max logged bytes of stdout and stderr respectively.
+	MaxOutputBytes int `yaml:"maxOutputBytes"`
+}
+
+type execRun struct {
+	args  []string
+	env   []string
+	stdin []byte
+	event string
+}
+
+type execSink struct {
+	*execConfig
+	path     string
+	name     string
+	queue    chan *execRun
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func NewExecSink(cfg interface{}) (Sink, error) {
+	execCfg := &execConfig{}
+	if err := unmarshalConfig(ExecSinkName, cfg, execCfg); err != nil {
+		return nil, err
+	}
+	if execCfg.Command == "" {
+		return nil, fmt.Errorf("init receiver %s, command must be set", ExecSinkName)
+	}
+	path, err := exec.LookPath(execCfg.Command)
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s, look up command %s failed: %v", ExecSinkName, execCfg.Command, err)
+	}
+	if execCfg.Concurrency <= 0 {
+		execCfg.Concurrency = defaultExecConcurrency
+	}
+	if execCfg.QueueSize <= 0 {
+		execCfg.QueueSize = defaultExecQueueSize
+	}
+	if execCfg.Timeout <= 0 {
+		execCfg.Timeout = defaultExecTimeout
+	}
+	if execCfg.MaxOutputBytes <= 0 {
+		execCfg.MaxOutputBytes = defaultExecMaxOutputBytes
+	}
+
+	e := &execSink{
+		execConfig: execCfg,
+		path:       path,
+		name:       filepath.Base(path),
+		queue:      make(chan *execRun, execCfg.QueueSize),
+		stopCh:     make(chan struct{}),
+	}
+	for i := 0; i < execCfg.Concurrency; i++ {
+		e.wg.Add(1)
+		go e.worker()
+	}
+	klog.Infof("Exec command: %s, concurrency: %d, timeout: %s", path, execCfg.Concurrency, execCfg.Timeout)
+	return e, nil
+}
+
+// Send queues the run of command without blocking, it fails when the queue is full.
+func (e *execSink) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	run, err := e.buildRun(ev)
+	if err != nil {
+		return err
+	}
+	select {
+	case e.queue <- run:
+		return nil
+	default:
+		return fmt.Errorf("exec queue is full, drop event %s", run.event)
+	}
+}
+
+// Close runs the queued events and waits for the running commands.
+func (e *execSink) Close() {
+	e.stopOnce.Do(func() {
+		close(e.stopCh)
+	})
+	e.wg.Wait()
+}
+
+func (e *execSink) buildRun(ev *kube.EnhancedEvent) (*execRun, error) {
+	stdin, err := serializeEventWithLayout(e.Layout, ev)
+	if err != nil {
+		return nil, err
+	}
+	run := &execRun{
+		args:  make([]string, 0, len(e.Args)),
+		stdin: append(stdin, '\n'),
+		event: ev.Namespace + "/" + ev.Name,
+	}
+	for i, arg := range e.Args {
+		v, err := getLayoutString(ev, arg)
+		if err != nil {
+			return nil, fmt.Errorf("render arg %d failed: %v", i, err)
+		}
+		run.args = append(run.args, v)
+	}
+
+	if e.InheritEnv {
+		run.env = os.Environ()
+	} else if path, ok := os.LookupEnv("PATH"); ok {
+		run.env = []string{"PATH=" + path}
+	}
+	for _, k := range sortedKeys(e.Env) {
+		v, err := getLayoutString(ev, e.Env[k])
+		if err != nil {
+			return nil, fmt.Errorf("render env %s failed: %v", k, err)
+		}
+		run.env = append(run.env, k+"="+v)
+	}
+	return run, nil
+}
+
+func (e *execSink) worker() {
+	defer e.wg.Done()
+	for {
+		select {
+		case run := <-e.queue:
+			e.run(run)
+		case <-e.stopCh:
+			// run the queued events before exit.
+			for {
+				select {
+				case run := <-e.queue:
+					e.run(run)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *execSink) run(run *execRun) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.Timeout)
+	defer cancel()
+
+	stdout := &limitedBuffer{max: e.MaxOutputBytes}
+	stderr := &limitedBuffer{max: e.MaxOutputBytes}
+	cmd := exec.CommandContext(ctx, e.path, run.args...)
+	cmd.Env = run.env
+	cmd.Dir = e.Dir
+	cmd.Stdin = bytes.NewReader(run.stdin)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = execWaitDelay
+	setProcessGroup(cmd)
+
+	start := time.Now()
+	err := cmd.Run()
+	execDuration.WithLabelValues(e.name).Observe(time.Since(start).Seconds())
+	execOutputBytes.WithLabelValues(e.name, "stdout").Add(float64(stdout.total))
+	execOutputBytes.WithLabelValues(e.name, "stderr").Add(float64(stderr.total))
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		execRuns.WithLabelValues(e.name, execResultSuccess).Inc()
+		klog.V(4).Infof("Receiver %s run %s for event %s success, stdout: %s, stderr: %s", ExecSinkName, e.name, run.event, stdout, stderr)
+	case ctx.Err() == context.DeadlineExceeded:
+		execRuns.WithLabelValues(e.name, execResultTimeout).Inc()
+		klog.Errorf("Receiver %s run %s for event %s timeout after %s, stdout: %s, stderr: %s", ExecSinkName, e.name, run.event, e.Timeout, stdout, stderr)
+	case errors.As(err, &exitErr):
+		execRuns.WithLabelValues(e.name, execResultFailure).Inc()
+		klog.Errorf("Receiver %s run %s for event %s failed with exit code %d, stdout: %s, stderr: %s", ExecSinkName, e.name, run.event, exitErr.ExitCode(), stdout, stderr)
+	default:
+		execRuns.WithLabelValues(e.name, execResultError).Inc()
+		klog.Errorf("Receiver %s run %s for event %s failed: %+v", ExecSinkName, e.name, run.event, err)
+	}
+}
+
+// limitedBuffer keeps the first max bytes of output and counts all the bytes.
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	max   int
+	total int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.total += len(p)
+	if remain := b.max - b.buf.Len(); remain > 0 {
+		if len(p) > remain {
+			b.buf.Write(p[:remain])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	s := strings.TrimSpace(b.buf.String())
+	if b.total > b.buf.Len() {
+		s += fmt.Sprintf("...(%d bytes truncated)", b.total-b.buf.Len())
+	}
+	return fmt.Sprintf("%q", s)
+}
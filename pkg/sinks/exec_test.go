@@ -0,0 +1,75 @@
+package sinks
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecSend(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewExecSink(map[string]interface{}{
+		"command": "sh",
+		"args":    []string{"-c", `cat > "$OUT/$1.json"; echo "$NODE"; echo warn >&2`, "sh", "{{ .Reason }}"},
+		"env": map[string]string{
+			"OUT":  dir,
+			"NODE": "{{ .InvolvedObject.ClusterName }}",
+		},
+		"layout": map[string]interface{}{"reason": "{{ .Reason }}"},
+	})
+	require.NoError(t, err)
+
+	success := testutil.ToFloat64(execRuns.WithLabelValues("sh", execResultSuccess))
+	stdout := testutil.ToFloat64(execOutputBytes.WithLabelValues("sh", "stdout"))
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)))
+	sink.Close()
+
+	b, err := os.ReadFile(filepath.Join(dir, "BackOff.json"))
+	require.NoError(t, err)
+	require.Equal(t, "{\"reason\":\"BackOff\"}\n", string(b))
+	require.Equal(t, success+1, testutil.ToFloat64(execRuns.WithLabelValues("sh", execResultSuccess)))
+	require.Equal(t, stdout+float64(len("test\n")), testutil.ToFloat64(execOutputBytes.WithLabelValues("sh", "stdout")))
+}
+
+func TestExecConcurrencyAndTimeout(t *testing.T) {
+	sink, err := NewExecSink(map[string]interface{}{
+		"command":     "sh",
+		"args":        []string{"-c", "sleep {{ .Count }}; exit 3"},
+		"concurrency": 2,
+		"timeout":     "500ms",
+	})
+	require.NoError(t, err)
+
+	failure := testutil.ToFloat64(execRuns.WithLabelValues("sh", execResultFailure))
+	timeout := testutil.ToFloat64(execRuns.WithLabelValues("sh", execResultTimeout))
+	// the events are sent without waiting for the commands.
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 0)))
+	}
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 10)))
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 10)))
+	require.Less(t, time.Since(start), time.Millisecond*100)
+	sink.Close()
+
+	// two sleeping commands run at the same time and are killed by timeout.
+	require.Less(t, time.Since(start), time.Second*3)
+	require.Equal(t, failure+4, testutil.ToFloat64(execRuns.WithLabelValues("sh", execResultFailure)))
+	require.Equal(t, timeout+2, testutil.ToFloat64(execRuns.WithLabelValues("sh", execResultTimeout)))
+
+	_, err = NewExecSink(map[string]interface{}{"command": "eventexporter-not-exist"})
+	require.Error(t, err)
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	b := &limitedBuffer{max: 4}
+	_, _ = b.Write([]byte("ab"))
+	_, _ = b.Write([]byte("cdef"))
+	require.Equal(t, 6, b.total)
+	require.Equal(t, `"abcd...(2 bytes truncated)"`, b.String())
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package sinks
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup runs the command in a new process group, so the children of command
+// are also killed by timeout.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package sinks
+
+import "os/exec"
+
+// setProcessGroup is a no-op, only the command is killed by timeout.
+func setProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,350 @@
+package sinks
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/champly/eventexporter/pkg/kube"
+	"k8s.io/klog/v2"
+)
+
+const (
+	FileSinkName   = "file"
+	StdoutSinkName = "stdout"
+
+	rotatedFileTimeLayout = "2006-01-02T15-04-05.000"
+	compressedFileSuffix  = ".gz"
+	// rotatedQueueCapacity is the max rotated files waiting for compression and cleanup,
+	// the writes wait when it's full.
+	rotatedQueueCapacity = 16
+)
+
+func init() {
+	factory[FileSinkName] = NewFileSink
+	factory[StdoutSinkName] = NewStdoutSink
+}
+
+// lineConfig renders every event to one line.
+type lineConfig struct {
+	// LineTemplate is the template of line, Layout is used when it's empty.
+	LineTemplate string `yaml:"lineTemplate"`
+	// Layout is the JSON layout of line, the whole event is used when it's empty.
+	Layout map[string]interface{} `yaml:"layout"`
+}
+
+func (c *lineConfig) renderLine(ev *kube.EnhancedEvent) ([]byte, error) {
+	var (
+		line []byte
+		err  error
+	)
+	if c.LineTemplate != "" {
+		var s string
+		s, err = getLayoutString(ev, c.LineTemplate)
+		line = []byte(s)
+	} else {
+		line, err = serializeEventWithLayout(c.Layout, ev)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// keep one event per line.
+	line = []byte(strings.ReplaceAll(string(line), "\n", " "))
+	return append(line, '\n'), nil
+}
+
+type fileConfig struct {
+	lineConfig `yaml:",inline"`
+	Path       string `yaml:"path"`
+	// MaxSizeMB rotates the file when it's larger than MaxSizeMB megabytes.
+	MaxSizeMB int `yaml:"maxSizeMB"`
+	// RotateInterval rotates the file every interval, e.g. 1h or 24h.
+	RotateInterval time.Duration `yaml:"rotateInterval"`
+	// MaxBackups is the max rotated files to keep, 0 keeps all.
+	MaxBackups int `yaml:"maxBackups"`
+	// MaxAge removes the rotated files older than it, 0 keeps all.
+	MaxAge time.Duration `yaml:"maxAge"`
+	// Compress gzips the rotated files.
+	Compress bool `yaml:"compress"`
+}
+
+type lineWriter struct {
+	lineConfig
+	name string
+	w    io.WriteCloser
+	sync.Mutex
+}
+
+func NewFileSink(cfg interface{}) (Sink, error) {
+	fileCfg := &fileConfig{}
+	if err := unmarshalConfig(FileSinkName, cfg, fileCfg); err != nil {
+		return nil, err
+	}
+	if fileCfg.Path == "" {
+		return nil, fmt.Errorf("init receiver %s, path must be set", FileSinkName)
+	}
+
+	w, err := newRotateFile(fileCfg)
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s failed: %v", FileSinkName, err)
+	}
+	klog.Infof("File sink path: %s", fileCfg.Path)
+	return &lineWriter{lineConfig: fileCfg.lineConfig, name: FileSinkName, w: w}, nil
+}
+
+func NewStdoutSink(cfg interface{}) (Sink, error) {
+	lineCfg := &lineConfig{}
+	if err := unmarshalConfig(StdoutSinkName, cfg, lineCfg); err != nil {
+		return nil, err
+	}
+	return &lineWriter{lineConfig: *lineCfg, name: StdoutSinkName, w: nopCloser{os.Stdout}}, nil
+}
+
+func (lw *lineWriter) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	line, err := lw.renderLine(ev)
+	if err != nil {
+		return err
+	}
+
+	lw.Lock()
+	defer lw.Unlock()
+	_, err = lw.w.Write(line)
+	return err
+}
+
+func (lw *lineWriter) Close() {
+	lw.Lock()
+	defer lw.Unlock()
+	if err := lw.w.Close(); err != nil {
+		klog.Errorf("Receiver %s close failed: %+v", lw.name, err)
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// rotateFile is a file writer which rotates by size and time, the rotated files are
+// renamed with the rotate time as suffix.
+type rotateFile struct {
+	*fileConfig
+	file     *os.File
+	size     int64
+	maxSize  int64
+	openedAt time.Time
+	// lastRotated is the suffix time of the last rotated file, the suffixes are unique.
+	lastRotated time.Time
+	// rotated queues the rotated files, they're compressed and cleaned up one by one.
+	rotated chan string
+	done    chan struct{}
+	sync.Mutex
+}
+
+func newRotateFile(cfg *fileConfig) (*rotateFile, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0755); err != nil {
+		return nil, err
+	}
+	rf := &rotateFile{
+		fileConfig: cfg,
+		maxSize:    int64(cfg.MaxSizeMB) * 1024 * 1024,
+		rotated:    make(chan string, rotatedQueueCapacity),
+		done:       make(chan struct{}),
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	go rf.postRotateLoop()
+	return rf, nil
+}
+
+func (rf *rotateFile) open() error {
+	f, err := os.OpenFile(rf.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.file = f
+	rf.size = info.Size()
+	rf.openedAt = time.Now()
+	return nil
+}
+
+func (rf *rotateFile) Write(p []byte) (int, error) {
+	rf.Lock()
+	defer rf.Unlock()
+
+	if rf.shouldRotate(len(p)) {
+		if err := rf.rotate(); err != nil {
+			return 0, fmt.Errorf("rotate %s failed: %v", rf.Path, err)
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *rotateFile) shouldRotate(n int) bool {
+	if rf.size == 0 {
+		return false
+	}
+	if rf.maxSize > 0 && rf.size+int64(n) > rf.maxSize {
+		return true
+	}
+	// align to interval, e.g. rotate hourly on the hour.
+	if rf.RotateInterval > 0 && !time.Now().Truncate(rf.RotateInterval).Equal(rf.openedAt.Truncate(rf.RotateInterval)) {
+		return true
+	}
+	return false
+}
+
+func (rf *rotateFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+	rotated := rf.rotatedName(time.Now())
+	if err := os.Rename(rf.Path, rotated); err != nil {
+		return err
+	}
+	if err := rf.open(); err != nil {
+		return err
+	}
+	rf.rotated <- rotated
+	return nil
+}
+
+// rotatedName returns the unique name of rotated file, the suffix time is moved forward
+// by millisecond when it's taken.
+func (rf *rotateFile) rotatedName(now time.Time) string {
+	ts := now.Truncate(time.Millisecond)
+	if !ts.After(rf.lastRotated) {
+		ts = rf.lastRotated.Add(time.Millisecond)
+	}
+	for {
+		name := rf.Path + "." + ts.Format(rotatedFileTimeLayout)
+		if !fileExists(name) && !fileExists(name+compressedFileSuffix) {
+			rf.lastRotated = ts
+			return name
+		}
+		ts = ts.Add(time.Millisecond)
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// postRotateLoop compresses the rotated files and cleans up the backups serially, so the
+// cleanup never races with the compression.
+func (rf *rotateFile) postRotateLoop() {
+	defer close(rf.done)
+	for rotated := range rf.rotated {
+		if rf.Compress {
+			if err := compressFile(rotated); err != nil {
+				klog.Errorf("Compress rotated file %s failed: %+v", rotated, err)
+			}
+		}
+		rf.cleanup()
+	}
+}
+
+// cleanup removes the rotated files beyond MaxBackups or older than MaxAge.
+func (rf *rotateFile) cleanup() {
+	if rf.MaxBackups <= 0 && rf.MaxAge <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(rf.Path + ".*")
+	if err != nil {
+		klog.Errorf("List rotated files of %s failed: %+v", rf.Path, err)
+		return
+	}
+
+	// a backup has both the rotated file and its compression when the compression is
+	// interrupted, they're counted once.
+	type backup struct {
+		paths []string
+		ts    time.Time
+	}
+	bySuffix := map[string]*backup{}
+	for _, m := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(m, rf.Path+"."), compressedFileSuffix)
+		ts, err := time.ParseInLocation(rotatedFileTimeLayout, suffix, time.Local)
+		if err != nil {
+			// not a rotated file, or the temp file of compression.
+			continue
+		}
+		if b, ok := bySuffix[suffix]; ok {
+			b.paths = append(b.paths, m)
+			continue
+		}
+		bySuffix[suffix] = &backup{paths: []string{m}, ts: ts}
+	}
+	backups := make([]*backup, 0, len(bySuffix))
+	for _, b := range bySuffix {
+		backups = append(backups, b)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].ts.After(backups[j].ts) })
+
+	for i, b := range backups {
+		if (rf.MaxBackups > 0 && i >= rf.MaxBackups) || (rf.MaxAge > 0 && time.Since(b.ts) > rf.MaxAge) {
+			for _, path := range b.paths {
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					klog.Errorf("Remove rotated file %s failed: %+v", path, err)
+				}
+			}
+		}
+	}
+}
+
+func (rf *rotateFile) Close() error {
+	rf.Lock()
+	err := rf.file.Close()
+	close(rf.rotated)
+	rf.Unlock()
+	<-rf.done
+	return err
+}
+
+// compressFile gzips the file to file.gz and removes it.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + compressedFileSuffix + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gw := gzip.NewWriter(dst)
+	if _, err = io.Copy(gw, src); err == nil {
+		err = gw.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err = os.Rename(tmp, path+compressedFileSuffix); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
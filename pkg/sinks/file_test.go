@@ -0,0 +1,119 @@
+package sinks
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSinkLayout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	sink, err := NewFileSink(map[string]interface{}{
+		"path": path,
+		"layout": map[string]interface{}{
+			"cluster": "{{ .InvolvedObject.ClusterName }}",
+			"reason":  "{{ .Reason }}",
+		},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)))
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.started", "Started", 1)))
+	sink.Close()
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	require.Len(t, lines, 2)
+	line := map[string]string{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &line))
+	require.Equal(t, map[string]string{"cluster": "test", "reason": "Started"}, line)
+}
+
+func TestFileSinkRotate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.log")
+	cfg := &fileConfig{
+		lineConfig: lineConfig{LineTemplate: "{{ .Reason }}\n{{ .Count }}"},
+		Path:       path,
+		MaxBackups: 2,
+		Compress:   true,
+	}
+	rf, err := newRotateFile(cfg)
+	require.NoError(t, err)
+	// rotate on every line
+	rf.maxSize = 1
+	sink := &lineWriter{lineConfig: cfg.lineConfig, name: FileSinkName, w: rf}
+
+	for i := int32(1); i <= 4; i++ {
+		require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", i)))
+	}
+	sink.Close()
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "BackOff 4\n", string(b))
+
+	backups, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	for _, backup := range backups {
+		require.True(t, strings.HasSuffix(backup, compressedFileSuffix))
+	}
+
+	// the newest backup is the third line
+	f, err := os.Open(backups[1])
+	require.NoError(t, err)
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	b, err = io.ReadAll(gr)
+	require.NoError(t, err)
+	require.Equal(t, "BackOff 3\n", string(b))
+}
+
+func TestRotatedName(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	rf := &rotateFile{fileConfig: &fileConfig{Path: path}}
+	now := time.Date(2023, 5, 12, 10, 0, 0, 0, time.Local)
+
+	// the rotations in the same millisecond get unique names.
+	first := rf.rotatedName(now)
+	require.Equal(t, path+".2023-05-12T10-00-00.000", first)
+	require.Equal(t, path+".2023-05-12T10-00-00.001", rf.rotatedName(now))
+
+	// the existing backups are not overwritten after restarted.
+	require.NoError(t, os.WriteFile(path+".2023-05-12T10-00-01.000"+compressedFileSuffix, nil, 0644))
+	rf = &rotateFile{fileConfig: &fileConfig{Path: path}}
+	require.Equal(t, path+".2023-05-12T10-00-01.001", rf.rotatedName(now.Add(time.Second)))
+}
+
+func TestRotateFileCleanup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	for _, name := range []string{
+		// the interrupted compression is one backup.
+		"2023-05-12T10-00-03.000", "2023-05-12T10-00-03.000" + compressedFileSuffix,
+		"2023-05-12T10-00-02.000" + compressedFileSuffix,
+		"2023-05-12T10-00-01.000" + compressedFileSuffix,
+	} {
+		require.NoError(t, os.WriteFile(path+"."+name, nil, 0644))
+	}
+	rf := &rotateFile{fileConfig: &fileConfig{Path: path, MaxBackups: 2}}
+	rf.cleanup()
+
+	backups, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		path + ".2023-05-12T10-00-02.000" + compressedFileSuffix,
+		path + ".2023-05-12T10-00-03.000",
+		path + ".2023-05-12T10-00-03.000" + compressedFileSuffix,
+	}, backups)
+}
@@ -0,0 +1,155 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/champly/eventexporter/pkg/kube"
+	"github.com/vmihailenco/msgpack/v5"
+	"k8s.io/klog/v2"
+)
+
+const (
+	FluentForwardSinkName = "fluentforward"
+
+	defaultFluentForwardTag = "kubernetes.events.{{ .InvolvedObject.ClusterName }}"
+	// https://github.com/fluent/fluentd/wiki/Forward-Protocol-Specification-v1#eventtime-ext-format
+	fluentEventTimeExtType = 0
+)
+
+func init() {
+	factory[FluentForwardSinkName] = NewFluentForwardSink
+	msgpack.RegisterExt(fluentEventTimeExtType, (*fluentEventTime)(nil))
+}
+
+type fluentForwardConfig struct {
+	netConfig `yaml:",inline"`
+	// Tag is the template of tag.
+	Tag string `yaml:"tag"`
+	// Layout is the layout of record, the whole event is sent when it's empty.
+	Layout map[string]interface{} `yaml:"layout"`
+}
+
+type fluentForward struct {
+	*fluentForwardConfig
+	pool *connPool
+}
+
+func NewFluentForwardSink(cfg interface{}) (Sink, error) {
+	ffCfg := &fluentForwardConfig{}
+	if err := unmarshalConfig(FluentForwardSinkName, cfg, ffCfg); err != nil {
+		return nil, err
+	}
+	if ffCfg.Tag == "" {
+		ffCfg.Tag = defaultFluentForwardTag
+	}
+	if ffCfg.Network == networkUDP {
+		return nil, fmt.Errorf("init receiver %s, network %s not supported", FluentForwardSinkName, networkUDP)
+	}
+
+	pool, err := ffCfg.newConnPool(networkTCP)
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s failed: %v", FluentForwardSinkName, err)
+	}
+	klog.Infof("Fluent forward %s address: %s", ffCfg.Network, ffCfg.Address)
+	return &fluentForward{fluentForwardConfig: ffCfg, pool: pool}, nil
+}
+
+// Send sends the event with message mode: [tag, time, record].
+func (f *fluentForward) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	tag, err := getLayoutString(ev, f.Tag)
+	if err != nil {
+		return fmt.Errorf("render tag failed: %v", err)
+	}
+	body, err := serializeEventWithLayout(f.Layout, ev)
+	if err != nil {
+		return err
+	}
+	var record interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err = decoder.Decode(&record); err != nil {
+		return err
+	}
+
+	ts := ev.GetLastTimestamp()
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	msg, err := encodeFluentMessage(tag, ts, record)
+	if err != nil {
+		return err
+	}
+	return f.pool.write(ctx, msg)
+}
+
+func (f *fluentForward) Close() {
+	f.pool.close()
+}
+
+// fluentEventTime is the EventTime ext with seconds and nanoseconds.
+type fluentEventTime struct {
+	time.Time
+}
+
+var _ msgpack.MarshalerUnmarshaler = (*fluentEventTime)(nil)
+
+func (t *fluentEventTime) MarshalMsgpack() ([]byte, error) {
+	b := binary.BigEndian.AppendUint32(nil, uint32(t.Unix()))
+	return binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond())), nil
+}
+
+func (t *fluentEventTime) UnmarshalMsgpack(b []byte) error {
+	if len(b) != 8 {
+		return fmt.Errorf("invalid EventTime length %d", len(b))
+	}
+	t.Time = time.Unix(int64(binary.BigEndian.Uint32(b)), int64(binary.BigEndian.Uint32(b[4:])))
+	return nil
+}
+
+// encodeFluentMessage encodes the message mode entry, the record is decoded from JSON
+// with numbers, integers are kept as integers.
+func encodeFluentMessage(tag string, ts time.Time, record interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := msgpack.NewEncoder(buf)
+	enc.SetSortMapKeys(true)
+	enc.UseCompactInts(true)
+	if err := enc.EncodeArrayLen(3); err != nil {
+		return nil, err
+	}
+	if err := enc.EncodeString(tag); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(&fluentEventTime{Time: ts}); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(fromJSONNumbers(record)); err != nil {
+		return nil, fmt.Errorf("encode record failed: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// fromJSONNumbers converts json.Number to int64 or float64, msgpack encodes it as string.
+func fromJSONNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = fromJSONNumbers(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = fromJSONNumbers(v[k])
+		}
+	}
+	return v
+}
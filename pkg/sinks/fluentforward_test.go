@@ -0,0 +1,82 @@
+package sinks
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestFluentForward(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	sink, err := NewFluentForwardSink(map[string]interface{}{
+		"address": lis.Addr().String(),
+		"layout":  map[string]interface{}{"reason": "{{ .Reason }}"},
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	ev := buildTestEvent("nginx.backoff", "BackOff", 2)
+	require.NoError(t, sink.Send(context.TODO(), ev))
+
+	conn, err := lis.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	tag := "kubernetes.events.test"
+	expected := []byte{0x93, 0xa0 | byte(len(tag))}
+	expected = append(expected, tag...)
+	expected = append(expected, 0xd7, 0x00)
+	expected = binary.BigEndian.AppendUint32(expected, uint32(ev.LastTimestamp.Unix()))
+	expected = binary.BigEndian.AppendUint32(expected, uint32(ev.LastTimestamp.Nanosecond()))
+	expected = append(expected, 0x81, 0xa6)
+	expected = append(expected, "reason"...)
+	expected = append(expected, 0xa7)
+	expected = append(expected, "BackOff"...)
+
+	b := make([]byte, len(expected))
+	_, err = io.ReadFull(conn, b)
+	require.NoError(t, err)
+	require.Equal(t, expected, b)
+}
+
+func TestEncodeFluentMessage(t *testing.T) {
+	ts := time.Date(2023, 5, 12, 10, 0, 0, 123456789, time.UTC)
+	record := map[string]interface{}{}
+	decoder := json.NewDecoder(strings.NewReader(`{"b":null,"a":true,"count":-100,"ratio":1.5,"items":[1,"x",{"k":"v"}],"message":"` + strings.Repeat("x", 300) + `"}`))
+	decoder.UseNumber()
+	require.NoError(t, decoder.Decode(&record))
+
+	msg, err := encodeFluentMessage("kubernetes.events.test", ts, record)
+	require.NoError(t, err)
+
+	// decoded with the real decoder.
+	var entry []interface{}
+	require.NoError(t, msgpack.Unmarshal(msg, &entry))
+	require.Len(t, entry, 3)
+	require.Equal(t, "kubernetes.events.test", entry[0])
+	require.Equal(t, ts, entry[1].(*fluentEventTime).Time.UTC())
+	require.Equal(t, map[string]interface{}{
+		"a":       true,
+		"b":       nil,
+		"count":   int8(-100),
+		"ratio":   1.5,
+		"items":   []interface{}{int8(1), "x", map[string]interface{}{"k": "v"}},
+		"message": strings.Repeat("x", 300),
+	}, entry[2])
+
+	// the map keys are sorted, so the same record is encoded to the same bytes.
+	again, err := encodeFluentMessage("kubernetes.events.test", ts, record)
+	require.NoError(t, err)
+	require.Equal(t, msg, again)
+}
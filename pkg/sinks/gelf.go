@@ -0,0 +1,196 @@
+package sinks
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/champly/eventexporter/pkg/kube"
+	"k8s.io/klog/v2"
+)
+
+const (
+	GELFSinkName = "gelf"
+
+	// https://go2docs.graylog.org/current/getting_in_log_data/gelf.html
+	gelfVersion          = "1.1"
+	gelfChunkMagic0      = 0x1e
+	gelfChunkMagic1      = 0x0f
+	gelfChunkHeaderSize  = 12
+	gelfMaxChunks        = 128
+	defaultGELFChunkSize = 1420
+
+	defaultGELFHost         = "{{ .InvolvedObject.ClusterName }}"
+	defaultGELFShortMessage = "{{ .Reason }} {{ .Event.InvolvedObject.Kind }}/{{ .Event.InvolvedObject.Name }}: {{ .Message }}"
+)
+
+var invalidGELFFieldRegexp = regexp.MustCompile(`[^\w\.\-]`)
+
+func init() {
+	factory[GELFSinkName] = NewGELFSink
+}
+
+type gelfConfig struct {
+	netConfig `yaml:",inline"`
+	// Host, ShortMessage and FullMessage are templates of the message fields.
+	Host         string `yaml:"host"`
+	ShortMessage string `yaml:"shortMessage"`
+	FullMessage  string `yaml:"fullMessage"`
+	// AdditionalFields adds templated fields, the "_" prefix is added.
+	AdditionalFields map[string]string `yaml:"additionalFields"`
+	// Compress gzips udp messages, default is true.
+	Compress *bool `yaml:"compress"`
+	// ChunkSize is the max datagram size of udp.
+	ChunkSize int `yaml:"chunkSize"`
+}
+
+type gelf struct {
+	*gelfConfig
+	compress bool
+	pool     *connPool
+}
+
+func NewGELFSink(cfg interface{}) (Sink, error) {
+	gelfCfg := &gelfConfig{}
+	if err := unmarshalConfig(GELFSinkName, cfg, gelfCfg); err != nil {
+		return nil, err
+	}
+	if gelfCfg.Host == "" {
+		gelfCfg.Host = defaultGELFHost
+	}
+	if gelfCfg.ShortMessage == "" {
+		gelfCfg.ShortMessage = defaultGELFShortMessage
+	}
+	if gelfCfg.ChunkSize <= gelfChunkHeaderSize {
+		gelfCfg.ChunkSize = defaultGELFChunkSize
+	}
+
+	pool, err := gelfCfg.newConnPool(networkUDP)
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s failed: %v", GELFSinkName, err)
+	}
+	g := &gelf{gelfConfig: gelfCfg, compress: true, pool: pool}
+	if gelfCfg.Compress != nil {
+		g.compress = *gelfCfg.Compress
+	}
+	klog.Infof("GELF %s address: %s", gelfCfg.Network, gelfCfg.Address)
+	return g, nil
+}
+
+func (g *gelf) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	msg, err := g.format(ev)
+	if err != nil {
+		return err
+	}
+	if g.Network != networkUDP {
+		// stream messages are delimited by null byte and can't be compressed.
+		return g.pool.write(ctx, append(msg, 0))
+	}
+
+	if g.compress {
+		buf := &bytes.Buffer{}
+		gw := gzip.NewWriter(buf)
+		gw.Write(msg)
+		if err = gw.Close(); err != nil {
+			return err
+		}
+		msg = buf.Bytes()
+	}
+	chunks, err := gelfChunks(msg, g.ChunkSize)
+	if err != nil {
+		return err
+	}
+	return g.pool.write(ctx, chunks...)
+}
+
+func (g *gelf) Close() {
+	g.pool.close()
+}
+
+func (g *gelf) format(ev *kube.EnhancedEvent) ([]byte, error) {
+	host, err := getLayoutString(ev, g.Host)
+	if err != nil {
+		return nil, fmt.Errorf("render host failed: %v", err)
+	}
+	short, err := getLayoutString(ev, g.ShortMessage)
+	if err != nil {
+		return nil, fmt.Errorf("render short message failed: %v", err)
+	}
+
+	ts := ev.GetLastTimestamp()
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	msg := map[string]interface{}{
+		"version":       gelfVersion,
+		"host":          host,
+		"short_message": short,
+		"timestamp":     float64(ts.UnixMilli()) / 1000,
+		"level":         syslogSeverity(ev.Type),
+	}
+	if g.FullMessage != "" {
+		full, err := getLayoutString(ev, g.FullMessage)
+		if err != nil {
+			return nil, fmt.Errorf("render full message failed: %v", err)
+		}
+		msg["full_message"] = full
+	}
+
+	fields := map[string]string{
+		"cluster":   ev.InvolvedObject.ClusterName,
+		"namespace": ev.Event.InvolvedObject.Namespace,
+		"kind":      ev.Event.InvolvedObject.Kind,
+		"name":      ev.Event.InvolvedObject.Name,
+		"reason":    ev.Reason,
+		"type":      ev.Type,
+		"count":     strconv.Itoa(int(ev.Count)),
+	}
+	for k, v := range getLayoutLabels(ev, g.AdditionalFields) {
+		fields[k] = v
+	}
+	for k, v := range fields {
+		// _id is reserved
+		if k = invalidGELFFieldRegexp.ReplaceAllString(k, "_"); v != "" && k != "id" {
+			msg["_"+k] = v
+		}
+	}
+	return json.Marshal(msg)
+}
+
+// gelfChunks splits the udp message to chunks when it's larger than chunk size.
+func gelfChunks(msg []byte, chunkSize int) ([][]byte, error) {
+	if len(msg) <= chunkSize {
+		return [][]byte{msg}, nil
+	}
+
+	dataSize := chunkSize - gelfChunkHeaderSize
+	count := (len(msg) + dataSize - 1) / dataSize
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf("gelf message size %d exceeds %d chunks", len(msg), gelfMaxChunks)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * dataSize
+		if end > len(msg) {
+			end = len(msg)
+		}
+		chunk := make([]byte, 0, gelfChunkHeaderSize+end-i*dataSize)
+		chunk = append(chunk, gelfChunkMagic0, gelfChunkMagic1)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, msg[i*dataSize:end]...)
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
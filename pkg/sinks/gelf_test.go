@@ -0,0 +1,88 @@
+package sinks
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGELFUDPChunked(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+
+	sink, err := NewGELFSink(map[string]interface{}{
+		"address":          pc.LocalAddr().String(),
+		"chunkSize":        64,
+		"fullMessage":      "{{ .Message }}",
+		"additionalFields": map[string]interface{}{"app.name": "nginx"},
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	ev := buildTestEvent("nginx.backoff", "BackOff", 2)
+	ev.Message = strings.Repeat("x", 512)
+	require.NoError(t, sink.Send(context.TODO(), ev))
+
+	var (
+		data  [][]byte
+		count int
+	)
+	pc.SetReadDeadline(time.Now().Add(time.Second * 5))
+	for count == 0 || len(data) < count {
+		b := make([]byte, 64)
+		n, _, err := pc.ReadFrom(b)
+		require.NoError(t, err)
+		require.Equal(t, []byte{gelfChunkMagic0, gelfChunkMagic1}, b[:2])
+		count = int(b[11])
+		if data == nil {
+			data = make([][]byte, 0, count)
+		}
+		require.Equal(t, len(data), int(b[10]))
+		data = append(data, b[gelfChunkHeaderSize:n])
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(bytes.Join(data, nil)))
+	require.NoError(t, err)
+	msg := map[string]interface{}{}
+	require.NoError(t, json.NewDecoder(gr).Decode(&msg))
+	require.Equal(t, "1.1", msg["version"])
+	require.Equal(t, "test", msg["host"])
+	require.Equal(t, float64(4), msg["level"])
+	require.Equal(t, ev.Message, msg["full_message"])
+	require.Equal(t, "nginx", msg["_app.name"])
+	require.Equal(t, "BackOff", msg["_reason"])
+}
+
+func TestGELFTCP(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	sink, err := NewGELFSink(map[string]interface{}{"network": "tcp", "address": lis.Addr().String()})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 2)))
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.started", "Started", 1)))
+
+	conn, err := lis.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for _, reason := range []string{"BackOff", "Started"} {
+		b, err := r.ReadBytes(0)
+		require.NoError(t, err)
+		msg := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(b[:len(b)-1], &msg))
+		require.Equal(t, reason, msg["_reason"])
+	}
+}
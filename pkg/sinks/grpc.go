@@ -0,0 +1,353 @@
+package sinks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	eventexporterv1 "github.com/champly/eventexporter/api/eventexporter/v1"
+	"github.com/champly/eventexporter/pkg/kube"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"k8s.io/klog/v2"
+)
+
+const (
+	GRPCSinkName = "grpc"
+
+	defaultGRPCMaxInFlight      = 100
+	defaultGRPCQueueSize        = 1000
+	defaultGRPCAckTimeout       = time.Second * 30
+	defaultGRPCReconnectWait    = time.Second
+	defaultGRPCMaxReconnectWait = time.Second * 30
+	defaultGRPCCloseTimeout     = time.Second * 10
+	defaultGRPCRetry            = 3
+)
+
+func init() {
+	factory[GRPCSinkName] = NewGRPCSink
+}
+
+type grpcConfig struct {
+	// Endpoint is the host:port of the EventSink service in api/eventexporter/v1.
+	Endpoint string `yaml:"endpoint"`
+	// Insecure disables tls of connection.
+	Insecure  bool              `yaml:"insecure"`
+	TLSConfig *tlsConfig        `yaml:"tlsConfig"`
+	Headers   map[string]string `yaml:"headers"`
+	// MaxInFlight is the max unacknowledged events, the queued events wait until the
+	// receiver acknowledges the previous ones.
+	MaxInFlight int `yaml:"maxInFlight"`
+	// QueueSize is the max events waiting to be sent, Send fails when it's full.
+	QueueSize int `yaml:"queueSize"`
+	// AckTimeout reconnects the stream when an event is not acknowledged within it.
+	AckTimeout time.Duration `yaml:"ackTimeout"`
+	// ReconnectWait is the initial backoff of reconnect, it doubles up to MaxReconnectWait.
+	ReconnectWait    time.Duration `yaml:"reconnectWait"`
+	MaxReconnectWait time.Duration `yaml:"maxReconnectWait"`
+	// CloseTimeout is the max time waiting for the acknowledgement of queued events on close.
+	CloseTimeout time.Duration `yaml:"closeTimeout"`
+	// MaxRetries is the max times an event rejected as retryable is resent, it's resent on
+	// the same stream with the backoff of reconnect and dropped after the retries.
+	MaxRetries *int `yaml:"maxRetries"`
+}
+
+// grpcPendingEvent is an event waiting for acknowledgement.
+type grpcPendingEvent struct {
+	req     *eventexporterv1.StreamRequest
+	retries int
+}
+
+type grpcSink struct {
+	*grpcConfig
+	conn     *grpc.ClientConn
+	client   eventexporterv1.EventSinkClient
+	md       metadata.MD
+	queue    chan *eventexporterv1.Event
+	retries  int
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func NewGRPCSink(cfg interface{}) (Sink, error) {
+	grpcCfg := &grpcConfig{}
+	if err := unmarshalConfig(GRPCSinkName, cfg, grpcCfg); err != nil {
+		return nil, err
+	}
+	if grpcCfg.Endpoint == "" {
+		return nil, fmt.Errorf("init receiver %s, endpoint must be set", GRPCSinkName)
+	}
+	if grpcCfg.MaxInFlight <= 0 {
+		grpcCfg.MaxInFlight = defaultGRPCMaxInFlight
+	}
+	if grpcCfg.QueueSize <= 0 {
+		grpcCfg.QueueSize = defaultGRPCQueueSize
+	}
+	if grpcCfg.AckTimeout <= 0 {
+		grpcCfg.AckTimeout = defaultGRPCAckTimeout
+	}
+	if grpcCfg.ReconnectWait <= 0 {
+		grpcCfg.ReconnectWait = defaultGRPCReconnectWait
+	}
+	if grpcCfg.MaxReconnectWait < grpcCfg.ReconnectWait {
+		grpcCfg.MaxReconnectWait = defaultGRPCMaxReconnectWait
+	}
+	if grpcCfg.CloseTimeout <= 0 {
+		grpcCfg.CloseTimeout = defaultGRPCCloseTimeout
+	}
+
+	creds := insecure.NewCredentials()
+	if !grpcCfg.Insecure {
+		tlsCfg := grpcCfg.TLSConfig
+		if tlsCfg == nil {
+			tlsCfg = &tlsConfig{}
+		}
+		c, err := tlsCfg.build()
+		if err != nil {
+			return nil, fmt.Errorf("init receiver %s tls config failed: %v", GRPCSinkName, err)
+		}
+		creds = credentials.NewTLS(c)
+	}
+	// dial does not block, the connection is established by the first stream.
+	conn, err := grpc.Dial(grpcCfg.Endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s dial %s failed: %v", GRPCSinkName, grpcCfg.Endpoint, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g := &grpcSink{
+		grpcConfig: grpcCfg,
+		conn:       conn,
+		client:     eventexporterv1.NewEventSinkClient(conn),
+		md:         metadata.New(grpcCfg.Headers),
+		queue:      make(chan *eventexporterv1.Event, grpcCfg.QueueSize),
+		retries:    defaultGRPCRetry,
+		ctx:        ctx,
+		cancel:     cancel,
+		stopCh:     make(chan struct{}),
+	}
+	if grpcCfg.MaxRetries != nil {
+		g.retries = *grpcCfg.MaxRetries
+	}
+	g.wg.Add(1)
+	go g.run()
+	klog.Infof("GRPC endpoint: %s, max in flight: %d", grpcCfg.Endpoint, grpcCfg.MaxInFlight)
+	return g, nil
+}
+
+// Send queues the event without blocking, it fails when the queue is full.
+func (g *grpcSink) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	select {
+	case g.queue <- ev.ToProto():
+		return nil
+	default:
+		return fmt.Errorf("grpc queue is full, drop event %s/%s", ev.Namespace, ev.Name)
+	}
+}
+
+// Close waits for the acknowledgement of queued events until close timeout.
+func (g *grpcSink) Close() {
+	g.stopOnce.Do(func() {
+		close(g.stopCh)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(g.CloseTimeout):
+		g.cancel()
+		<-done
+	}
+	g.cancel()
+	if err := g.conn.Close(); err != nil {
+		klog.Errorf("Receiver %s close connection failed: %+v", GRPCSinkName, err)
+	}
+}
+
+func (g *grpcSink) stopped() bool {
+	select {
+	case <-g.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// run streams the events and reconnects with backoff until the sink is closed.
+func (g *grpcSink) run() {
+	defer g.wg.Done()
+
+	var (
+		seq     uint64
+		pending = map[uint64]*grpcPendingEvent{}
+		wait    = g.ReconnectWait
+	)
+	for {
+		start := time.Now()
+		err := g.stream(pending, &seq)
+		if err == nil {
+			return
+		}
+		if g.ctx.Err() != nil {
+			klog.Errorf("Receiver %s closed with %d events unacknowledged, %d events queued", GRPCSinkName, len(pending), len(g.queue))
+			return
+		}
+		// the backoff is reset when the stream has worked for a while.
+		if time.Since(start) > g.MaxReconnectWait {
+			wait = g.ReconnectWait
+		}
+		klog.Errorf("Receiver %s stream failed, reconnect after %s: %+v", GRPCSinkName, wait, err)
+
+		select {
+		case <-time.After(wait):
+		case <-g.ctx.Done():
+		}
+		if wait *= 2; wait > g.MaxReconnectWait {
+			wait = g.MaxReconnectWait
+		}
+	}
+}
+
+// stream sends the unacknowledged and queued events on one stream until it fails. It
+// returns nil when the sink is stopped and all the events are acknowledged.
+func (g *grpcSink) stream(pending map[uint64]*grpcPendingEvent, seq *uint64) error {
+	ctx, cancel := context.WithCancel(metadata.NewOutgoingContext(g.ctx, g.md))
+	defer cancel()
+
+	stream, err := g.client.Stream(ctx)
+	if err != nil {
+		return err
+	}
+	acks := make(chan *eventexporterv1.StreamResponse)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			resp, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case acks <- resp:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	sentAt := map[uint64]time.Time{}
+	send := func(req *eventexporterv1.StreamRequest) error {
+		if err := stream.Send(req); err != nil {
+			return err
+		}
+		sentAt[req.Sequence] = time.Now()
+		return nil
+	}
+	// the unacknowledged events of the previous stream are sent first.
+	seqs := make([]uint64, 0, len(pending))
+	for s := range pending {
+		seqs = append(seqs, s)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	for _, s := range seqs {
+		if err := send(pending[s].req); err != nil {
+			return err
+		}
+	}
+
+	// retryCh receives the sequences of rejected events after backoff.
+	retryCh := make(chan uint64)
+	ticker := time.NewTicker(g.AckTimeout / 4)
+	defer ticker.Stop()
+	stopCh := g.stopCh
+	for {
+		if len(pending) == 0 && len(g.queue) == 0 && g.stopped() {
+			return stream.CloseSend()
+		}
+
+		// the queue is not read when the in flight window is full.
+		var queue chan *eventexporterv1.Event
+		if len(pending) < g.MaxInFlight {
+			queue = g.queue
+		}
+		select {
+		case ev := <-queue:
+			*seq++
+			req := &eventexporterv1.StreamRequest{Sequence: *seq, Event: ev}
+			pending[req.Sequence] = &grpcPendingEvent{req: req}
+			if err := send(req); err != nil {
+				return err
+			}
+		case resp := <-acks:
+			p, ok := pending[resp.Sequence]
+			if !ok {
+				continue
+			}
+			delete(sentAt, resp.Sequence)
+			if resp.Error != "" && resp.Retryable && p.retries < g.retries {
+				p.retries++
+				wait := g.retryWait(p.retries)
+				klog.Warningf("Receiver %s event %d rejected, resend after %s: %s", GRPCSinkName, resp.Sequence, wait, resp.Error)
+				time.AfterFunc(wait, func() {
+					select {
+					case retryCh <- p.req.Sequence:
+					case <-ctx.Done():
+					}
+				})
+				continue
+			}
+			if resp.Error != "" {
+				klog.Errorf("Receiver %s event %d rejected after %d retries: %s", GRPCSinkName, resp.Sequence, p.retries, resp.Error)
+			}
+			delete(pending, resp.Sequence)
+		case s := <-retryCh:
+			if p, ok := pending[s]; ok {
+				if err := send(p.req); err != nil {
+					return err
+				}
+			}
+		case err := <-recvErr:
+			if errors.Is(err, io.EOF) {
+				err = errors.New("stream closed by receiver")
+			}
+			return err
+		case <-ticker.C:
+			for s, t := range sentAt {
+				if time.Since(t) > g.AckTimeout {
+					return fmt.Errorf("event %d ack timeout", s)
+				}
+			}
+		case <-stopCh:
+			// wake up once to check whether all the events are acknowledged.
+			stopCh = nil
+		case <-g.ctx.Done():
+			return g.ctx.Err()
+		}
+	}
+}
+
+// retryWait is the backoff of the rejected event, it doubles from reconnect wait up to
+// max reconnect wait.
+func (g *grpcSink) retryWait(retries int) time.Duration {
+	wait := g.ReconnectWait
+	for i := 1; i < retries && wait < g.MaxReconnectWait; i++ {
+		wait *= 2
+	}
+	if wait > g.MaxReconnectWait {
+		wait = g.MaxReconnectWait
+	}
+	return wait
+}
@@ -0,0 +1,188 @@
+package sinks
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	eventexporterv1 "github.com/champly/eventexporter/api/eventexporter/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeEventSink records the received events, the events are acknowledged when ack is
+// set and the stream fails after failAfter events. The sequences in reject are rejected
+// as retryable the given times.
+type fakeEventSink struct {
+	eventexporterv1.UnimplementedEventSinkServer
+	sync.Mutex
+	ack       bool
+	failAfter int
+	reject    map[uint64]int
+	streams   int
+	sequences []uint64
+	events    []*eventexporterv1.Event
+	token     string
+}
+
+func (s *fakeEventSink) Stream(stream eventexporterv1.EventSink_StreamServer) error {
+	s.Lock()
+	s.streams++
+	if md, ok := metadata.FromIncomingContext(stream.Context()); ok && len(md.Get("token")) > 0 {
+		s.token = md.Get("token")[0]
+	}
+	s.Unlock()
+
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		s.Lock()
+		s.sequences = append(s.sequences, req.Sequence)
+		s.events = append(s.events, req.Event)
+		fail := s.failAfter > 0 && len(s.sequences) >= s.failAfter
+		if fail {
+			s.failAfter = 0
+		}
+		ack := s.ack
+		reject := s.reject[req.Sequence] > 0
+		if reject {
+			s.reject[req.Sequence]--
+		}
+		s.Unlock()
+
+		if fail {
+			return status.Error(codes.Unavailable, "receiver restarting")
+		}
+		if reject {
+			if err := stream.Send(&eventexporterv1.StreamResponse{Sequence: req.Sequence, Error: "busy", Retryable: true}); err != nil {
+				return err
+			}
+			continue
+		}
+		if ack {
+			if err := stream.Send(&eventexporterv1.StreamResponse{Sequence: req.Sequence}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *fakeEventSink) received() []uint64 {
+	s.Lock()
+	defer s.Unlock()
+	return append([]uint64(nil), s.sequences...)
+}
+
+func startFakeEventSink(t *testing.T, fake *fakeEventSink) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	eventexporterv1.RegisterEventSinkServer(srv, fake)
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(srv.Stop)
+	return l.Addr().String()
+}
+
+func TestGRPCStream(t *testing.T) {
+	fake := &fakeEventSink{}
+	addr := startFakeEventSink(t, fake)
+
+	sink, err := NewGRPCSink(map[string]interface{}{
+		"endpoint":    addr,
+		"insecure":    true,
+		"headers":     map[string]string{"token": "secret"},
+		"maxInFlight": 2,
+		"ackTimeout":  "1s",
+	})
+	require.NoError(t, err)
+
+	ev := buildTestEvent("nginx.backoff", "BackOff", 3)
+	ev.InvolvedObject.Labels = map[string]string{"app": "nginx"}
+	for i := 0; i < 5; i++ {
+		require.NoError(t, sink.Send(context.TODO(), ev))
+	}
+
+	// the events wait for acknowledgement when the window is full.
+	require.Eventually(t, func() bool { return len(fake.received()) == 2 }, time.Second*5, time.Millisecond*10)
+	time.Sleep(time.Millisecond * 100)
+	require.Equal(t, []uint64{1, 2}, fake.received())
+
+	// the stream is reconnected by ack timeout, and the acknowledged events are not resent.
+	fake.Lock()
+	fake.ack = true
+	fake.Unlock()
+	sink.Close()
+
+	received := fake.received()
+	require.Equal(t, []uint64{1, 2, 3, 4, 5}, received[len(received)-5:])
+
+	fake.Lock()
+	defer fake.Unlock()
+	require.Equal(t, "secret", fake.token)
+	event := fake.events[0]
+	require.Equal(t, "test", event.ClusterName)
+	require.Equal(t, "BackOff", event.Reason)
+	require.Equal(t, int32(3), event.Count)
+	require.Equal(t, "nginx", event.InvolvedObject.Name)
+	require.Equal(t, map[string]string{"app": "nginx"}, event.InvolvedObject.Labels)
+	require.Equal(t, ev.LastTimestamp.Unix(), event.LastTimestamp.AsTime().Unix())
+	require.Nil(t, event.EventTime)
+}
+
+func TestGRPCReconnect(t *testing.T) {
+	fake := &fakeEventSink{ack: true, failAfter: 2}
+	addr := startFakeEventSink(t, fake)
+
+	sink, err := NewGRPCSink(map[string]interface{}{
+		"endpoint":      addr,
+		"insecure":      true,
+		"maxInFlight":   1,
+		"reconnectWait": "10ms",
+	})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)))
+	}
+	sink.Close()
+
+	// the second event is resent on the new stream.
+	require.Equal(t, []uint64{1, 2, 2, 3}, fake.received())
+	fake.Lock()
+	defer fake.Unlock()
+	require.Equal(t, 2, fake.streams)
+}
+
+func TestGRPCRetryableReject(t *testing.T) {
+	fake := &fakeEventSink{ack: true, reject: map[uint64]int{1: 100, 2: 1}}
+	addr := startFakeEventSink(t, fake)
+
+	sink, err := NewGRPCSink(map[string]interface{}{
+		"endpoint":      addr,
+		"insecure":      true,
+		"reconnectWait": "10ms",
+		"maxRetries":    2,
+	})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)))
+	}
+	sink.Close()
+
+	// only the rejected events are resent on the same stream, the first event is dropped
+	// after the retries.
+	received := map[uint64]int{}
+	for _, seq := range fake.received() {
+		received[seq]++
+	}
+	require.Equal(t, map[uint64]int{1: 3, 2: 2, 3: 1}, received)
+	fake.Lock()
+	defer fake.Unlock()
+	require.Equal(t, 1, fake.streams)
+}
@@ -0,0 +1,135 @@
+package sinks
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// httpClientConfig is the common http client configuration of http based sinks.
+type httpClientConfig struct {
+	TLSConfig       *tlsConfig `yaml:"tlsConfig"`
+	BasicAuth       *basicAuth `yaml:"basicAuth"`
+	BearerToken     string     `yaml:"bearerToken"`
+	BearerTokenFile string     `yaml:"bearerTokenFile"`
+}
+
+type tlsConfig struct {
+	CAFile             string `yaml:"caFile"`
+	CertFile           string `yaml:"certFile"`
+	KeyFile            string `yaml:"keyFile"`
+	ServerName         string `yaml:"serverName"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+}
+
+type basicAuth struct {
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"passwordFile"`
+}
+
+func (c *httpClientConfig) validate() error {
+	if c.BasicAuth != nil && (c.BearerToken != "" || c.BearerTokenFile != "") {
+		return fmt.Errorf("basicAuth and bearerToken are mutually exclusive")
+	}
+	if c.BearerToken != "" && c.BearerTokenFile != "" {
+		return fmt.Errorf("bearerToken and bearerTokenFile are mutually exclusive")
+	}
+	if c.BasicAuth != nil && c.BasicAuth.Password != "" && c.BasicAuth.PasswordFile != "" {
+		return fmt.Errorf("basicAuth password and passwordFile are mutually exclusive")
+	}
+	return nil
+}
+
+// newHTTPClient builds http client with tls and authorization config.
+func (c *httpClientConfig) newHTTPClient() (*http.Client, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.TLSConfig != nil {
+		tlsCfg, err := c.TLSConfig.build()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsCfg
+	}
+
+	return &http.Client{
+		Transport: &authRoundTripper{httpClientConfig: c, next: transport},
+	}, nil
+}
+
+// build converts tlsConfig to *tls.Config, the files are loaded once.
+func (c *tlsConfig) build() (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		b, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read tls ca file %s failed: %v", c.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("tls ca file %s not contains any PEM certificate", c.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, fmt.Errorf("tls certFile and keyFile must be set both")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load tls key pair %s %s failed: %v", c.CertFile, c.KeyFile, err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
+
+// authRoundTripper sets authorization header for every request, the secret
+// files are read every time so that rotated secrets take effect.
+type authRoundTripper struct {
+	*httpClientConfig
+	next http.RoundTripper
+}
+
+func (rt *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch {
+	case rt.BasicAuth != nil:
+		password := rt.BasicAuth.Password
+		if rt.BasicAuth.PasswordFile != "" {
+			b, err := os.ReadFile(rt.BasicAuth.PasswordFile)
+			if err != nil {
+				return nil, fmt.Errorf("read basic auth password file %s failed: %v", rt.BasicAuth.PasswordFile, err)
+			}
+			password = strings.TrimSpace(string(b))
+		}
+		req = req.Clone(req.Context())
+		req.SetBasicAuth(rt.BasicAuth.Username, password)
+
+	case rt.BearerToken != "" || rt.BearerTokenFile != "":
+		token := rt.BearerToken
+		if rt.BearerTokenFile != "" {
+			b, err := os.ReadFile(rt.BearerTokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("read bearer token file %s failed: %v", rt.BearerTokenFile, err)
+			}
+			token = strings.TrimSpace(string(b))
+		}
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return rt.next.RoundTrip(req)
+}
@@ -0,0 +1,293 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/champly/eventexporter/pkg/kube"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultIncidentDedupKey     = "{{ .InvolvedObject.ClusterName }}/{{ .Event.InvolvedObject.Namespace }}/{{ .Event.InvolvedObject.Kind }}/{{ .Event.InvolvedObject.Name }}/{{ .Reason }}"
+	defaultIncidentSummary      = "[{{ .InvolvedObject.ClusterName }}] {{ .Reason }} {{ .Event.InvolvedObject.Kind }} {{ .Event.InvolvedObject.Namespace }}/{{ .Event.InvolvedObject.Name }}: {{ .Message }}"
+	defaultIncidentResolveAfter = time.Minute * 15
+	defaultIncidentTimeout      = time.Second * 10
+	defaultIncidentRetry        = 2
+	maxIncidentResolveInterval  = time.Minute
+)
+
+// incidentProvider triggers and resolves incidents of an incident management api.
+type incidentProvider interface {
+	trigger(ctx context.Context, inc *incident) error
+	resolve(ctx context.Context, inc *incident) error
+}
+
+// incidentConfig is the common configuration of incident management sinks.
+type incidentConfig struct {
+	// URL overrides the api address of the provider.
+	URL string `yaml:"url"`
+	// DedupKey is the template of dedup key, events with the same key are one incident.
+	DedupKey string `yaml:"dedupKey"`
+	// Summary is the template of incident title.
+	Summary string `yaml:"summary"`
+	// Severity is the template of severity (priority of opsgenie).
+	Severity string `yaml:"severity"`
+	// Details are the templates of custom details.
+	Details map[string]string `yaml:"details"`
+	// ResolveAfter resolves the incident when the event doesn't recur within it.
+	ResolveAfter     time.Duration    `yaml:"resolveAfter"`
+	HTTPClientConfig httpClientConfig `yaml:",inline"`
+	Timeout          time.Duration    `yaml:"timeout"`
+	MaxRetries       *int             `yaml:"maxRetries"`
+}
+
+type incident struct {
+	dedupKey  string
+	objectKey string
+	summary   string
+	severity  string
+	source    string
+	details   map[string]string
+	ts        time.Time
+	count     int32
+	lastSeen  time.Time
+}
+
+// incidentSink triggers an incident for the first matched event, and again when
+// the count increases. The incident is resolved when the event stops recurring or
+// the involved object is deleted. Incidents are tracked in memory, incidents opened
+// before restart are resolved by the provider only.
+type incidentSink struct {
+	*incidentConfig
+	name       string
+	provider   incidentProvider
+	maxRetries int
+	active     map[string]*incident
+	sync.Mutex
+	stopCh chan struct{}
+	done   chan struct{}
+}
+
+func (c *incidentConfig) complete(severity string) {
+	if c.DedupKey == "" {
+		c.DedupKey = defaultIncidentDedupKey
+	}
+	if c.Summary == "" {
+		c.Summary = defaultIncidentSummary
+	}
+	if c.Severity == "" {
+		c.Severity = severity
+	}
+	if c.ResolveAfter <= 0 {
+		c.ResolveAfter = defaultIncidentResolveAfter
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultIncidentTimeout
+	}
+}
+
+func newIncidentSink(name string, cfg *incidentConfig, provider incidentProvider) *incidentSink {
+	s := &incidentSink{
+		incidentConfig: cfg,
+		name:           name,
+		provider:       provider,
+		maxRetries:     defaultIncidentRetry,
+		active:         map[string]*incident{},
+		stopCh:         make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	if cfg.MaxRetries != nil {
+		s.maxRetries = *cfg.MaxRetries
+	}
+	go s.resolveLoop()
+	return s
+}
+
+func (s *incidentSink) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	inc, err := s.buildIncident(ev)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	prev, ok := s.active[inc.dedupKey]
+	if ok {
+		prev.lastSeen = inc.lastSeen
+		if inc.count <= prev.count {
+			s.Unlock()
+			return nil
+		}
+	}
+	s.Unlock()
+
+	if err = s.do(ctx, s.provider.trigger, inc); err != nil {
+		return fmt.Errorf("trigger incident %s failed: %w", inc.dedupKey, err)
+	}
+
+	s.Lock()
+	s.active[inc.dedupKey] = inc
+	s.Unlock()
+	return nil
+}
+
+// OnObjectDeleted resolves the incidents of the deleted object.
+func (s *incidentSink) OnObjectDeleted(ctx context.Context, clusterName string, reference *corev1.ObjectReference) error {
+	objectKey := incidentObjectKey(clusterName, reference)
+	resolved := []*incident{}
+	s.Lock()
+	for key, inc := range s.active {
+		if inc.objectKey == objectKey {
+			resolved = append(resolved, inc)
+			delete(s.active, key)
+		}
+	}
+	s.Unlock()
+	return s.resolveAll(ctx, resolved)
+}
+
+func (s *incidentSink) Close() {
+	close(s.stopCh)
+	<-s.done
+}
+
+func (s *incidentSink) buildIncident(ev *kube.EnhancedEvent) (*incident, error) {
+	inc := &incident{
+		objectKey: incidentObjectKey(ev.InvolvedObject.ClusterName, &ev.Event.InvolvedObject),
+		source:    ev.InvolvedObject.ClusterName,
+		ts:        ev.GetLastTimestamp(),
+		count:     ev.Count,
+		lastSeen:  time.Now(),
+	}
+	if inc.source == "" {
+		inc.source = "eventexporter"
+	}
+	if inc.ts.IsZero() {
+		inc.ts = inc.lastSeen
+	}
+	for _, f := range []struct {
+		name string
+		text string
+		out  *string
+	}{
+		{"dedupKey", s.DedupKey, &inc.dedupKey},
+		{"summary", s.Summary, &inc.summary},
+		{"severity", s.Severity, &inc.severity},
+	} {
+		v, err := getLayoutString(ev, f.text)
+		if err != nil {
+			return nil, fmt.Errorf("render %s failed: %v", f.name, err)
+		}
+		*f.out = strings.TrimSpace(v)
+	}
+	if inc.dedupKey == "" {
+		return nil, fmt.Errorf("dedup key of %s/%s is empty", ev.Namespace, ev.Name)
+	}
+
+	inc.details = getLayoutLabels(ev, map[string]string{
+		"cluster":   "{{ .InvolvedObject.ClusterName }}",
+		"namespace": "{{ .Event.InvolvedObject.Namespace }}",
+		"kind":      "{{ .Event.InvolvedObject.Kind }}",
+		"name":      "{{ .Event.InvolvedObject.Name }}",
+		"reason":    "{{ .Reason }}",
+		"type":      "{{ .Type }}",
+		"message":   "{{ .Message }}",
+		"count":     "{{ .Count }}",
+	}, s.Details)
+	return inc, nil
+}
+
+func (s *incidentSink) resolveLoop() {
+	defer close(s.done)
+
+	interval := s.ResolveAfter / 2
+	if interval > maxIncidentResolveInterval {
+		interval = maxIncidentResolveInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			resolved := []*incident{}
+			s.Lock()
+			for key, inc := range s.active {
+				if time.Since(inc.lastSeen) > s.ResolveAfter {
+					resolved = append(resolved, inc)
+					delete(s.active, key)
+				}
+			}
+			s.Unlock()
+			if err := s.resolveAll(context.Background(), resolved); err != nil {
+				klog.Errorf("Receiver %s resolve incidents failed: %+v", s.name, err)
+			}
+		}
+	}
+}
+
+func (s *incidentSink) resolveAll(ctx context.Context, incidents []*incident) error {
+	var errs []string
+	for _, inc := range incidents {
+		if err := s.do(ctx, s.provider.resolve, inc); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", inc.dedupKey, err))
+			continue
+		}
+		klog.V(4).Infof("Receiver %s resolve incident %s.", s.name, inc.dedupKey)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("resolve incidents failed: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (s *incidentSink) do(ctx context.Context, f func(context.Context, *incident) error, inc *incident) error {
+	return sendWithRetry(ctx, s.maxRetries, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+		return f(ctx, inc)
+	})
+}
+
+func incidentObjectKey(clusterName string, reference *corev1.ObjectReference) string {
+	return strings.Join([]string{clusterName, reference.Namespace, reference.Kind, reference.Name}, "/")
+}
+
+// postIncidentJSON posts the payload, the response body is ignored.
+func postIncidentJSON(ctx context.Context, client *http.Client, url string, header http.Header, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return newNetworkError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		return newStatusError(resp.StatusCode, errors.New(string(b)))
+	}
+	return nil
+}
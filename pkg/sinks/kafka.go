@@ -0,0 +1,251 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/champly/eventexporter/pkg/kube"
+	"github.com/xdg-go/scram"
+	"k8s.io/klog/v2"
+)
+
+const (
+	KafkaSinkName = "kafka"
+
+	// defaultKafkaKey puts all the events of an involved object into the same partition.
+	defaultKafkaKey = "{{ .InvolvedObject.ClusterName }}/{{ .Event.InvolvedObject.Namespace }}/{{ .Event.InvolvedObject.Name }}"
+)
+
+var (
+	kafkaCompressions = map[string]sarama.CompressionCodec{
+		"":       sarama.CompressionNone,
+		"none":   sarama.CompressionNone,
+		"gzip":   sarama.CompressionGZIP,
+		"snappy": sarama.CompressionSnappy,
+		"lz4":    sarama.CompressionLZ4,
+		"zstd":   sarama.CompressionZSTD,
+	}
+
+	kafkaRequiredAcks = map[string]sarama.RequiredAcks{
+		"":       sarama.WaitForLocal,
+		"none":   sarama.NoResponse,
+		"leader": sarama.WaitForLocal,
+		"all":    sarama.WaitForAll,
+	}
+
+	kafkaPartitioners = map[string]sarama.PartitionerConstructor{
+		"":           sarama.NewHashPartitioner,
+		"hash":       sarama.NewHashPartitioner,
+		"random":     sarama.NewRandomPartitioner,
+		"roundrobin": sarama.NewRoundRobinPartitioner,
+	}
+)
+
+func init() {
+	factory[KafkaSinkName] = NewKafkaSink
+}
+
+type kafkaConfig struct {
+	Brokers []string `yaml:"brokers"`
+	Topic   string   `yaml:"topic"`
+	// Key is the template of message key, default is cluster/namespace/involvedObject.
+	Key string `yaml:"key"`
+	// Layout is the message value layout, the whole event is sent when it's empty.
+	Layout   map[string]interface{} `yaml:"layout"`
+	ClientID string                 `yaml:"clientId"`
+	// Version is the kafka protocol version, e.g. 2.8.0.
+	Version string `yaml:"version"`
+	// Compression is one of none, gzip, snappy, lz4 and zstd.
+	Compression string `yaml:"compression"`
+	// RequiredAcks is one of none, leader and all.
+	RequiredAcks string `yaml:"requiredAcks"`
+	// Partitioner is one of hash, random and roundrobin, hash uses the message key.
+	Partitioner string           `yaml:"partitioner"`
+	Batch       kafkaBatchConfig `yaml:"batch"`
+	TLSConfig   *tlsConfig       `yaml:"tlsConfig"`
+	SASL        *kafkaSASLConfig `yaml:"sasl"`
+}
+
+type kafkaBatchConfig struct {
+	// Messages is the max messages of a batch.
+	Messages int `yaml:"messages"`
+	// Bytes is the max bytes of a batch.
+	Bytes int `yaml:"bytes"`
+	// Interval is the max time a message waits in batch.
+	Interval time.Duration `yaml:"interval"`
+}
+
+type kafkaSASLConfig struct {
+	// Mechanism is one of PLAIN, SCRAM-SHA-256 and SCRAM-SHA-512.
+	Mechanism string `yaml:"mechanism"`
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
+}
+
+type kafka struct {
+	*kafkaConfig
+	producer sarama.AsyncProducer
+	wg       sync.WaitGroup
+}
+
+func NewKafkaSink(cfg interface{}) (Sink, error) {
+	kafkaCfg := &kafkaConfig{}
+	if err := unmarshalConfig(KafkaSinkName, cfg, kafkaCfg); err != nil {
+		return nil, err
+	}
+	saramaCfg, err := kafkaCfg.buildSaramaConfig()
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s failed: %v", KafkaSinkName, err)
+	}
+
+	producer, err := sarama.NewAsyncProducer(kafkaCfg.Brokers, saramaCfg)
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s, build producer with brokers %s failed: %v", KafkaSinkName, strings.Join(kafkaCfg.Brokers, ","), err)
+	}
+	klog.Infof("Kafka brokers: %s, topic: %s", strings.Join(kafkaCfg.Brokers, ","), kafkaCfg.Topic)
+
+	k := &kafka{
+		kafkaConfig: kafkaCfg,
+		producer:    producer,
+	}
+	k.wg.Add(1)
+	go k.handleErrors()
+	return k, nil
+}
+
+// Send queues the event into producer, the delivery errors are logged asynchronously.
+func (k *kafka) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	msg, err := k.buildMessage(ev)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case k.producer.Input() <- msg:
+		return nil
+	case <-ctx.Done():
+		return newNetworkError(ctx.Err())
+	}
+}
+
+// Close flushes the buffered messages.
+func (k *kafka) Close() {
+	k.producer.AsyncClose()
+	k.wg.Wait()
+}
+
+func (k *kafka) handleErrors() {
+	defer k.wg.Done()
+
+	for err := range k.producer.Errors() {
+		klog.Errorf("Receiver %s produce message with key %s failed: %+v", KafkaSinkName, err.Msg.Key, err.Err)
+	}
+}
+
+func (k *kafka) buildMessage(ev *kube.EnhancedEvent) (*sarama.ProducerMessage, error) {
+	value, err := serializeEventWithLayout(k.Layout, ev)
+	if err != nil {
+		return nil, err
+	}
+	key, err := getLayoutString(ev, k.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sarama.ProducerMessage{
+		Topic: k.Topic,
+		Key:   sarama.StringEncoder(key),
+		Value: sarama.ByteEncoder(value),
+	}, nil
+}
+
+func (c *kafkaConfig) buildSaramaConfig() (*sarama.Config, error) {
+	if len(c.Brokers) == 0 {
+		return nil, fmt.Errorf("brokers must be set")
+	}
+	if c.Topic == "" {
+		return nil, fmt.Errorf("topic must be set")
+	}
+	if c.Key == "" {
+		c.Key = defaultKafkaKey
+	}
+
+	saramaCfg := sarama.NewConfig()
+	if c.ClientID != "" {
+		saramaCfg.ClientID = c.ClientID
+	}
+	if c.Version != "" {
+		version, err := sarama.ParseKafkaVersion(c.Version)
+		if err != nil {
+			return nil, err
+		}
+		saramaCfg.Version = version
+	}
+
+	var ok bool
+	if saramaCfg.Producer.Compression, ok = kafkaCompressions[strings.ToLower(c.Compression)]; !ok {
+		return nil, fmt.Errorf("compression %s is not supported", c.Compression)
+	}
+	if saramaCfg.Producer.RequiredAcks, ok = kafkaRequiredAcks[strings.ToLower(c.RequiredAcks)]; !ok {
+		return nil, fmt.Errorf("requiredAcks %s is not supported", c.RequiredAcks)
+	}
+	if saramaCfg.Producer.Partitioner, ok = kafkaPartitioners[strings.ToLower(c.Partitioner)]; !ok {
+		return nil, fmt.Errorf("partitioner %s is not supported", c.Partitioner)
+	}
+	saramaCfg.Producer.Flush.Messages = c.Batch.Messages
+	saramaCfg.Producer.Flush.Bytes = c.Batch.Bytes
+	saramaCfg.Producer.Flush.Frequency = c.Batch.Interval
+	saramaCfg.Producer.Return.Errors = true
+
+	if c.TLSConfig != nil {
+		tlsCfg, err := c.TLSConfig.build()
+		if err != nil {
+			return nil, err
+		}
+		saramaCfg.Net.TLS.Enable = true
+		saramaCfg.Net.TLS.Config = tlsCfg
+	}
+
+	if c.SASL != nil {
+		saramaCfg.Net.SASL.Enable = true
+		saramaCfg.Net.SASL.User = c.SASL.Username
+		saramaCfg.Net.SASL.Password = c.SASL.Password
+		switch strings.ToUpper(c.SASL.Mechanism) {
+		case "", sarama.SASLTypePlaintext:
+			saramaCfg.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		case sarama.SASLTypeSCRAMSHA256:
+			saramaCfg.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+			saramaCfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &kafkaSCRAMClient{HashGeneratorFcn: scram.SHA256}
+			}
+		case sarama.SASLTypeSCRAMSHA512:
+			saramaCfg.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+			saramaCfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &kafkaSCRAMClient{HashGeneratorFcn: scram.SHA512}
+			}
+		default:
+			return nil, fmt.Errorf("sasl mechanism %s is not supported", c.SASL.Mechanism)
+		}
+	}
+
+	return saramaCfg, saramaCfg.Validate()
+}
+
+// kafkaSCRAMClient implements sarama.SCRAMClient.
+type kafkaSCRAMClient struct {
+	*scram.ClientConversation
+	scram.HashGeneratorFcn
+}
+
+func (c *kafkaSCRAMClient) Begin(userName, password, authzID string) error {
+	client, err := c.HashGeneratorFcn.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.ClientConversation = client.NewConversation()
+	return nil
+}
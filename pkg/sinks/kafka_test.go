@@ -0,0 +1,71 @@
+package sinks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKafkaSend(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("k8s-events", 0, broker.BrokerID()),
+		"ProduceRequest": sarama.NewMockProduceResponse(t),
+	})
+
+	sink, err := NewKafkaSink(map[string]interface{}{
+		"brokers":      []interface{}{broker.Addr()},
+		"topic":        "k8s-events",
+		"version":      "2.1.0",
+		"compression":  "gzip",
+		"requiredAcks": "all",
+		"batch":        map[string]interface{}{"messages": 2, "interval": "1h"},
+		"layout":       map[string]interface{}{"reason": "{{ .Reason }}", "cluster": "{{ .InvolvedObject.ClusterName }}"},
+	})
+	require.NoError(t, err)
+
+	k := sink.(*kafka)
+	msg, err := k.buildMessage(buildTestEvent("nginx.backoff", "BackOff", 1))
+	require.NoError(t, err)
+	key, _ := msg.Key.Encode()
+	require.Equal(t, "test/default/nginx", string(key))
+	value, _ := msg.Value.Encode()
+	require.JSONEq(t, `{"reason":"BackOff","cluster":"test"}`, string(value))
+
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.1", "BackOff", 1)))
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.2", "BackOff", 1)))
+	require.Eventually(t, func() bool {
+		for _, rr := range broker.History() {
+			if _, ok := rr.Request.(*sarama.ProduceRequest); ok {
+				return true
+			}
+		}
+		return false
+	}, time.Second*5, time.Millisecond*10)
+	sink.Close()
+}
+
+func TestKafkaConfigValidate(t *testing.T) {
+	_, err := NewKafkaSink(map[string]interface{}{"brokers": []interface{}{"127.0.0.1:9092"}})
+	require.Error(t, err)
+
+	_, err = NewKafkaSink(map[string]interface{}{
+		"brokers":     []interface{}{"127.0.0.1:9092"},
+		"topic":       "k8s-events",
+		"compression": "brotli",
+	})
+	require.Error(t, err)
+
+	_, err = NewKafkaSink(map[string]interface{}{
+		"brokers": []interface{}{"127.0.0.1:9092"},
+		"topic":   "k8s-events",
+		"sasl":    map[string]interface{}{"mechanism": "GSSAPI"},
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,285 @@
+package sinks
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/champly/eventexporter/pkg/kube"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+const (
+	KubernetesSinkName = "kubernetes"
+
+	kubernetesClusterLabel   = "eventexporter.io/cluster"
+	kubernetesNamespaceLabel = "eventexporter.io/namespace"
+	// kubernetesSourceCountsAnnotation is the JSON of source event UID to the count
+	// aggregated from it.
+	kubernetesSourceCountsAnnotation = "eventexporter.io/source-counts"
+
+	defaultKubernetesNamespace = "eventexporter"
+	defaultKubernetesTTL       = time.Hour
+	maxKubernetesGCInterval    = time.Minute * 10
+	// maxKubernetesSourceUIDs limits the source counts, the source events expire with
+	// --event-ttl of kube-apiserver, so the old ones are rarely updated again.
+	maxKubernetesSourceUIDs = 32
+)
+
+func init() {
+	factory[KubernetesSinkName] = NewKubernetesSink
+}
+
+type kubernetesConfig struct {
+	// Namespace is the namespace of manager plane which the events are written to.
+	Namespace string `yaml:"namespace"`
+	// Message is the template of event message, default is the origin message.
+	Message string `yaml:"message"`
+	// Labels are the templates of extra event labels.
+	Labels map[string]string `yaml:"labels"`
+	// TTL deletes the events which don't recur within it, the events are also
+	// deleted by --event-ttl of kube-apiserver.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// kubernetesSink re-emits events into a namespace of manager plane, the events of the
+// same object, type and reason are aggregated to one event.
+type kubernetesSink struct {
+	*kubernetesConfig
+	cli    kubernetes.Interface
+	stopCh chan struct{}
+	done   chan struct{}
+}
+
+func NewKubernetesSink(cfg interface{}) (Sink, error) {
+	if kube.ManagerPlaneClusterClient == nil {
+		return nil, fmt.Errorf("init receiver %s, manager plane client is not initialized", KubernetesSinkName)
+	}
+	return newKubernetesSink(cfg, kube.ManagerPlaneClusterClient.GetKubeInterface())
+}
+
+func newKubernetesSink(cfg interface{}, cli kubernetes.Interface) (*kubernetesSink, error) {
+	k8sCfg := &kubernetesConfig{}
+	if err := unmarshalConfig(KubernetesSinkName, cfg, k8sCfg); err != nil {
+		return nil, err
+	}
+	if k8sCfg.Namespace == "" {
+		k8sCfg.Namespace = defaultKubernetesNamespace
+	}
+	if k8sCfg.Message == "" {
+		k8sCfg.Message = "{{ .Message }}"
+	}
+	if k8sCfg.TTL <= 0 {
+		k8sCfg.TTL = defaultKubernetesTTL
+	}
+
+	k := &kubernetesSink{
+		kubernetesConfig: k8sCfg,
+		cli:              cli,
+		stopCh:           make(chan struct{}),
+		done:             make(chan struct{}),
+	}
+	go k.gcLoop()
+	klog.Infof("Kubernetes sink namespace: %s", k8sCfg.Namespace)
+	return k, nil
+}
+
+func (k *kubernetesSink) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	if ev.Labels[kubernetesClusterLabel] != "" {
+		// re-emitted by eventexporter, the manager plane is also a member cluster.
+		return nil
+	}
+
+	message, err := getLayoutString(ev, k.Message)
+	if err != nil {
+		return fmt.Errorf("render message failed: %v", err)
+	}
+	labels := getLayoutLabels(ev, k.Labels)
+	labels[kubernetesClusterLabel] = ev.InvolvedObject.ClusterName
+	labels[kubernetesNamespaceLabel] = ev.Event.InvolvedObject.Namespace
+	for key, value := range labels {
+		if len(validation.IsValidLabelValue(value)) > 0 {
+			klog.V(4).Infof("Receiver %s drop invalid label %s=%s.", KubernetesSinkName, key, value)
+			delete(labels, key)
+		}
+	}
+
+	name := kubernetesEventName(ev)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		target, err := k.cli.CoreV1().Events(k.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			target, err = k.buildEvent(ev, name, message, labels)
+			if err != nil {
+				return err
+			}
+			_, err = k.cli.CoreV1().Events(k.Namespace).Create(ctx, target, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// created concurrently, retry with update.
+				return apierrors.NewConflict(corev1.Resource("events"), name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		counts := kubernetesSourceCounts(target.Annotations)
+		delta := ev.Count - counts[string(ev.UID)]
+		if delta <= 0 {
+			return nil
+		}
+		counts[string(ev.UID)] = ev.Count
+		annotations, err := kubernetesSourceAnnotations(counts, string(ev.UID))
+		if err != nil {
+			return err
+		}
+
+		target.Count += delta
+		target.Message = message
+		target.Labels = labels
+		target.Annotations = annotations
+		if ts := metav1.NewTime(ev.GetLastTimestamp()); ts.After(target.LastTimestamp.Time) {
+			target.LastTimestamp = ts
+		}
+		_, err = k.cli.CoreV1().Events(k.Namespace).Update(ctx, target, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func (k *kubernetesSink) Close() {
+	close(k.stopCh)
+	<-k.done
+}
+
+func (k *kubernetesSink) buildEvent(ev *kube.EnhancedEvent, name, message string, labels map[string]string) (*corev1.Event, error) {
+	annotations, err := kubernetesSourceAnnotations(map[string]int32{string(ev.UID): ev.Count}, string(ev.UID))
+	if err != nil {
+		return nil, err
+	}
+	ref := ev.Event.InvolvedObject
+	// the namespace of event must be the same as the involved object.
+	ref.Namespace = k.Namespace
+
+	first := ev.FirstTimestamp
+	if first.IsZero() {
+		first = metav1.NewTime(ev.GetLastTimestamp())
+	}
+	return &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   k.Namespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		InvolvedObject:      ref,
+		Reason:              ev.Reason,
+		Message:             message,
+		Source:              ev.Source,
+		FirstTimestamp:      first,
+		LastTimestamp:       metav1.NewTime(ev.GetLastTimestamp()),
+		Count:               ev.Count,
+		Type:                ev.Type,
+		ReportingController: ev.ReportingController,
+		ReportingInstance:   ev.ReportingInstance,
+	}, nil
+}
+
+func (k *kubernetesSink) gcLoop() {
+	defer close(k.done)
+
+	interval := k.TTL / 2
+	if interval > maxKubernetesGCInterval {
+		interval = maxKubernetesGCInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k.stopCh:
+			return
+		case <-ticker.C:
+			if err := k.gc(context.Background()); err != nil {
+				klog.Errorf("Receiver %s gc events failed: %+v", KubernetesSinkName, err)
+			}
+		}
+	}
+}
+
+// gc deletes the re-emitted events which are not updated within ttl.
+func (k *kubernetesSink) gc(ctx context.Context) error {
+	list, err := k.cli.CoreV1().Events(k.Namespace).List(ctx, metav1.ListOptions{LabelSelector: kubernetesClusterLabel})
+	if err != nil {
+		return err
+	}
+	for i := range list.Items {
+		ev := &list.Items[i]
+		if time.Since(ev.LastTimestamp.Time) <= k.TTL {
+			continue
+		}
+		err = k.cli.CoreV1().Events(k.Namespace).Delete(ctx, ev.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		klog.V(4).Infof("Receiver %s delete expired event %s/%s.", KubernetesSinkName, ev.Namespace, ev.Name)
+	}
+	return nil
+}
+
+// kubernetesSourceCounts returns the counts aggregated from every source event.
+func kubernetesSourceCounts(annotations map[string]string) map[string]int32 {
+	counts := map[string]int32{}
+	if v, ok := annotations[kubernetesSourceCountsAnnotation]; ok {
+		if err := json.Unmarshal([]byte(v), &counts); err != nil {
+			klog.Warningf("Receiver %s ignore invalid annotation %s=%s: %v", KubernetesSinkName, kubernetesSourceCountsAnnotation, v, err)
+		}
+	}
+	return counts
+}
+
+// kubernetesSourceAnnotations encodes the source counts, the smallest counts except the
+// current source are dropped when there are too many sources.
+func kubernetesSourceAnnotations(counts map[string]int32, current string) (map[string]string, error) {
+	for len(counts) > maxKubernetesSourceUIDs {
+		oldest := ""
+		for uid, count := range counts {
+			if uid != current && (oldest == "" || count < counts[oldest] || count == counts[oldest] && uid < oldest) {
+				oldest = uid
+			}
+		}
+		delete(counts, oldest)
+	}
+	b, err := json.Marshal(counts)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{kubernetesSourceCountsAnnotation: string(b)}, nil
+}
+
+// kubernetesEventName is <cluster>.<object>.<hash of cluster, object, type and reason>.
+func kubernetesEventName(ev *kube.EnhancedEvent) string {
+	ref := ev.Event.InvolvedObject
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		ev.InvolvedObject.ClusterName, ref.Kind, ref.Namespace, ref.Name, string(ref.UID), ev.Type, ev.Reason,
+	}, "/")))
+	hash := hex.EncodeToString(sum[:8])
+
+	prefix := strings.ToLower(strings.Trim(ev.InvolvedObject.ClusterName+"."+ref.Name, "."))
+	if maxLen := validation.DNS1123SubdomainMaxLength - len(hash) - 1; len(prefix) > maxLen {
+		prefix = strings.TrimRight(prefix[:maxLen], ".-")
+	}
+	if prefix == "" {
+		return hash
+	}
+	return prefix + "." + hash
+}
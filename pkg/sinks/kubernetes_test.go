@@ -0,0 +1,115 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestKubernetesAggregateAndGC(t *testing.T) {
+	cli := fake.NewSimpleClientset()
+	sink, err := newKubernetesSink(map[string]interface{}{
+		"namespace": "events",
+		"message":   "[{{ .InvolvedObject.ClusterName }}] {{ .Message }}",
+		"labels":    map[string]interface{}{"app": "{{ .InvolvedObject.Labels.app }}"},
+		"ttl":       "1h",
+	}, cli)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	ev := buildTestEvent("nginx.backoff", "BackOff", 1)
+	ev.UID = "event-1"
+	ev.Message = "Back-off restarting failed container"
+	ev.InvolvedObject.Labels = map[string]string{"app": "nginx"}
+	require.NoError(t, sink.Send(context.TODO(), ev))
+	// not increased
+	require.NoError(t, sink.Send(context.TODO(), ev))
+	ev.Count = 3
+	require.NoError(t, sink.Send(context.TODO(), ev))
+	// a new source event of the same object and reason
+	ev.UID = "event-2"
+	ev.Count = 2
+	require.NoError(t, sink.Send(context.TODO(), ev))
+
+	list, err := cli.CoreV1().Events("events").List(context.TODO(), metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1)
+	target := list.Items[0]
+	require.Equal(t, kubernetesEventName(ev), target.Name)
+	require.Equal(t, int32(5), target.Count)
+	require.Equal(t, "[test] Back-off restarting failed container", target.Message)
+	require.Equal(t, "events", target.InvolvedObject.Namespace)
+	require.Equal(t, "nginx", target.InvolvedObject.Name)
+	require.Equal(t, map[string]string{kubernetesClusterLabel: "test", kubernetesNamespaceLabel: "default", "app": "nginx"}, target.Labels)
+
+	// the re-emitted event is not re-emitted again
+	reemitted := buildTestEvent(target.Name, "BackOff", 1)
+	reemitted.Labels = target.Labels
+	reemitted.InvolvedObject.ClusterName = "manager"
+	require.NoError(t, sink.Send(context.TODO(), reemitted))
+
+	// another reason is another event, it's expired.
+	started := buildTestEvent("nginx.started", "Started", 1)
+	started.LastTimestamp = metav1.NewTime(time.Now().Add(-time.Hour * 2))
+	require.NoError(t, sink.Send(context.TODO(), started))
+
+	require.NoError(t, sink.gc(context.TODO()))
+	list, err = cli.CoreV1().Events("events").List(context.TODO(), metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1)
+	require.Equal(t, "BackOff", list.Items[0].Reason)
+}
+
+func TestKubernetesAlternateSources(t *testing.T) {
+	cli := fake.NewSimpleClientset()
+	sink, err := newKubernetesSink(map[string]interface{}{"namespace": "events"}, cli)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	// two source events of the same object and reason are updated in turn.
+	kubelet := buildTestEvent("nginx.backoff.1", "BackOff", 1)
+	kubelet.UID = "event-1"
+	controller := buildTestEvent("nginx.backoff.2", "BackOff", 1)
+	controller.UID = "event-2"
+	for i := int32(1); i <= 3; i++ {
+		kubelet.Count = i
+		require.NoError(t, sink.Send(context.TODO(), kubelet))
+		controller.Count = i
+		require.NoError(t, sink.Send(context.TODO(), controller))
+	}
+	// the repeated count of the first source is not counted again.
+	require.NoError(t, sink.Send(context.TODO(), kubelet))
+
+	target, err := cli.CoreV1().Events("events").Get(context.TODO(), kubernetesEventName(kubelet), metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, int32(6), target.Count)
+	require.JSONEq(t, `{"event-1":3,"event-2":3}`, target.Annotations[kubernetesSourceCountsAnnotation])
+}
+
+func TestKubernetesSourceCounts(t *testing.T) {
+	counts := map[string]int32{"current": 1}
+	for i := 0; i < maxKubernetesSourceUIDs; i++ {
+		counts[fmt.Sprintf("event-%d", i)] = int32(i + 1)
+	}
+	annotations, err := kubernetesSourceAnnotations(counts, "current")
+	require.NoError(t, err)
+	counts = kubernetesSourceCounts(annotations)
+	require.Len(t, counts, maxKubernetesSourceUIDs)
+	require.Contains(t, counts, "current")
+	require.NotContains(t, counts, "event-0")
+}
+
+func TestKubernetesEventName(t *testing.T) {
+	ev := buildTestEvent("nginx.backoff", "BackOff", 1)
+	name := kubernetesEventName(ev)
+	require.Regexp(t, `^test\.nginx\.[0-9a-f]{16}$`, name)
+
+	ev.Event.InvolvedObject.Name = strings.Repeat("a", 300)
+	require.LessOrEqual(t, len(kubernetesEventName(ev)), 253)
+}
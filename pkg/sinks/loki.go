@@ -0,0 +1,300 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/champly/eventexporter/pkg/kube"
+	"k8s.io/klog/v2"
+)
+
+const (
+	LokiSinkName = "loki"
+
+	lokiPushPath              = "/loki/api/v1/push"
+	defaultLokiBatchSize      = 1000
+	defaultLokiBatchInterval  = time.Second
+	defaultLokiTimeout        = time.Second * 10
+	defaultLokiRetry          = 3
+	lokiQueueCapacity         = 10
+	lokiStreamTimestampExpire = time.Hour
+)
+
+var (
+	// defaultLokiLabelLayout keeps stream labels low cardinality, the event name and
+	// message are in the log line.
+	defaultLokiLabelLayout = map[string]string{
+		"job":       "eventexporter",
+		"cluster":   "{{ .InvolvedObject.ClusterName }}",
+		"namespace": "{{ .Namespace }}",
+		"type":      "{{ .Type }}",
+		"kind":      "{{ .Event.InvolvedObject.Kind }}",
+		"reason":    "{{ .Reason }}",
+	}
+
+	invalidLokiLabelRegexp = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+func init() {
+	factory[LokiSinkName] = NewLokiSink
+}
+
+type lokiConfig struct {
+	// URL is the address of loki, e.g. http://loki:3100, the push path is appended.
+	URL string `yaml:"url"`
+	// TenantID is the template of X-Scope-OrgID header for multi-tenant loki.
+	TenantID string `yaml:"tenantID"`
+	// LabelLayout overrides the default stream labels, empty value keeps the default.
+	LabelLayout map[string]string `yaml:"labelLayout"`
+	// LineTemplate is the template of log line, Layout is used when it's empty.
+	LineTemplate string `yaml:"lineTemplate"`
+	// Layout is the JSON layout of log line, the whole event is used when it's empty.
+	Layout           map[string]interface{} `yaml:"layout"`
+	HTTPClientConfig httpClientConfig       `yaml:",inline"`
+	BatchSize        int                    `yaml:"batchSize"`
+	BatchInterval    time.Duration          `yaml:"batchInterval"`
+	Timeout          time.Duration          `yaml:"timeout"`
+	MaxRetries       *int                   `yaml:"maxRetries"`
+}
+
+type loki struct {
+	*lokiConfig
+	client     *http.Client
+	maxRetries int
+	batcher    *batcher[*lokiEntry]
+
+	// lastTimestamps records the last pushed timestamp of every stream, loki
+	// rejects out of order entries within a stream.
+	lastTimestamps map[string]time.Time
+	sync.Mutex
+}
+
+type lokiEntry struct {
+	tenant    string
+	streamKey string
+	labels    map[string]string
+	ts        time.Time
+	line      string
+}
+
+type lokiPushRequest struct {
+	Streams []*lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func NewLokiSink(cfg interface{}) (Sink, error) {
+	lokiCfg := &lokiConfig{}
+	if err := unmarshalConfig(LokiSinkName, cfg, lokiCfg); err != nil {
+		return nil, err
+	}
+	if lokiCfg.URL == "" {
+		return nil, fmt.Errorf("init receiver %s, url must be set", LokiSinkName)
+	}
+	lokiCfg.URL = strings.TrimSuffix(lokiCfg.URL, "/")
+	if !strings.HasSuffix(lokiCfg.URL, lokiPushPath) {
+		lokiCfg.URL += lokiPushPath
+	}
+	if lokiCfg.BatchSize <= 0 {
+		lokiCfg.BatchSize = defaultLokiBatchSize
+	}
+	if lokiCfg.BatchInterval <= 0 {
+		lokiCfg.BatchInterval = defaultLokiBatchInterval
+	}
+	if lokiCfg.Timeout <= 0 {
+		lokiCfg.Timeout = defaultLokiTimeout
+	}
+
+	client, err := lokiCfg.HTTPClientConfig.newHTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s http client failed: %v", LokiSinkName, err)
+	}
+
+	l := &loki{
+		lokiConfig:     lokiCfg,
+		client:         client,
+		maxRetries:     defaultLokiRetry,
+		lastTimestamps: map[string]time.Time{},
+	}
+	if lokiCfg.MaxRetries != nil {
+		l.maxRetries = *lokiCfg.MaxRetries
+	}
+	l.batcher = newBatcher(lokiCfg.BatchSize, lokiCfg.BatchInterval, lokiCfg.BatchSize*lokiQueueCapacity, l.flush)
+	klog.Infof("Loki url: %s", lokiCfg.URL)
+	return l, nil
+}
+
+// Send queues the event as a log entry of its stream.
+func (l *loki) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	entry, err := l.buildEntry(ev)
+	if err != nil {
+		return err
+	}
+	return l.batcher.add(entry)
+}
+
+// Close flushes the queued entries.
+func (l *loki) Close() {
+	l.batcher.stop()
+}
+
+func (l *loki) buildEntry(ev *kube.EnhancedEvent) (*lokiEntry, error) {
+	var (
+		line string
+		err  error
+	)
+	if l.LineTemplate != "" {
+		line, err = getLayoutString(ev, l.LineTemplate)
+	} else {
+		var b []byte
+		b, err = serializeEventWithLayout(l.Layout, ev)
+		line = string(b)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tenant string
+	if l.TenantID != "" {
+		if tenant, err = getLayoutString(ev, l.TenantID); err != nil {
+			return nil, err
+		}
+	}
+
+	labels := map[string]string{}
+	for k, v := range getLayoutLabels(ev, defaultLokiLabelLayout, l.LabelLayout) {
+		labels[invalidLokiLabelRegexp.ReplaceAllString(k, "_")] = v
+	}
+
+	ts := ev.GetLastTimestamp()
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	return &lokiEntry{
+		tenant:    tenant,
+		streamKey: lokiStreamKey(tenant, labels),
+		labels:    labels,
+		ts:        ts,
+		line:      line,
+	}, nil
+}
+
+// flush groups the entries by tenant and stream, every tenant is pushed with one request.
+func (l *loki) flush(entries []*lokiEntry) {
+	tenants := map[string]map[string]*lokiStream{}
+	streamEntries := map[string][]*lokiEntry{}
+	for _, entry := range entries {
+		if _, ok := tenants[entry.tenant]; !ok {
+			tenants[entry.tenant] = map[string]*lokiStream{}
+		}
+		if _, ok := tenants[entry.tenant][entry.streamKey]; !ok {
+			tenants[entry.tenant][entry.streamKey] = &lokiStream{Stream: entry.labels}
+		}
+		streamEntries[entry.streamKey] = append(streamEntries[entry.streamKey], entry)
+	}
+
+	l.Lock()
+	for key, es := range streamEntries {
+		// the order of entries within a stream must be kept, an entry older than
+		// the last pushed one is moved just after it.
+		sort.SliceStable(es, func(i, j int) bool { return es[i].ts.Before(es[j].ts) })
+		last := l.lastTimestamps[key]
+		stream := tenants[es[0].tenant][key]
+		for _, entry := range es {
+			ts := entry.ts
+			if !ts.After(last) {
+				ts = last.Add(time.Nanosecond)
+			}
+			last = ts
+			stream.Values = append(stream.Values, [2]string{strconv.FormatInt(ts.UnixNano(), 10), entry.line})
+		}
+		l.lastTimestamps[key] = last
+	}
+	for key, ts := range l.lastTimestamps {
+		if time.Since(ts) > lokiStreamTimestampExpire {
+			delete(l.lastTimestamps, key)
+		}
+	}
+	l.Unlock()
+
+	for tenant, streams := range tenants {
+		req := &lokiPushRequest{}
+		for _, stream := range streams {
+			req.Streams = append(req.Streams, stream)
+		}
+		err := sendWithRetry(context.Background(), l.maxRetries, func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, l.Timeout)
+			defer cancel()
+			return l.push(ctx, tenant, req)
+		})
+		if err != nil {
+			klog.Errorf("Receiver %s push %d streams of tenant %q failed: %+v", LokiSinkName, len(req.Streams), tenant, err)
+			continue
+		}
+		klog.V(4).Infof("Receiver %s push %d streams of tenant %q success.", LokiSinkName, len(req.Streams), tenant)
+	}
+}
+
+func (l *loki) push(ctx context.Context, tenant string, pr *lokiPushRequest) error {
+	body, err := json.Marshal(pr)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if tenant != "" {
+		req.Header.Set("X-Scope-OrgID", tenant)
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return newNetworkError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		return newStatusError(resp.StatusCode, errors.New(string(b)))
+	}
+	return nil
+}
+
+// lokiStreamKey identifies a stream of tenant with sorted labels.
+func lokiStreamKey(tenant string, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b := &strings.Builder{}
+	b.WriteString(tenant)
+	b.WriteString("{")
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(k)
+		b.WriteString("=")
+		b.WriteString(strconv.Quote(labels[k]))
+	}
+	b.WriteString("}")
+	return b.String()
+}
@@ -0,0 +1,66 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLokiPushOrdered(t *testing.T) {
+	server := newRecordingServer(func(rw http.ResponseWriter, req *recordedRequest) {
+		rw.WriteHeader(http.StatusNoContent)
+	})
+	defer server.Close()
+
+	sink, err := NewLokiSink(map[string]interface{}{
+		"url":           server.URL,
+		"tenantID":      "{{ .InvolvedObject.ClusterName }}",
+		"labelLayout":   map[string]interface{}{"app.name": "{{ .Event.InvolvedObject.Name }}"},
+		"lineTemplate":  "{{ .Reason }} {{ .Message }}",
+		"batchSize":     3,
+		"batchInterval": "1h",
+	})
+	require.NoError(t, err)
+
+	now := time.Now()
+	for i, offset := range []time.Duration{time.Second, 0, time.Second} {
+		ev := buildTestEvent("nginx."+strconv.Itoa(i), "BackOff", 1)
+		ev.Message = strconv.Itoa(i)
+		ev.LastTimestamp.Time = now.Add(offset)
+		require.NoError(t, sink.Send(context.TODO(), ev))
+	}
+	require.Eventually(t, func() bool { return server.count() == 1 }, time.Second*5, time.Millisecond*10)
+
+	// an older entry of the same stream in the next batch is moved after the last one
+	ev := buildTestEvent("nginx.3", "BackOff", 1)
+	ev.Message = "3"
+	ev.LastTimestamp.Time = now
+	require.NoError(t, sink.Send(context.TODO(), ev))
+	sink.Close()
+
+	pushes := []lokiPushRequest{}
+	for _, req := range server.requests() {
+		require.Equal(t, lokiPushPath, req.URL.Path)
+		require.Equal(t, "test", req.Header.Get("X-Scope-OrgID"))
+		pr := lokiPushRequest{}
+		require.NoError(t, json.Unmarshal(req.Body, &pr))
+		pushes = append(pushes, pr)
+	}
+	require.Len(t, pushes, 2)
+	require.Len(t, pushes[0].Streams, 1)
+	stream := pushes[0].Streams[0]
+	require.Equal(t, "nginx", stream.Stream["app_name"])
+	require.Equal(t, "test", stream.Stream["cluster"])
+	require.Equal(t, "BackOff 1", stream.Values[0][1])
+	require.Equal(t, "BackOff 0", stream.Values[1][1])
+	require.Equal(t, "BackOff 2", stream.Values[2][1])
+
+	last, _ := strconv.ParseInt(stream.Values[2][0], 10, 64)
+	next, _ := strconv.ParseInt(pushes[1].Streams[0].Values[0][0], 10, 64)
+	require.Equal(t, last+1, next)
+}
@@ -0,0 +1,155 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/champly/eventexporter/pkg/kube"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"k8s.io/klog/v2"
+)
+
+const (
+	MQTTSinkName = "mqtt"
+
+	defaultMQTTQoS           = 1
+	defaultMQTTTimeout       = time.Second * 10
+	defaultMQTTReconnectWait = time.Second * 10
+	defaultMQTTRetry         = 2
+)
+
+func init() {
+	factory[MQTTSinkName] = NewMQTTSink
+}
+
+type mqttConfig struct {
+	// Brokers are the broker urls, e.g. tcp://mosquitto:1883, ssl://mosquitto:8883 or ws://mosquitto:80/mqtt.
+	Brokers []string `yaml:"brokers"`
+	// Topic is the template of topic.
+	Topic string `yaml:"topic"`
+	// Layout is the message layout, the whole event is sent when it's empty.
+	Layout map[string]interface{} `yaml:"layout"`
+	// ClientID default is eventexporter-<hostname>.
+	ClientID  string     `yaml:"clientId"`
+	Username  string     `yaml:"username"`
+	Password  string     `yaml:"password"`
+	TLSConfig *tlsConfig `yaml:"tlsConfig"`
+	// QoS is 0, 1 (default) or 2.
+	QoS      *int `yaml:"qos"`
+	Retained bool `yaml:"retained"`
+	// ReconnectWait is the max wait between reconnect attempts.
+	ReconnectWait time.Duration `yaml:"reconnectWait"`
+	Timeout       time.Duration `yaml:"timeout"`
+	MaxRetries    *int          `yaml:"maxRetries"`
+}
+
+type mqttSink struct {
+	*mqttConfig
+	client     mqtt.Client
+	qos        byte
+	maxRetries int
+}
+
+func NewMQTTSink(cfg interface{}) (Sink, error) {
+	mqttCfg := &mqttConfig{}
+	if err := unmarshalConfig(MQTTSinkName, cfg, mqttCfg); err != nil {
+		return nil, err
+	}
+	if len(mqttCfg.Brokers) == 0 || mqttCfg.Topic == "" {
+		return nil, fmt.Errorf("init receiver %s, brokers and topic must be set", MQTTSinkName)
+	}
+	m := &mqttSink{mqttConfig: mqttCfg, qos: defaultMQTTQoS, maxRetries: defaultMQTTRetry}
+	if mqttCfg.QoS != nil {
+		if *mqttCfg.QoS < 0 || *mqttCfg.QoS > 2 {
+			return nil, fmt.Errorf("init receiver %s, qos %d not supported", MQTTSinkName, *mqttCfg.QoS)
+		}
+		m.qos = byte(*mqttCfg.QoS)
+	}
+	if mqttCfg.MaxRetries != nil {
+		m.maxRetries = *mqttCfg.MaxRetries
+	}
+	if mqttCfg.ClientID == "" {
+		hostname, _ := os.Hostname()
+		mqttCfg.ClientID = "eventexporter-" + hostname
+	}
+	if mqttCfg.ReconnectWait <= 0 {
+		mqttCfg.ReconnectWait = defaultMQTTReconnectWait
+	}
+	if mqttCfg.Timeout <= 0 {
+		mqttCfg.Timeout = defaultMQTTTimeout
+	}
+
+	opts := mqtt.NewClientOptions().
+		SetClientID(mqttCfg.ClientID).
+		SetUsername(mqttCfg.Username).
+		SetPassword(mqttCfg.Password).
+		SetConnectTimeout(mqttCfg.Timeout).
+		SetWriteTimeout(mqttCfg.Timeout).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(mqttCfg.ReconnectWait).
+		// the exporter starts when broker is unavailable.
+		SetConnectRetry(true).
+		SetConnectRetryInterval(mqttCfg.ReconnectWait).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			klog.Warningf("Receiver %s connection lost: %v", MQTTSinkName, err)
+		}).
+		SetOnConnectHandler(func(mqtt.Client) {
+			klog.Infof("Receiver %s connected", MQTTSinkName)
+		})
+	for _, broker := range mqttCfg.Brokers {
+		opts.AddBroker(broker)
+	}
+	if mqttCfg.TLSConfig != nil {
+		tlsCfg, err := mqttCfg.TLSConfig.build()
+		if err != nil {
+			return nil, fmt.Errorf("init receiver %s tls config failed: %v", MQTTSinkName, err)
+		}
+		opts.SetTLSConfig(tlsCfg)
+	}
+
+	m.client = mqtt.NewClient(opts)
+	// with connect retry the token completes when connected, don't wait for it.
+	m.client.Connect()
+	klog.Infof("MQTT brokers: %s, topic: %s", strings.Join(mqttCfg.Brokers, ","), mqttCfg.Topic)
+	return m, nil
+}
+
+func (m *mqttSink) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	topic, err := getLayoutString(ev, m.Topic)
+	if err != nil {
+		return fmt.Errorf("render topic failed: %v", err)
+	}
+	if topic = strings.TrimSpace(topic); topic == "" || strings.ContainsAny(topic, "+#") {
+		return fmt.Errorf("topic %q of %s/%s is invalid", topic, ev.Namespace, ev.Name)
+	}
+	payload, err := serializeEventWithLayout(m.Layout, ev)
+	if err != nil {
+		return err
+	}
+
+	return sendWithRetry(ctx, m.maxRetries, func(ctx context.Context) error {
+		if !m.client.IsConnectionOpen() {
+			return newNetworkError(mqtt.ErrNotConnected)
+		}
+		token := m.client.Publish(topic, m.qos, m.Retained, payload)
+		select {
+		case <-token.Done():
+		case <-time.After(m.Timeout):
+			return newNetworkError(fmt.Errorf("publish to %s timeout", topic))
+		case <-ctx.Done():
+			return newNetworkError(ctx.Err())
+		}
+		if err := token.Error(); err != nil {
+			return newNetworkError(err)
+		}
+		return nil
+	})
+}
+
+// Close waits the in-flight messages to be acknowledged.
+func (m *mqttSink) Close() {
+	m.client.Disconnect(uint(m.Timeout.Milliseconds()))
+}
@@ -0,0 +1,117 @@
+package sinks
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMQTTMsg struct {
+	topic   string
+	qos     byte
+	retain  bool
+	payload string
+}
+
+// fakeMQTTBroker is the embedded mochi broker recording the publishes, it's restarted on
+// the same address after stopped.
+type fakeMQTTBroker struct {
+	mqtt.HookBase
+	*mqtt.Server
+	addr string
+	sync.Mutex
+	msgs []*fakeMQTTMsg
+}
+
+func newFakeMQTTBroker(t *testing.T) *fakeMQTTBroker {
+	// the listener of broker doesn't expose the bound address.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	b := &fakeMQTTBroker{addr: lis.Addr().String()}
+	lis.Close()
+	b.start(t)
+	return b
+}
+
+func (b *fakeMQTTBroker) start(t *testing.T) {
+	logger := zerolog.Nop()
+	b.Server = mqtt.New(&mqtt.Options{Logger: &logger})
+	require.NoError(t, b.AddHook(new(auth.AllowHook), nil))
+	require.NoError(t, b.AddHook(b, nil))
+	require.NoError(t, b.AddListener(listeners.NewTCP("tcp", b.addr, nil)))
+	require.NoError(t, b.Serve())
+}
+
+// stop closes the broker and the client connections.
+func (b *fakeMQTTBroker) stop() {
+	b.Server.Close()
+}
+
+func (b *fakeMQTTBroker) ID() string {
+	return "recorder"
+}
+
+func (b *fakeMQTTBroker) Provides(hook byte) bool {
+	return hook == mqtt.OnPublish
+}
+
+// OnPublish records the publish before it's acknowledged.
+func (b *fakeMQTTBroker) OnPublish(cl *mqtt.Client, pk packets.Packet) (packets.Packet, error) {
+	b.Lock()
+	defer b.Unlock()
+	b.msgs = append(b.msgs, &fakeMQTTMsg{topic: pk.TopicName, qos: pk.FixedHeader.Qos, retain: pk.FixedHeader.Retain, payload: string(pk.Payload)})
+	return pk, nil
+}
+
+func (b *fakeMQTTBroker) received() []*fakeMQTTMsg {
+	b.Lock()
+	defer b.Unlock()
+	return append([]*fakeMQTTMsg{}, b.msgs...)
+}
+
+func TestMQTTReconnect(t *testing.T) {
+	broker := newFakeMQTTBroker(t)
+	defer broker.stop()
+
+	sink, err := NewMQTTSink(map[string]interface{}{
+		"brokers":       []interface{}{"tcp://" + broker.addr},
+		"topic":         "events/{{ .InvolvedObject.ClusterName }}/{{ .Event.InvolvedObject.Namespace }}",
+		"layout":        map[string]interface{}{"reason": "{{ .Reason }}"},
+		"retained":      true,
+		"reconnectWait": "100ms",
+		"maxRetries":    0,
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	m := sink.(*mqttSink)
+	require.Eventually(t, m.client.IsConnectionOpen, time.Second*5, time.Millisecond*20)
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)))
+	msgs := broker.received()
+	require.Len(t, msgs, 1)
+	require.Equal(t, &fakeMQTTMsg{topic: "events/test/default", qos: 1, retain: true, payload: `{"reason":"BackOff"}`}, msgs[0])
+
+	broker.stop()
+	require.Eventually(t, func() bool { return !m.client.IsConnectionOpen() }, time.Second*5, time.Millisecond*20)
+	err = sink.Send(context.TODO(), buildTestEvent("nginx.started", "Started", 1))
+	require.Error(t, err)
+	require.True(t, IsRetryable(err))
+
+	broker.start(t)
+	require.Eventually(t, m.client.IsConnectionOpen, time.Second*10, time.Millisecond*20)
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.started", "Started", 1)))
+	require.Len(t, broker.received(), 2)
+
+	ev := buildTestEvent("nginx.started", "Started", 1)
+	ev.InvolvedObject.ClusterName = "+"
+	require.Error(t, sink.Send(context.TODO(), ev))
+}
@@ -0,0 +1,203 @@
+package sinks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/champly/eventexporter/pkg/kube"
+	"github.com/nats-io/nats.go"
+	"k8s.io/klog/v2"
+)
+
+const (
+	NATSSinkName = "nats"
+
+	defaultNATSReconnectWait = time.Second * 2
+	defaultNATSTimeout       = time.Second * 5
+	defaultNATSRetry         = 2
+)
+
+func init() {
+	factory[NATSSinkName] = NewNATSSink
+}
+
+type natsConfig struct {
+	// Servers are the nats urls, e.g. nats://nats:4222.
+	Servers []string `yaml:"servers"`
+	// Subject is the template of subject.
+	Subject string `yaml:"subject"`
+	// Layout is the message layout, the whole event is sent when it's empty.
+	Layout map[string]interface{} `yaml:"layout"`
+	// Headers are the templates of message headers.
+	Headers   map[string]string `yaml:"headers"`
+	Name      string            `yaml:"name"`
+	Username  string            `yaml:"username"`
+	Password  string            `yaml:"password"`
+	Token     string            `yaml:"token"`
+	CredsFile string            `yaml:"credsFile"`
+	TLSConfig *tlsConfig        `yaml:"tlsConfig"`
+	// ReconnectWait is the wait between reconnect attempts, the client reconnects forever
+	// and buffers the messages published while reconnecting.
+	ReconnectWait time.Duration `yaml:"reconnectWait"`
+	// JetStream waits for the ack of stream, messages are at least once delivered.
+	JetStream *natsJetStreamConfig `yaml:"jetStream"`
+}
+
+type natsJetStreamConfig struct {
+	// Stream is the expected stream of subject, the publish fails when they mismatch.
+	Stream     string        `yaml:"stream"`
+	AckTimeout time.Duration `yaml:"ackTimeout"`
+	MaxRetries *int          `yaml:"maxRetries"`
+}
+
+type natsSink struct {
+	*natsConfig
+	conn       *nats.Conn
+	js         nats.JetStreamContext
+	maxRetries int
+}
+
+func NewNATSSink(cfg interface{}) (Sink, error) {
+	natsCfg := &natsConfig{}
+	if err := unmarshalConfig(NATSSinkName, cfg, natsCfg); err != nil {
+		return nil, err
+	}
+	if len(natsCfg.Servers) == 0 || natsCfg.Subject == "" {
+		return nil, fmt.Errorf("init receiver %s, servers and subject must be set", NATSSinkName)
+	}
+	if natsCfg.Name == "" {
+		natsCfg.Name = "eventexporter"
+	}
+	if natsCfg.ReconnectWait <= 0 {
+		natsCfg.ReconnectWait = defaultNATSReconnectWait
+	}
+
+	opts := []nats.Option{
+		nats.Name(natsCfg.Name),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(natsCfg.ReconnectWait),
+		// the exporter starts when nats is unavailable, messages are buffered until connected.
+		nats.RetryOnFailedConnect(true),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				klog.Warningf("Receiver %s disconnected: %v", NATSSinkName, err)
+			}
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			klog.Infof("Receiver %s reconnected to %s", NATSSinkName, c.ConnectedUrlRedacted())
+		}),
+	}
+	if natsCfg.Username != "" {
+		opts = append(opts, nats.UserInfo(natsCfg.Username, natsCfg.Password))
+	}
+	if natsCfg.Token != "" {
+		opts = append(opts, nats.Token(natsCfg.Token))
+	}
+	if natsCfg.CredsFile != "" {
+		opts = append(opts, nats.UserCredentials(natsCfg.CredsFile))
+	}
+	if natsCfg.TLSConfig != nil {
+		tlsCfg, err := natsCfg.TLSConfig.build()
+		if err != nil {
+			return nil, fmt.Errorf("init receiver %s tls config failed: %v", NATSSinkName, err)
+		}
+		opts = append(opts, nats.Secure(tlsCfg))
+	}
+
+	conn, err := nats.Connect(strings.Join(natsCfg.Servers, ","), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s, connect %s failed: %v", NATSSinkName, strings.Join(natsCfg.Servers, ","), err)
+	}
+	n := &natsSink{natsConfig: natsCfg, conn: conn}
+
+	if js := natsCfg.JetStream; js != nil {
+		if js.AckTimeout <= 0 {
+			js.AckTimeout = defaultNATSTimeout
+		}
+		n.maxRetries = defaultNATSRetry
+		if js.MaxRetries != nil {
+			n.maxRetries = *js.MaxRetries
+		}
+		if n.js, err = conn.JetStream(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("init receiver %s jetstream failed: %v", NATSSinkName, err)
+		}
+	}
+	klog.Infof("NATS servers: %s, subject: %s, jetstream: %t", strings.Join(natsCfg.Servers, ","), natsCfg.Subject, n.js != nil)
+	return n, nil
+}
+
+func (n *natsSink) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	msg, err := n.buildMessage(ev)
+	if err != nil {
+		return err
+	}
+
+	if n.js == nil {
+		if err = n.conn.PublishMsg(msg); err != nil {
+			return newNetworkError(err)
+		}
+		return nil
+	}
+
+	return sendWithRetry(ctx, n.maxRetries, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, n.JetStream.AckTimeout)
+		defer cancel()
+
+		opts := []nats.PubOpt{nats.Context(ctx)}
+		if n.JetStream.Stream != "" {
+			opts = append(opts, nats.ExpectStream(n.JetStream.Stream))
+		}
+		_, err := n.js.PublishMsg(msg, opts...)
+		return classifyNATSError(err)
+	})
+}
+
+// Close flushes the buffered messages.
+func (n *natsSink) Close() {
+	if err := n.conn.FlushTimeout(defaultNATSTimeout); err != nil {
+		klog.Warningf("Receiver %s flush failed: %v", NATSSinkName, err)
+	}
+	n.conn.Close()
+}
+
+func (n *natsSink) buildMessage(ev *kube.EnhancedEvent) (*nats.Msg, error) {
+	subject, err := getLayoutString(ev, n.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("render subject failed: %v", err)
+	}
+	if subject = strings.TrimSpace(subject); subject == "" || strings.ContainsAny(subject, " \t\r\n*>") {
+		return nil, fmt.Errorf("subject %q of %s/%s is invalid", subject, ev.Namespace, ev.Name)
+	}
+	data, err := serializeEventWithLayout(n.Layout, ev)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	for k, v := range getLayoutLabels(ev, n.Headers) {
+		msg.Header.Set(k, v)
+	}
+	return msg, nil
+}
+
+// classifyNATSError treats the rejections of stream as client errors.
+func classifyNATSError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var apiErr *nats.APIError
+	if errors.As(err, &apiErr) && apiErr.Code > 0 {
+		return newStatusError(apiErr.Code, err)
+	}
+	if errors.Is(err, nats.ErrNoStreamResponse) || errors.Is(err, nats.ErrNoResponders) {
+		// the stream is unavailable, e.g. the leader is changing.
+		return newStatusError(http.StatusServiceUnavailable, err)
+	}
+	return newNetworkError(err)
+}
@@ -0,0 +1,137 @@
+package sinks
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNATSServer is the embedded nats server with jetstream, the messages published to
+// events.> are kept in the EVENTS stream so they survive the restart of server.
+type fakeNATSServer struct {
+	*server.Server
+	opts server.Options
+}
+
+func newFakeNATSServer(t *testing.T) *fakeNATSServer {
+	s := &fakeNATSServer{opts: natsserver.DefaultTestOptions}
+	s.opts.Port = -1
+	s.opts.JetStream = true
+	s.opts.StoreDir = t.TempDir()
+	s.start()
+	s.addStream(t, "EVENTS", "events.>")
+	return s
+}
+
+// start runs the server, it listens on the same port after restarted.
+func (s *fakeNATSServer) start() {
+	s.Server = natsserver.RunServer(&s.opts)
+	s.opts.Port = s.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeNATSServer) stop() {
+	s.Shutdown()
+	s.WaitForShutdown()
+}
+
+func (s *fakeNATSServer) jetStream(t *testing.T) (*nats.Conn, nats.JetStreamContext) {
+	conn, err := nats.Connect(s.ClientURL())
+	require.NoError(t, err)
+	js, err := conn.JetStream()
+	require.NoError(t, err)
+	return conn, js
+}
+
+func (s *fakeNATSServer) addStream(t *testing.T, name string, subjects ...string) {
+	conn, js := s.jetStream(t)
+	defer conn.Close()
+	_, err := js.AddStream(&nats.StreamConfig{Name: name, Subjects: subjects})
+	require.NoError(t, err)
+}
+
+func (s *fakeNATSServer) deleteStream(t *testing.T, name string) {
+	conn, js := s.jetStream(t)
+	defer conn.Close()
+	require.NoError(t, js.DeleteStream(name))
+}
+
+// received returns the messages kept in the stream.
+func (s *fakeNATSServer) received(t *testing.T, stream string) []*nats.RawStreamMsg {
+	conn, js := s.jetStream(t)
+	defer conn.Close()
+	info, err := js.StreamInfo(stream)
+	require.NoError(t, err)
+	msgs := []*nats.RawStreamMsg{}
+	for seq := info.State.FirstSeq; seq <= info.State.LastSeq && info.State.Msgs > 0; seq++ {
+		msg, err := js.GetMsg(stream, seq)
+		require.NoError(t, err)
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func TestNATSReconnect(t *testing.T) {
+	srv := newFakeNATSServer(t)
+	defer srv.stop()
+
+	sink, err := NewNATSSink(map[string]interface{}{
+		"servers":       []interface{}{srv.ClientURL()},
+		"subject":       "events.{{ .InvolvedObject.ClusterName }}.{{ .Event.InvolvedObject.Namespace }}",
+		"headers":       map[string]interface{}{"X-Reason": "{{ .Reason }}"},
+		"layout":        map[string]interface{}{"reason": "{{ .Reason }}"},
+		"reconnectWait": "50ms",
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)))
+	require.Eventually(t, func() bool { return len(srv.received(t, "EVENTS")) == 1 }, time.Second*5, time.Millisecond*20)
+	msg := srv.received(t, "EVENTS")[0]
+	require.Equal(t, "events.test.default", msg.Subject)
+	require.Equal(t, "BackOff", msg.Header.Get("X-Reason"))
+	require.Equal(t, `{"reason":"BackOff"}`, string(msg.Data))
+
+	// the message published while reconnecting is buffered and flushed after reconnected.
+	srv.stop()
+	require.Eventually(t, func() bool { return sink.(*natsSink).conn.IsReconnecting() }, time.Second*5, time.Millisecond*20)
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.started", "Started", 1)))
+	srv.start()
+	require.Eventually(t, func() bool { return len(srv.received(t, "EVENTS")) == 2 }, time.Second*5, time.Millisecond*20)
+	require.Equal(t, `{"reason":"Started"}`, string(srv.received(t, "EVENTS")[1].Data))
+
+	_, err = NewNATSSink(map[string]interface{}{"servers": []interface{}{srv.ClientURL()}})
+	require.Error(t, err)
+}
+
+func TestNATSJetStream(t *testing.T) {
+	srv := newFakeNATSServer(t)
+	defer srv.stop()
+
+	sink, err := NewNATSSink(map[string]interface{}{
+		"servers":   []interface{}{srv.ClientURL()},
+		"subject":   "events.{{ .Reason }}",
+		"jetStream": map[string]interface{}{"stream": "EVENTS", "ackTimeout": "2s"},
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)))
+	msgs := srv.received(t, "EVENTS")
+	require.Len(t, msgs, 1)
+	require.Equal(t, "events.BackOff", msgs[0].Subject)
+	require.Equal(t, "EVENTS", msgs[0].Header.Get(nats.ExpectedStreamHdr))
+
+	// the rejection of stream isn't retried.
+	srv.deleteStream(t, "EVENTS")
+	srv.addStream(t, "OTHER", "events.>")
+	err = sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 2))
+	require.Error(t, err)
+	require.False(t, IsRetryable(err))
+	require.Empty(t, srv.received(t, "OTHER"))
+}
@@ -0,0 +1,178 @@
+package sinks
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	networkTCP = "tcp"
+	networkUDP = "udp"
+	networkTLS = "tls"
+
+	defaultNetPoolSize     = 2
+	defaultNetDialTimeout  = time.Second * 5
+	defaultNetWriteTimeout = time.Second * 5
+	defaultNetRetry        = 2
+)
+
+// netConfig is the common connection configuration of network protocol sinks.
+type netConfig struct {
+	// Network is tcp, udp or tls.
+	Network   string     `yaml:"network"`
+	Address   string     `yaml:"address"`
+	TLSConfig *tlsConfig `yaml:"tlsConfig"`
+	// PoolSize is the max idle connections, events are written concurrently.
+	PoolSize     int           `yaml:"poolSize"`
+	DialTimeout  time.Duration `yaml:"dialTimeout"`
+	WriteTimeout time.Duration `yaml:"writeTimeout"`
+	MaxRetries   *int          `yaml:"maxRetries"`
+}
+
+func (c *netConfig) newConnPool(defaultNetwork string) (*connPool, error) {
+	if c.Address == "" {
+		return nil, fmt.Errorf("address must be set")
+	}
+	if c.Network == "" {
+		c.Network = defaultNetwork
+	}
+	if c.PoolSize <= 0 {
+		c.PoolSize = defaultNetPoolSize
+	}
+	if c.DialTimeout <= 0 {
+		c.DialTimeout = defaultNetDialTimeout
+	}
+	if c.WriteTimeout <= 0 {
+		c.WriteTimeout = defaultNetWriteTimeout
+	}
+
+	p := &connPool{
+		netConfig:  c,
+		maxRetries: defaultNetRetry,
+		idle:       make(chan *poolConn, c.PoolSize),
+	}
+	if c.MaxRetries != nil {
+		p.maxRetries = *c.MaxRetries
+	}
+	switch c.Network {
+	case networkTCP, networkUDP:
+	case networkTLS:
+		tlsCfg := &tlsConfig{}
+		if c.TLSConfig != nil {
+			tlsCfg = c.TLSConfig
+		}
+		var err error
+		if p.tlsConfig, err = tlsCfg.build(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("network %s not supported, must be %s, %s or %s", c.Network, networkTCP, networkUDP, networkTLS)
+	}
+	return p, nil
+}
+
+// connPool keeps idle connections, a broken connection is dropped and the
+// frames are written again with a new connection.
+type connPool struct {
+	*netConfig
+	tlsConfig  *tls.Config
+	maxRetries int
+	idle       chan *poolConn
+	closed     atomic.Bool
+}
+
+type poolConn struct {
+	net.Conn
+	// dead is set when the peer closed the stream connection.
+	dead atomic.Bool
+}
+
+// write writes the frames with one connection, every frame is a datagram of udp.
+func (p *connPool) write(ctx context.Context, frames ...[]byte) error {
+	return sendWithRetry(ctx, p.maxRetries, func(ctx context.Context) error {
+		conn, err := p.get(ctx)
+		if err != nil {
+			return newNetworkError(err)
+		}
+		conn.SetWriteDeadline(time.Now().Add(p.WriteTimeout))
+		for _, frame := range frames {
+			if _, err = conn.Write(frame); err != nil {
+				conn.Close()
+				return newNetworkError(err)
+			}
+		}
+		p.put(conn)
+		return nil
+	})
+}
+
+func (p *connPool) get(ctx context.Context) (*poolConn, error) {
+	for {
+		select {
+		case conn := <-p.idle:
+			if conn.dead.Load() {
+				conn.Close()
+				continue
+			}
+			return conn, nil
+		default:
+			return p.dial(ctx)
+		}
+	}
+}
+
+func (p *connPool) put(conn *poolConn) {
+	if p.closed.Load() {
+		conn.Close()
+		return
+	}
+	select {
+	case p.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func (p *connPool) dial(ctx context.Context) (*poolConn, error) {
+	dialer := &net.Dialer{Timeout: p.DialTimeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	switch p.Network {
+	case networkTLS:
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: p.tlsConfig}).DialContext(ctx, networkTCP, p.Address)
+	default:
+		conn, err = dialer.DialContext(ctx, p.Network, p.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pc := &poolConn{Conn: conn}
+	if p.Network != networkUDP {
+		// the peers never send data, a read returns only when the connection is closed.
+		go func() {
+			io.Copy(io.Discard, conn)
+			pc.dead.Store(true)
+		}()
+	}
+	return pc, nil
+}
+
+func (p *connPool) close() {
+	p.closed.Store(true)
+	for {
+		select {
+		case conn := <-p.idle:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package sinks
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	OpsgenieSinkName = "opsgenie"
+
+	// https://docs.opsgenie.com/docs/alert-api
+	defaultOpsgenieURL      = "https://api.opsgenie.com"
+	defaultOpsgeniePriority = `{{ if eq .Type "Warning" }}P3{{ else }}P5{{ end }}`
+	opsgenieMessageMaxLen   = 130
+	opsgenieAliasMaxLen     = 512
+)
+
+var opsgeniePriorities = map[string]bool{"P1": true, "P2": true, "P3": true, "P4": true, "P5": true}
+
+func init() {
+	factory[OpsgenieSinkName] = NewOpsgenieSink
+}
+
+type opsgenieConfig struct {
+	incidentConfig `yaml:",inline"`
+	// APIKey is the key of api integration.
+	APIKey string   `yaml:"apiKey"`
+	Tags   []string `yaml:"tags"`
+	// Responders are the team names notified.
+	Responders []string `yaml:"responders"`
+}
+
+type opsgenie struct {
+	*opsgenieConfig
+	header http.Header
+	client *http.Client
+}
+
+func NewOpsgenieSink(cfg interface{}) (Sink, error) {
+	ogCfg := &opsgenieConfig{}
+	if err := unmarshalConfig(OpsgenieSinkName, cfg, ogCfg); err != nil {
+		return nil, err
+	}
+	if ogCfg.APIKey == "" {
+		return nil, fmt.Errorf("init receiver %s, apiKey must be set", OpsgenieSinkName)
+	}
+	if ogCfg.URL == "" {
+		ogCfg.URL = defaultOpsgenieURL
+	}
+	ogCfg.URL = strings.TrimSuffix(ogCfg.URL, "/")
+	ogCfg.complete(defaultOpsgeniePriority)
+
+	client, err := ogCfg.HTTPClientConfig.newHTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s http client failed: %v", OpsgenieSinkName, err)
+	}
+	og := &opsgenie{
+		opsgenieConfig: ogCfg,
+		header:         http.Header{"Authorization": []string{"GenieKey " + ogCfg.APIKey}},
+		client:         client,
+	}
+	klog.Infof("Opsgenie url: %s", ogCfg.URL)
+	return newIncidentSink(OpsgenieSinkName, &ogCfg.incidentConfig, og), nil
+}
+
+func (og *opsgenie) trigger(ctx context.Context, inc *incident) error {
+	priority := inc.severity
+	if !opsgeniePriorities[priority] {
+		klog.Warningf("Receiver %s priority %q of %s is invalid, use P3.", OpsgenieSinkName, priority, inc.dedupKey)
+		priority = "P3"
+	}
+	message := inc.summary
+	if len(message) > opsgenieMessageMaxLen {
+		message = message[:opsgenieMessageMaxLen]
+	}
+	responders := make([]map[string]string, 0, len(og.Responders))
+	for _, team := range og.Responders {
+		responders = append(responders, map[string]string{"name": team, "type": "team"})
+	}
+
+	return postIncidentJSON(ctx, og.client, og.URL+"/v2/alerts", og.header, map[string]interface{}{
+		"message":     message,
+		"alias":       opsgenieAlias(inc.dedupKey),
+		"description": inc.summary,
+		"priority":    priority,
+		"source":      inc.source,
+		"entity":      inc.details["kind"] + "/" + inc.details["name"],
+		"tags":        og.Tags,
+		"responders":  responders,
+		"details":     inc.details,
+	})
+}
+
+func (og *opsgenie) resolve(ctx context.Context, inc *incident) error {
+	u := fmt.Sprintf("%s/v2/alerts/%s/close?identifierType=alias", og.URL, url.PathEscape(opsgenieAlias(inc.dedupKey)))
+	return postIncidentJSON(ctx, og.client, u, og.header, map[string]interface{}{
+		"source": inc.source,
+		"note":   "event stopped recurring or the object was deleted",
+	})
+}
+
+// opsgenieAlias hashes the dedup key when it exceeds the max length of alias.
+func opsgenieAlias(dedupKey string) string {
+	if len(dedupKey) <= opsgenieAliasMaxLen {
+		return dedupKey
+	}
+	sum := sha256.Sum256([]byte(dedupKey))
+	return hex.EncodeToString(sum[:])
+}
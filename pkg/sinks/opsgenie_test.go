@@ -0,0 +1,47 @@
+package sinks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestOpsgenieTriggerAndResolveOnDelete(t *testing.T) {
+	fis := newFakeIncidentServer()
+	defer fis.Close()
+
+	sink, err := NewOpsgenieSink(map[string]interface{}{
+		"url":        fis.URL,
+		"apiKey":     "genie",
+		"tags":       []interface{}{"k8s"},
+		"responders": []interface{}{"sre"},
+		"details":    map[string]interface{}{"app": "{{ .InvolvedObject.Labels.app }}"},
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	ev := buildTestEvent("nginx.backoff", "BackOff", 1)
+	ev.InvolvedObject.Labels = map[string]string{"app": "nginx"}
+	require.NoError(t, sink.Send(context.TODO(), ev))
+
+	notifier, ok := sink.(ObjectDeleteNotifier)
+	require.True(t, ok)
+	// another object, nothing to resolve
+	require.NoError(t, notifier.OnObjectDeleted(context.TODO(), "test", &corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "redis"}))
+	require.NoError(t, notifier.OnObjectDeleted(context.TODO(), "test", &corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "nginx"}))
+
+	requests := fis.requests()
+	require.Len(t, requests, 2)
+	require.Equal(t, "/v2/alerts", requests[0].URL.RequestURI())
+	require.Equal(t, "/v2/alerts/test%2Fdefault%2FPod%2Fnginx%2FBackOff/close?identifierType=alias", requests[1].URL.RequestURI())
+	require.Equal(t, "GenieKey genie", requests[0].Header.Get("Authorization"))
+	payloads := fis.payloads(t)
+	require.Equal(t, "test/default/Pod/nginx/BackOff", payloads[0]["alias"])
+	require.Equal(t, "P3", payloads[0]["priority"])
+	require.Equal(t, "Pod/nginx", payloads[0]["entity"])
+	require.Equal(t, []interface{}{"k8s"}, payloads[0]["tags"])
+	require.Equal(t, "nginx", payloads[0]["details"].(map[string]interface{})["app"])
+	require.Equal(t, "test", payloads[1]["source"])
+}
@@ -0,0 +1,457 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/champly/eventexporter/pkg/kube"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/klog/v2"
+)
+
+const (
+	OTLPSinkName = "otlp"
+
+	otlpProtocolGRPC         = "grpc"
+	otlpProtocolHTTPProtobuf = "http/protobuf"
+	otlpHTTPLogsPath         = "/v1/logs"
+	otlpScopeName            = "github.com/champly/eventexporter"
+
+	defaultOTLPBatchSize     = 512
+	defaultOTLPBatchInterval = time.Second
+	defaultOTLPTimeout       = time.Second * 10
+	defaultOTLPRetry         = 3
+	otlpQueueCapacity        = 10
+)
+
+// otlpKindAttributes are the kinds which have k8s.<kind>.name and k8s.<kind>.uid
+// resource attributes in the k8s semantic conventions.
+var otlpKindAttributes = map[string]string{
+	"Pod":         "pod",
+	"ReplicaSet":  "replicaset",
+	"Deployment":  "deployment",
+	"StatefulSet": "statefulset",
+	"DaemonSet":   "daemonset",
+	"Job":         "job",
+	"CronJob":     "cronjob",
+	"Node":        "node",
+	"Namespace":   "namespace",
+}
+
+func init() {
+	factory[OTLPSinkName] = NewOTLPSink
+}
+
+type otlpConfig struct {
+	// Endpoint is host:port for grpc, or the url for http/protobuf, /v1/logs is
+	// appended when the url has no path.
+	Endpoint string `yaml:"endpoint"`
+	// Protocol is grpc (default) or http/protobuf.
+	Protocol string `yaml:"protocol"`
+	// Insecure disables tls of grpc connection.
+	Insecure bool              `yaml:"insecure"`
+	Headers  map[string]string `yaml:"headers"`
+	// Body is the template of log body, default is the event message.
+	Body string `yaml:"body"`
+	// ResourceAttributes and Attributes are extra templated attributes, they override
+	// the attributes of semantic conventions.
+	ResourceAttributes map[string]string `yaml:"resourceAttributes"`
+	Attributes         map[string]string `yaml:"attributes"`
+	// HTTPClientConfig is used by http/protobuf, tlsConfig is also used by grpc.
+	HTTPClientConfig httpClientConfig `yaml:",inline"`
+	BatchSize        int              `yaml:"batchSize"`
+	BatchInterval    time.Duration    `yaml:"batchInterval"`
+	Timeout          time.Duration    `yaml:"timeout"`
+	MaxRetries       *int             `yaml:"maxRetries"`
+}
+
+// otlpExporter exports logs with one of the otlp protocols.
+type otlpExporter interface {
+	export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error)
+	close() error
+}
+
+type otlp struct {
+	*otlpConfig
+	exporter   otlpExporter
+	maxRetries int
+	batcher    *batcher[*otlpRecord]
+}
+
+type otlpRecord struct {
+	resourceKey string
+	resource    []*commonpb.KeyValue
+	record      *logspb.LogRecord
+}
+
+func NewOTLPSink(cfg interface{}) (Sink, error) {
+	otlpCfg := &otlpConfig{}
+	if err := unmarshalConfig(OTLPSinkName, cfg, otlpCfg); err != nil {
+		return nil, err
+	}
+	if otlpCfg.Endpoint == "" {
+		return nil, fmt.Errorf("init receiver %s, endpoint must be set", OTLPSinkName)
+	}
+	if otlpCfg.Protocol == "" {
+		otlpCfg.Protocol = otlpProtocolGRPC
+	}
+	if otlpCfg.Body == "" {
+		otlpCfg.Body = "{{ .Message }}"
+	}
+	if otlpCfg.BatchSize <= 0 {
+		otlpCfg.BatchSize = defaultOTLPBatchSize
+	}
+	if otlpCfg.BatchInterval <= 0 {
+		otlpCfg.BatchInterval = defaultOTLPBatchInterval
+	}
+	if otlpCfg.Timeout <= 0 {
+		otlpCfg.Timeout = defaultOTLPTimeout
+	}
+
+	var (
+		exporter otlpExporter
+		err      error
+	)
+	switch otlpCfg.Protocol {
+	case otlpProtocolGRPC:
+		exporter, err = newOTLPGRPCExporter(otlpCfg)
+	case otlpProtocolHTTPProtobuf:
+		exporter, err = newOTLPHTTPExporter(otlpCfg)
+	default:
+		return nil, fmt.Errorf("init receiver %s, protocol %s not supported, must be %s or %s", OTLPSinkName, otlpCfg.Protocol, otlpProtocolGRPC, otlpProtocolHTTPProtobuf)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s %s exporter failed: %v", OTLPSinkName, otlpCfg.Protocol, err)
+	}
+
+	o := &otlp{
+		otlpConfig: otlpCfg,
+		exporter:   exporter,
+		maxRetries: defaultOTLPRetry,
+	}
+	if otlpCfg.MaxRetries != nil {
+		o.maxRetries = *otlpCfg.MaxRetries
+	}
+	o.batcher = newBatcher(otlpCfg.BatchSize, otlpCfg.BatchInterval, otlpCfg.BatchSize*otlpQueueCapacity, o.flush)
+	klog.Infof("OTLP %s endpoint: %s", otlpCfg.Protocol, otlpCfg.Endpoint)
+	return o, nil
+}
+
+// Send queues the event as a log record.
+func (o *otlp) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	record, err := o.buildRecord(ev)
+	if err != nil {
+		return err
+	}
+	return o.batcher.add(record)
+}
+
+// Close flushes the queued records and closes the exporter.
+func (o *otlp) Close() {
+	o.batcher.stop()
+	if err := o.exporter.close(); err != nil {
+		klog.Errorf("Receiver %s close exporter failed: %+v", OTLPSinkName, err)
+	}
+}
+
+func (o *otlp) buildRecord(ev *kube.EnhancedEvent) (*otlpRecord, error) {
+	body, err := getLayoutString(ev, o.Body)
+	if err != nil {
+		return nil, fmt.Errorf("render body failed: %v", err)
+	}
+
+	resource := map[string]string{
+		"k8s.cluster.name":       ev.InvolvedObject.ClusterName,
+		"k8s.namespace.name":     ev.Event.InvolvedObject.Namespace,
+		"k8s.object.kind":        ev.Event.InvolvedObject.Kind,
+		"k8s.object.name":        ev.Event.InvolvedObject.Name,
+		"k8s.object.uid":         string(ev.Event.InvolvedObject.UID),
+		"k8s.object.api_version": ev.Event.InvolvedObject.APIVersion,
+	}
+	if kind, ok := otlpKindAttributes[ev.Event.InvolvedObject.Kind]; ok {
+		resource["k8s."+kind+".name"] = ev.Event.InvolvedObject.Name
+		resource["k8s."+kind+".uid"] = string(ev.Event.InvolvedObject.UID)
+		for k, v := range ev.InvolvedObject.Labels {
+			resource["k8s."+kind+".label."+k] = v
+		}
+		for k, v := range ev.InvolvedObject.Annotations {
+			resource["k8s."+kind+".annotation."+k] = v
+		}
+	}
+	extraResource, err := renderAttributes(ev, o.ResourceAttributes)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range extraResource {
+		resource[k] = v
+	}
+
+	attributes := map[string]string{
+		"k8s.event.name":       ev.Name,
+		"k8s.event.uid":        string(ev.UID),
+		"k8s.event.reason":     ev.Reason,
+		"k8s.event.action":     ev.Action,
+		"k8s.event.type":       ev.Type,
+		"k8s.event.count":      fmt.Sprintf("%d", ev.Count),
+		"k8s.namespace.name":   ev.Namespace,
+		"k8s.object.fieldpath": ev.Event.InvolvedObject.FieldPath,
+		"k8s.event.source":     ev.Source.Component,
+	}
+	if !ev.FirstTimestamp.IsZero() {
+		attributes["k8s.event.start_time"] = ev.FirstTimestamp.UTC().Format(time.RFC3339)
+	}
+	extraAttributes, err := renderAttributes(ev, o.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range extraAttributes {
+		attributes[k] = v
+	}
+
+	severityNumber, severityText := otlpSeverity(ev.Type)
+	ts := ev.GetLastTimestamp()
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	resourceAttrs := toOTLPAttributes(resource)
+	return &otlpRecord{
+		resourceKey: otlpAttributesKey(resourceAttrs),
+		resource:    resourceAttrs,
+		record: &logspb.LogRecord{
+			TimeUnixNano:         uint64(ts.UnixNano()),
+			ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+			SeverityNumber:       severityNumber,
+			SeverityText:         severityText,
+			Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: body}},
+			Attributes:           toOTLPAttributes(attributes),
+		},
+	}, nil
+}
+
+// flush groups the records by resource, the records are exported with one request.
+func (o *otlp) flush(records []*otlpRecord) {
+	resourceLogs := map[string]*logspb.ResourceLogs{}
+	req := &collogspb.ExportLogsServiceRequest{}
+	for _, r := range records {
+		rl, ok := resourceLogs[r.resourceKey]
+		if !ok {
+			rl = &logspb.ResourceLogs{
+				Resource:  &resourcepb.Resource{Attributes: r.resource},
+				ScopeLogs: []*logspb.ScopeLogs{{Scope: &commonpb.InstrumentationScope{Name: otlpScopeName}}},
+			}
+			resourceLogs[r.resourceKey] = rl
+			req.ResourceLogs = append(req.ResourceLogs, rl)
+		}
+		rl.ScopeLogs[0].LogRecords = append(rl.ScopeLogs[0].LogRecords, r.record)
+	}
+
+	var resp *collogspb.ExportLogsServiceResponse
+	err := sendWithRetry(context.Background(), o.maxRetries, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+		var err error
+		resp, err = o.exporter.export(ctx, req)
+		return err
+	})
+	if err != nil {
+		klog.Errorf("Receiver %s export %d log records failed: %+v", OTLPSinkName, len(records), err)
+		return
+	}
+	if ps := resp.GetPartialSuccess(); ps != nil && ps.GetRejectedLogRecords() > 0 {
+		klog.Errorf("Receiver %s export %d log records, %d rejected: %s", OTLPSinkName, len(records), ps.GetRejectedLogRecords(), ps.GetErrorMessage())
+		return
+	}
+	klog.V(4).Infof("Receiver %s export %d log records success.", OTLPSinkName, len(records))
+}
+
+// otlpSeverity maps the event type to severity.
+func otlpSeverity(eventType string) (logspb.SeverityNumber, string) {
+	switch eventType {
+	case "Normal":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_INFO, "INFO"
+	case "Warning":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_WARN, "WARN"
+	}
+	return logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED, eventType
+}
+
+// renderAttributes renders the templates of attributes, empty values are skipped.
+func renderAttributes(ev *kube.EnhancedEvent, layout map[string]string) (map[string]string, error) {
+	attributes := map[string]string{}
+	for k, text := range layout {
+		v, err := getLayoutString(ev, text)
+		if err != nil {
+			return nil, fmt.Errorf("render attribute %s failed: %v", k, err)
+		}
+		if v != "" {
+			attributes[k] = v
+		}
+	}
+	return attributes, nil
+}
+
+// toOTLPAttributes converts the attributes sorted by key, empty values are skipped.
+func toOTLPAttributes(attributes map[string]string) []*commonpb.KeyValue {
+	keys := make([]string, 0, len(attributes))
+	for k, v := range attributes {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	kvs := make([]*commonpb.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, &commonpb.KeyValue{
+			Key:   k,
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: attributes[k]}},
+		})
+	}
+	return kvs
+}
+
+func otlpAttributesKey(kvs []*commonpb.KeyValue) string {
+	b := &strings.Builder{}
+	for _, kv := range kvs {
+		b.WriteString(kv.Key)
+		b.WriteString("=")
+		b.WriteString(kv.Value.GetStringValue())
+		b.WriteString(";")
+	}
+	return b.String()
+}
+
+type otlpGRPCExporter struct {
+	conn   *grpc.ClientConn
+	client collogspb.LogsServiceClient
+	md     metadata.MD
+}
+
+func newOTLPGRPCExporter(cfg *otlpConfig) (*otlpGRPCExporter, error) {
+	creds := insecure.NewCredentials()
+	if !cfg.Insecure {
+		tlsCfg := &tlsConfig{}
+		if cfg.HTTPClientConfig.TLSConfig != nil {
+			tlsCfg = cfg.HTTPClientConfig.TLSConfig
+		}
+		c, err := tlsCfg.build()
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(c)
+	}
+
+	// dial does not block, the connection is established by the first export.
+	conn, err := grpc.Dial(cfg.Endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	return &otlpGRPCExporter{
+		conn:   conn,
+		client: collogspb.NewLogsServiceClient(conn),
+		md:     metadata.New(cfg.Headers),
+	}, nil
+}
+
+func (e *otlpGRPCExporter) export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	resp, err := e.client.Export(metadata.NewOutgoingContext(ctx, e.md), req)
+	if err == nil {
+		return resp, nil
+	}
+
+	// https://opentelemetry.io/docs/specs/otlp/#failures
+	st := status.Convert(err)
+	switch st.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted, codes.Canceled, codes.OutOfRange, codes.DataLoss:
+		return nil, newNetworkError(err)
+	case codes.ResourceExhausted:
+		return nil, newStatusError(http.StatusTooManyRequests, err)
+	}
+	return nil, newStatusError(http.StatusBadRequest, err)
+}
+
+func (e *otlpGRPCExporter) close() error {
+	return e.conn.Close()
+}
+
+type otlpHTTPExporter struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newOTLPHTTPExporter(cfg *otlpConfig) (*otlpHTTPExporter, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("endpoint %s must be an url", cfg.Endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = otlpHTTPLogsPath
+	}
+
+	client, err := cfg.HTTPClientConfig.newHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	return &otlpHTTPExporter{url: u.String(), headers: cfg.Headers, client: client}, nil
+}
+
+func (e *otlpHTTPExporter) export(ctx context.Context, pr *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	body, err := proto.Marshal(pr)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, newNetworkError(err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, newNetworkError(err)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, newStatusError(resp.StatusCode, errors.New(string(b)))
+	}
+	out := &collogspb.ExportLogsServiceResponse{}
+	if err = proto.Unmarshal(b, out); err != nil {
+		return nil, fmt.Errorf("unmarshal response failed: %v", err)
+	}
+	return out, nil
+}
+
+func (e *otlpHTTPExporter) close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,131 @@
+package sinks
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+type fakeLogsCollector struct {
+	collogspb.UnimplementedLogsServiceServer
+	sync.Mutex
+	requests []*collogspb.ExportLogsServiceRequest
+	tenants  []string
+}
+
+func (f *fakeLogsCollector) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	f.Lock()
+	defer f.Unlock()
+	f.requests = append(f.requests, req)
+	f.tenants = append(f.tenants, md.Get("x-scope-orgid")...)
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+func attributesOf(kvs []*commonpb.KeyValue) map[string]string {
+	m := map[string]string{}
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Value.GetStringValue()
+	}
+	return m
+}
+
+func TestOTLPGRPC(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	collector := &fakeLogsCollector{}
+	server := grpc.NewServer()
+	collogspb.RegisterLogsServiceServer(server, collector)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	sink, err := NewOTLPSink(map[string]interface{}{
+		"endpoint":      lis.Addr().String(),
+		"insecure":      true,
+		"headers":       map[string]interface{}{"X-Scope-OrgID": "team-a"},
+		"body":          "{{ .Reason }}: {{ .Message }}",
+		"attributes":    map[string]interface{}{"app": "{{ .InvolvedObject.Labels.app }}"},
+		"batchInterval": "100ms",
+	})
+	require.NoError(t, err)
+
+	backoff := buildTestEvent("nginx.backoff", "BackOff", 3)
+	backoff.Message = "Back-off restarting failed container"
+	backoff.InvolvedObject.Labels = map[string]string{"app": "nginx"}
+	require.NoError(t, sink.Send(context.TODO(), backoff))
+	started := buildTestEvent("nginx.started", "Started", 1)
+	started.Type = "Normal"
+	require.NoError(t, sink.Send(context.TODO(), started))
+	sink.Close()
+
+	collector.Lock()
+	defer collector.Unlock()
+	require.Len(t, collector.requests, 1)
+	require.Equal(t, []string{"team-a"}, collector.tenants)
+	// the labels differ, so the events are two resources
+	require.Len(t, collector.requests[0].ResourceLogs, 2)
+
+	rl := collector.requests[0].ResourceLogs[0]
+	resource := attributesOf(rl.Resource.Attributes)
+	require.Equal(t, "test", resource["k8s.cluster.name"])
+	require.Equal(t, "default", resource["k8s.namespace.name"])
+	require.Equal(t, "nginx", resource["k8s.pod.name"])
+	require.Equal(t, "uid-1", resource["k8s.pod.uid"])
+	require.Equal(t, "nginx", resource["k8s.pod.label.app"])
+
+	records := rl.ScopeLogs[0].LogRecords
+	require.Len(t, records, 1)
+	require.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_WARN, records[0].SeverityNumber)
+	require.Equal(t, "BackOff: Back-off restarting failed container", records[0].Body.GetStringValue())
+	attributes := attributesOf(records[0].Attributes)
+	require.Equal(t, "BackOff", attributes["k8s.event.reason"])
+	require.Equal(t, "3", attributes["k8s.event.count"])
+	require.Equal(t, "nginx", attributes["app"])
+
+	records = collector.requests[0].ResourceLogs[1].ScopeLogs[0].LogRecords
+	require.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_INFO, records[0].SeverityNumber)
+}
+
+func TestOTLPHTTPRetry(t *testing.T) {
+	calls := 0
+	server := newRecordingServer(func(rw http.ResponseWriter, req *recordedRequest) {
+		calls++
+		if calls == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := proto.Marshal(&collogspb.ExportLogsServiceResponse{})
+		rw.Write(b)
+	})
+	defer server.Close()
+
+	sink, err := NewOTLPSink(map[string]interface{}{
+		"endpoint":      server.URL,
+		"protocol":      otlpProtocolHTTPProtobuf,
+		"batchInterval": "100ms",
+	})
+	require.NoError(t, err)
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)))
+	require.Eventually(t, func() bool { return server.count() == 2 }, time.Second*5, time.Millisecond*10)
+	sink.Close()
+
+	requests := server.requests()
+	require.Len(t, requests, 2)
+	require.Equal(t, http.StatusServiceUnavailable, requests[0].Status)
+	require.Equal(t, otlpHTTPLogsPath, requests[1].URL.Path)
+	require.Equal(t, "application/x-protobuf", requests[1].Header.Get("Content-Type"))
+	req := &collogspb.ExportLogsServiceRequest{}
+	require.NoError(t, proto.Unmarshal(requests[1].Body, req))
+	require.Equal(t, "BackOff", attributesOf(req.ResourceLogs[0].ScopeLogs[0].LogRecords[0].Attributes)["k8s.event.reason"])
+}
@@ -0,0 +1,93 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	PagerDutySinkName = "pagerduty"
+
+	// https://developer.pagerduty.com/docs/events-api-v2/overview/
+	defaultPagerDutyURL      = "https://events.pagerduty.com/v2/enqueue"
+	defaultPagerDutySeverity = `{{ if eq .Type "Warning" }}warning{{ else }}info{{ end }}`
+	pagerDutySummaryMaxLen   = 1024
+)
+
+var pagerDutySeverities = map[string]bool{"critical": true, "error": true, "warning": true, "info": true}
+
+func init() {
+	factory[PagerDutySinkName] = NewPagerDutySink
+}
+
+type pagerDutyConfig struct {
+	incidentConfig `yaml:",inline"`
+	// RoutingKey is the integration key of the service.
+	RoutingKey string `yaml:"routingKey"`
+}
+
+type pagerDuty struct {
+	*pagerDutyConfig
+	client *http.Client
+}
+
+func NewPagerDutySink(cfg interface{}) (Sink, error) {
+	pdCfg := &pagerDutyConfig{}
+	if err := unmarshalConfig(PagerDutySinkName, cfg, pdCfg); err != nil {
+		return nil, err
+	}
+	if pdCfg.RoutingKey == "" {
+		return nil, fmt.Errorf("init receiver %s, routingKey must be set", PagerDutySinkName)
+	}
+	if pdCfg.URL == "" {
+		pdCfg.URL = defaultPagerDutyURL
+	}
+	pdCfg.complete(defaultPagerDutySeverity)
+
+	client, err := pdCfg.HTTPClientConfig.newHTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s http client failed: %v", PagerDutySinkName, err)
+	}
+	klog.Infof("PagerDuty url: %s", pdCfg.URL)
+	return newIncidentSink(PagerDutySinkName, &pdCfg.incidentConfig, &pagerDuty{pagerDutyConfig: pdCfg, client: client}), nil
+}
+
+func (pd *pagerDuty) trigger(ctx context.Context, inc *incident) error {
+	severity := inc.severity
+	if !pagerDutySeverities[severity] {
+		klog.Warningf("Receiver %s severity %q of %s is invalid, use warning.", PagerDutySinkName, severity, inc.dedupKey)
+		severity = "warning"
+	}
+	summary := inc.summary
+	if len(summary) > pagerDutySummaryMaxLen {
+		summary = summary[:pagerDutySummaryMaxLen]
+	}
+
+	return postIncidentJSON(ctx, pd.client, pd.URL, nil, map[string]interface{}{
+		"routing_key":  pd.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    inc.dedupKey,
+		"payload": map[string]interface{}{
+			"summary":        summary,
+			"source":         inc.source,
+			"severity":       severity,
+			"timestamp":      inc.ts.UTC().Format(time.RFC3339),
+			"component":      inc.details["kind"] + "/" + inc.details["name"],
+			"group":          inc.details["namespace"],
+			"class":          inc.details["reason"],
+			"custom_details": inc.details,
+		},
+	})
+}
+
+func (pd *pagerDuty) resolve(ctx context.Context, inc *incident) error {
+	return postIncidentJSON(ctx, pd.client, pd.URL, nil, map[string]interface{}{
+		"routing_key":  pd.RoutingKey,
+		"event_action": "resolve",
+		"dedup_key":    inc.dedupKey,
+	})
+}
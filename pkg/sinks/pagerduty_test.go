@@ -0,0 +1,53 @@
+package sinks
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeIncidentServer() *recordingServer {
+	return newRecordingServer(func(rw http.ResponseWriter, req *recordedRequest) {
+		rw.WriteHeader(http.StatusAccepted)
+	})
+}
+
+func TestPagerDutyTriggerAndResolve(t *testing.T) {
+	fis := newFakeIncidentServer()
+	defer fis.Close()
+
+	sink, err := NewPagerDutySink(map[string]interface{}{
+		"url":          fis.URL + "/v2/enqueue",
+		"routingKey":   "key",
+		"severity":     `{{ if eq .Reason "BackOff" }}critical{{ else }}warning{{ end }}`,
+		"resolveAfter": "300ms",
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)))
+	// count not increased, should not trigger again
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)))
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 2)))
+
+	payloads := fis.payloads(t)
+	require.Len(t, payloads, 2)
+	require.Equal(t, "trigger", payloads[0]["event_action"])
+	require.Equal(t, "key", payloads[0]["routing_key"])
+	require.Equal(t, "test/default/Pod/nginx/BackOff", payloads[0]["dedup_key"])
+	payload := payloads[1]["payload"].(map[string]interface{})
+	require.Equal(t, "critical", payload["severity"])
+	require.Equal(t, "test", payload["source"])
+	require.Equal(t, "2", payload["custom_details"].(map[string]interface{})["count"])
+
+	// the event stops recurring
+	require.Eventually(t, func() bool {
+		payloads = fis.payloads(t)
+		return len(payloads) == 3
+	}, time.Second*3, time.Millisecond*50)
+	require.Equal(t, "resolve", payloads[2]["event_action"])
+	require.Equal(t, "test/default/Pod/nginx/BackOff", payloads[2]["dedup_key"])
+}
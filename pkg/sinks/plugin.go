@@ -0,0 +1,216 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	eventexporterv1 "github.com/champly/eventexporter/api/eventexporter/v1"
+	"github.com/champly/eventexporter/pkg/kube"
+	"github.com/champly/eventexporter/pkg/plugin"
+	"github.com/hashicorp/go-hclog"
+	goplugin "github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// pluginPrefix is the prefix of plugin executables, the rest is the receiver name.
+	pluginPrefix = "eventexporter-sink-"
+
+	defaultPluginTimeout = time.Second * 10
+	defaultPluginRetry   = 2
+)
+
+var errPluginClosed = errors.New("plugin is closed")
+
+// LoadPlugins registers the executables named eventexporter-sink-<name> in dir as the
+// receivers <name>, the plugins are started when the receivers are initialized.
+func LoadPlugins(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read plugin dir %s failed: %v", dir, err)
+	}
+
+	for _, entry := range entries {
+		name := strings.TrimPrefix(entry.Name(), pluginPrefix)
+		if entry.IsDir() || name == entry.Name() || name == "" {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		info, err := os.Stat(path)
+		if err != nil || info.Mode()&0111 == 0 {
+			klog.Warningf("Skip plugin %s which is not executable.", path)
+			continue
+		}
+		if _, ok := factory[name]; ok {
+			return fmt.Errorf("plugin %s conflicts with receiver %s", path, name)
+		}
+		factory[name] = func(cfg interface{}) (Sink, error) {
+			return newPluginSink(name, path, cfg)
+		}
+		klog.Infof("Load plugin %s from %s", name, path)
+	}
+	return nil
+}
+
+type pluginSink struct {
+	sync.Mutex
+	name   string
+	path   string
+	config []byte
+	client *goplugin.Client
+	sink   eventexporterv1.SinkPluginClient
+	// closed stops restarting the plugin after Close.
+	closed bool
+}
+
+func newPluginSink(name, path string, cfg interface{}) (Sink, error) {
+	m := map[string]interface{}{}
+	if err := unmarshalConfig(name, cfg, &m); err != nil {
+		return nil, err
+	}
+	config, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s, marshal config failed: %v", name, err)
+	}
+
+	p := &pluginSink{name: name, path: path, config: config}
+	if _, err = p.get(); err != nil {
+		return nil, fmt.Errorf("init receiver %s plugin failed: %v", name, err)
+	}
+	return p, nil
+}
+
+// get returns the client of plugin, the plugin is started again when it exited.
+func (p *pluginSink) get() (eventexporterv1.SinkPluginClient, error) {
+	p.Lock()
+	defer p.Unlock()
+	if p.closed {
+		return nil, errPluginClosed
+	}
+	if p.client != nil && !p.client.Exited() {
+		return p.sink, nil
+	}
+	if p.client != nil {
+		klog.Warningf("Receiver %s plugin exited, restart it.", p.name)
+	}
+
+	client := goplugin.NewClient(&goplugin.ClientConfig{
+		HandshakeConfig:  plugin.Handshake,
+		Plugins:          goplugin.PluginSet{plugin.PluginName: &plugin.SinkPlugin{}},
+		Cmd:              exec.Command(p.path),
+		AllowedProtocols: []goplugin.Protocol{goplugin.ProtocolGRPC},
+		Logger: hclog.New(&hclog.LoggerOptions{
+			Name:   "plugin." + p.name,
+			Output: os.Stderr,
+			Level:  hclog.Info,
+		}),
+	})
+	sink, err := p.dispense(client)
+	if err != nil {
+		client.Kill()
+		return nil, err
+	}
+	p.client, p.sink = client, sink
+	return sink, nil
+}
+
+func (p *pluginSink) dispense(client *goplugin.Client) (eventexporterv1.SinkPluginClient, error) {
+	rpcClient, err := client.Client()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := rpcClient.Dispense(plugin.PluginName)
+	if err != nil {
+		return nil, err
+	}
+	sink := raw.(eventexporterv1.SinkPluginClient)
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultPluginTimeout)
+	defer cancel()
+	if _, err = sink.Configure(ctx, &eventexporterv1.ConfigureRequest{Config: p.config}); err != nil {
+		return nil, fmt.Errorf("configure failed: %v", err)
+	}
+	return sink, nil
+}
+
+func (p *pluginSink) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	req := &eventexporterv1.SendRequest{Event: ev.ToProto()}
+	return sendWithRetry(ctx, defaultPluginRetry, func(ctx context.Context) error {
+		sink, err := p.get()
+		if errors.Is(err, errPluginClosed) {
+			return err
+		}
+		if err != nil {
+			return newNetworkError(err)
+		}
+		ctx, cancel := context.WithTimeout(ctx, defaultPluginTimeout)
+		defer cancel()
+		_, err = sink.Send(ctx, req)
+		return classifyPluginError(err)
+	})
+}
+
+func (p *pluginSink) OnObjectDeleted(ctx context.Context, clusterName string, reference *corev1.ObjectReference) error {
+	sink, err := p.get()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, defaultPluginTimeout)
+	defer cancel()
+	_, err = sink.ObjectDeleted(ctx, &eventexporterv1.ObjectDeletedRequest{
+		ClusterName: clusterName,
+		Object:      kube.ObjectReferenceToProto(reference),
+	})
+	if status.Code(err) == codes.Unimplemented {
+		return nil
+	}
+	return err
+}
+
+// Close closes the sink of plugin and kills the plugin, the plugin isn't started again.
+func (p *pluginSink) Close() {
+	p.Lock()
+	defer p.Unlock()
+	p.closed = true
+	if p.client == nil {
+		return
+	}
+	if !p.client.Exited() {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultPluginTimeout)
+		if _, err := p.sink.Close(ctx, &eventexporterv1.CloseRequest{}); err != nil {
+			klog.Errorf("Receiver %s close plugin failed: %+v", p.name, err)
+		}
+		cancel()
+	}
+	p.client.Kill()
+	p.client = nil
+}
+
+// classifyPluginError converts the grpc status of plugin to SendError.
+func classifyPluginError(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted:
+		return newNetworkError(err)
+	case codes.ResourceExhausted:
+		return newStatusError(http.StatusTooManyRequests, err)
+	}
+	return newStatusError(http.StatusBadRequest, err)
+}
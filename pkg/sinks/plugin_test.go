@@ -0,0 +1,180 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	eventexporterv1 "github.com/champly/eventexporter/api/eventexporter/v1"
+	"github.com/champly/eventexporter/pkg/plugin"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const fakePluginEnv = "EVENTEXPORTER_TEST_FAKE_PLUGIN"
+
+// TestMain serves the fake plugin when the test binary is started as a plugin.
+func TestMain(m *testing.M) {
+	if os.Getenv(fakePluginEnv) != "" {
+		plugin.Serve(&fakePlugin{})
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakePlugin appends the events to the file out, it crashes once on the event of
+// reason Crash.
+type fakePlugin struct {
+	Out   string `json:"out"`
+	Crash string `json:"crash"`
+}
+
+func (p *fakePlugin) Configure(config []byte) error {
+	if err := json.Unmarshal(config, p); err != nil {
+		return err
+	}
+	if p.Out == "" {
+		return errors.New("out must be set")
+	}
+	return nil
+}
+
+func (p *fakePlugin) Send(ctx context.Context, ev *eventexporterv1.Event) error {
+	switch ev.Reason {
+	case "Crash":
+		if _, err := os.Stat(p.Crash); os.IsNotExist(err) {
+			_ = os.WriteFile(p.Crash, nil, 0644)
+			os.Exit(1)
+		}
+	case "Invalid":
+		return errors.New("invalid event")
+	}
+	return p.write(fmt.Sprintf("%s %s/%s %s", ev.Reason, ev.InvolvedObject.Namespace, ev.InvolvedObject.Name, ev.ClusterName))
+}
+
+func (p *fakePlugin) OnObjectDeleted(ctx context.Context, clusterName string, reference *eventexporterv1.ObjectReference) error {
+	return p.write(fmt.Sprintf("deleted %s/%s %s", reference.Namespace, reference.Name, clusterName))
+}
+
+func (p *fakePlugin) Close() error {
+	return p.write("closed")
+}
+
+func (p *fakePlugin) write(line string) error {
+	f, err := os.OpenFile(p.Out, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(line + "\n")
+	return err
+}
+
+func loadFakePlugin(t *testing.T) {
+	exe, err := os.Executable()
+	require.NoError(t, err)
+	dir := t.TempDir()
+	require.NoError(t, os.Symlink(exe, filepath.Join(dir, pluginPrefix+"fake")))
+	// the files without prefix are ignored.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), nil, 0755))
+	t.Setenv(fakePluginEnv, "true")
+
+	require.NoError(t, LoadPlugins(dir))
+	t.Cleanup(func() { delete(factory, "fake") })
+	require.Error(t, LoadPlugins(dir))
+	_, ok := factory["README"]
+	require.False(t, ok)
+}
+
+func TestPluginSend(t *testing.T) {
+	loadFakePlugin(t)
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	sink, err := factory["fake"](map[string]interface{}{
+		"out":   out,
+		"crash": filepath.Join(dir, "crash"),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)))
+	// the plugin is restarted and the event is sent again after it crashed.
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.crash", "Crash", 1)))
+	require.NoError(t, sink.(ObjectDeleteNotifier).OnObjectDeleted(context.TODO(), "test", &corev1.ObjectReference{Namespace: "default", Name: "nginx"}))
+
+	err = sink.Send(context.TODO(), buildTestEvent("nginx.invalid", "Invalid", 1))
+	require.Error(t, err)
+	require.False(t, IsRetryable(err))
+	sink.Close()
+	// the plugin isn't started again after closed.
+	require.ErrorIs(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)), errPluginClosed)
+
+	b, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"BackOff default/nginx test",
+		"Crash default/nginx test",
+		"deleted default/nginx test",
+		"closed",
+	}, strings.Split(strings.TrimSpace(string(b)), "\n"))
+
+	// the config is validated by plugin.
+	_, err = factory["fake"](map[string]interface{}{})
+	require.Error(t, err)
+}
+
+// TestJSONFileExamplePlugin builds the example plugin in cmd and sends events with it.
+func TestJSONFileExamplePlugin(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip building the example plugin in short mode")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not found")
+	}
+	dir := t.TempDir()
+	build := exec.Command(goBin, "build", "-o", filepath.Join(dir, pluginPrefix+"jsonfile"), "../../cmd/eventexporter-sink-jsonfile")
+	out, err := build.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	require.NoError(t, LoadPlugins(dir))
+	t.Cleanup(func() { delete(factory, "jsonfile") })
+	path := filepath.Join(t.TempDir(), "events.json")
+	sink, err := factory["jsonfile"](map[string]interface{}{"path": path})
+	require.NoError(t, err)
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 2)))
+	sink.Close()
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(t, lines, 1)
+	ev := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &ev))
+	require.Equal(t, "BackOff", ev["reason"])
+	require.Equal(t, float64(2), ev["count"])
+
+	// the config is validated by plugin.
+	_, err = factory["jsonfile"](map[string]interface{}{})
+	require.Error(t, err)
+
+	// the plugin named as a built-in receiver is rejected.
+	conflict := t.TempDir()
+	require.NoError(t, os.Symlink(filepath.Join(dir, pluginPrefix+"jsonfile"), filepath.Join(conflict, pluginPrefix+FileSinkName)))
+	require.Error(t, LoadPlugins(conflict))
+}
+
+func TestClassifyPluginError(t *testing.T) {
+	require.NoError(t, classifyPluginError(nil))
+	require.True(t, IsRetryable(classifyPluginError(status.Error(codes.Unavailable, "unavailable"))))
+	require.True(t, IsRetryable(classifyPluginError(status.Error(codes.ResourceExhausted, "too many"))))
+	require.False(t, IsRetryable(classifyPluginError(status.Error(codes.Unknown, "unknown"))))
+	require.False(t, IsRetryable(classifyPluginError(errors.New("plain"))))
+}
@@ -0,0 +1,362 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/champly/eventexporter/pkg/kube"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"k8s.io/klog/v2"
+)
+
+const (
+	PrometheusSinkName = "prometheus"
+
+	prometheusCounter          = "counter"
+	prometheusGauge            = "gauge"
+	defaultPrometheusMaxSeries = 10000
+	defaultPrometheusExpiry    = time.Hour
+	defaultPrometheusHelp      = "Kubernetes events exported by eventexporter."
+	defaultPrometheusCounter   = "1"
+	defaultPrometheusGauge     = "{{ .Count }}"
+
+	// prometheusMetricPrefix prefixes the metric names, so the templated names can't
+	// collide with the other metrics such as go_* and process_* on /metrics.
+	prometheusMetricPrefix = "eventexporter_event_"
+)
+
+// defaultPrometheusMetrics counts the events by object and reason.
+var defaultPrometheusMetrics = []prometheusMetricConfig{
+	{
+		Name: "total",
+		Type: prometheusCounter,
+		Labels: map[string]string{
+			"cluster":   "{{ .InvolvedObject.ClusterName }}",
+			"namespace": "{{ .Event.InvolvedObject.Namespace }}",
+			"kind":      "{{ .Event.InvolvedObject.Kind }}",
+			"reason":    "{{ .Reason }}",
+			"type":      "{{ .Type }}",
+		},
+	},
+}
+
+var (
+	promRegisterOnce sync.Once
+	// promCollector collects the series of all the prometheus sinks, it's registered
+	// once because unchecked collectors can't be unregistered.
+	promCollector = &prometheusCollector{families: map[string]*prometheusFamily{}}
+)
+
+func init() {
+	factory[PrometheusSinkName] = NewPrometheusSink
+}
+
+type prometheusConfig struct {
+	// Metrics are the metrics updated by every event, the events count by object and
+	// reason when it's empty.
+	Metrics []prometheusMetricConfig `yaml:"metrics"`
+	// MaxSeries limits the series of the sink, the new series are dropped when it's reached.
+	MaxSeries int `yaml:"maxSeries"`
+	// Expiry removes the series which are not updated within it.
+	Expiry time.Duration `yaml:"expiry"`
+}
+
+type prometheusMetricConfig struct {
+	// Name is the template of metric name, it's prefixed with eventexporter_event_ and
+	// the invalid characters are replaced with _.
+	Name string `yaml:"name"`
+	// Type is counter (default) or gauge.
+	Type string `yaml:"type"`
+	Help string `yaml:"help"`
+	// Labels are the templates of label values.
+	Labels map[string]string `yaml:"labels"`
+	// Value is the template of value, counters are increased by it (default 1) and
+	// gauges are set to it (default the count of event).
+	Value string `yaml:"value"`
+}
+
+type prometheusFamily struct {
+	owner      *prometheusSink
+	help       string
+	valueType  prometheus.ValueType
+	labelNames []string
+	desc       *prometheus.Desc
+	series     map[string]*prometheusSeries
+}
+
+type prometheusSeries struct {
+	labelValues []string
+	value       float64
+	updated     time.Time
+}
+
+type prometheusCollector struct {
+	sync.Mutex
+	families map[string]*prometheusFamily
+}
+
+// Describe sends no descriptors, so the collector is unchecked and the metrics are
+// created by events.
+func (c *prometheusCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *prometheusCollector) Collect(ch chan<- prometheus.Metric) {
+	c.Lock()
+	defer c.Unlock()
+	for name, f := range c.families {
+		for _, s := range f.series {
+			// the series are validated on update, one invalid series must not fail the others.
+			m, err := prometheus.NewConstMetric(f.desc, f.valueType, s.value, s.labelValues...)
+			if err != nil {
+				klog.Errorf("Receiver %s collect metric %s failed: %+v", PrometheusSinkName, name, err)
+				continue
+			}
+			ch <- m
+		}
+	}
+}
+
+type prometheusSink struct {
+	*prometheusConfig
+	// series is the number of series owned by the sink, it's guarded by promCollector.
+	series int
+	// limited is set when the max series is reached, it's guarded by promCollector.
+	limited  bool
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func NewPrometheusSink(cfg interface{}) (Sink, error) {
+	promCfg := &prometheusConfig{}
+	if err := unmarshalConfig(PrometheusSinkName, cfg, promCfg); err != nil {
+		return nil, err
+	}
+	if len(promCfg.Metrics) == 0 {
+		promCfg.Metrics = defaultPrometheusMetrics
+	}
+	for i := range promCfg.Metrics {
+		m := &promCfg.Metrics[i]
+		if m.Name == "" {
+			return nil, fmt.Errorf("init receiver %s, name of metric %d must be set", PrometheusSinkName, i)
+		}
+		if m.Type == "" {
+			m.Type = prometheusCounter
+		}
+		if m.Help == "" {
+			m.Help = defaultPrometheusHelp
+		}
+		switch m.Type {
+		case prometheusCounter:
+			if m.Value == "" {
+				m.Value = defaultPrometheusCounter
+			}
+		case prometheusGauge:
+			if m.Value == "" {
+				m.Value = defaultPrometheusGauge
+			}
+		default:
+			return nil, fmt.Errorf("init receiver %s, metric %s type %s not supported, must be %s or %s", PrometheusSinkName, m.Name, m.Type, prometheusCounter, prometheusGauge)
+		}
+		for name := range m.Labels {
+			if !model.LabelName(name).IsValid() || strings.HasPrefix(name, model.ReservedLabelPrefix) {
+				return nil, fmt.Errorf("init receiver %s, metric %s label name %s is invalid", PrometheusSinkName, m.Name, name)
+			}
+		}
+	}
+	if promCfg.MaxSeries <= 0 {
+		promCfg.MaxSeries = defaultPrometheusMaxSeries
+	}
+	if promCfg.Expiry <= 0 {
+		promCfg.Expiry = defaultPrometheusExpiry
+	}
+
+	promRegisterOnce.Do(func() {
+		prometheus.MustRegister(promCollector)
+	})
+	p := &prometheusSink{
+		prometheusConfig: promCfg,
+		stopCh:           make(chan struct{}),
+	}
+	p.wg.Add(1)
+	go p.expireLoop()
+	klog.Infof("Prometheus metrics: %d, max series: %d, expiry: %s", len(promCfg.Metrics), promCfg.MaxSeries, promCfg.Expiry)
+	return p, nil
+}
+
+// Send updates the series of every metric.
+func (p *prometheusSink) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	for i := range p.Metrics {
+		if err := p.update(&p.Metrics[i], ev); err != nil {
+			return fmt.Errorf("update metric %s failed: %v", p.Metrics[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// Close removes the series of the sink.
+func (p *prometheusSink) Close() {
+	p.stopOnce.Do(func() {
+		close(p.stopCh)
+	})
+	p.wg.Wait()
+
+	promCollector.Lock()
+	defer promCollector.Unlock()
+	for name, f := range promCollector.families {
+		if f.owner == p {
+			delete(promCollector.families, name)
+		}
+	}
+	p.series = 0
+}
+
+func (p *prometheusSink) update(m *prometheusMetricConfig, ev *kube.EnhancedEvent) error {
+	name, err := getLayoutString(ev, m.Name)
+	if err != nil {
+		return err
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		return fmt.Errorf("metric name is empty")
+	}
+	name = sanitizeMetricName(prometheusMetricPrefix + name)
+	v, err := getLayoutString(ev, m.Value)
+	if err != nil {
+		return err
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil {
+		return fmt.Errorf("parse value %q failed: %v", v, err)
+	}
+	if m.Type == prometheusCounter && value < 0 {
+		return fmt.Errorf("counter can't be decreased by %v", value)
+	}
+
+	labelNames := make([]string, 0, len(m.Labels))
+	for k := range m.Labels {
+		labelNames = append(labelNames, k)
+	}
+	sort.Strings(labelNames)
+	labelValues := make([]string, len(labelNames))
+	for i, k := range labelNames {
+		if labelValues[i], err = getLayoutString(ev, m.Labels[k]); err != nil {
+			return fmt.Errorf("render label %s failed: %v", k, err)
+		}
+		if !utf8.ValidString(labelValues[i]) {
+			return fmt.Errorf("label %s value %q is not valid utf-8", k, labelValues[i])
+		}
+	}
+
+	promCollector.Lock()
+	defer promCollector.Unlock()
+
+	valueType := prometheus.CounterValue
+	if m.Type == prometheusGauge {
+		valueType = prometheus.GaugeValue
+	}
+	f, ok := promCollector.families[name]
+	if !ok {
+		f = &prometheusFamily{
+			owner:      p,
+			help:       m.Help,
+			valueType:  valueType,
+			labelNames: labelNames,
+			desc:       prometheus.NewDesc(name, m.Help, labelNames, nil),
+			series:     map[string]*prometheusSeries{},
+		}
+		promCollector.families[name] = f
+	}
+	// the series of one family must have the same type, help and label names, or the
+	// metrics endpoint fails.
+	if f.owner != p || f.valueType != valueType || f.help != m.Help || strings.Join(f.labelNames, ",") != strings.Join(labelNames, ",") {
+		return fmt.Errorf("metric %s is defined by another metric or receiver with different type, help or labels", name)
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		if p.series >= p.MaxSeries {
+			if !p.limited {
+				p.limited = true
+				klog.Warningf("Receiver %s reached max series %d, drop the new series of %s", PrometheusSinkName, p.MaxSeries, name)
+			}
+			return nil
+		}
+		s = &prometheusSeries{labelValues: labelValues}
+		f.series[key] = s
+		p.series++
+	}
+	if m.Type == prometheusCounter {
+		s.value += value
+	} else {
+		s.value = value
+	}
+	s.updated = time.Now()
+	return nil
+}
+
+func (p *prometheusSink) expireLoop() {
+	defer p.wg.Done()
+
+	interval := p.Expiry / 2
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.expire(time.Now().Add(-p.Expiry))
+		case <-p.stopCh:
+			return
+		}
+	}
+}
+
+// expire removes the series which are not updated since deadline.
+func (p *prometheusSink) expire(deadline time.Time) {
+	promCollector.Lock()
+	defer promCollector.Unlock()
+
+	expired := 0
+	for name, f := range promCollector.families {
+		if f.owner != p {
+			continue
+		}
+		for key, s := range f.series {
+			if s.updated.Before(deadline) {
+				delete(f.series, key)
+				expired++
+			}
+		}
+		if len(f.series) == 0 {
+			delete(promCollector.families, name)
+		}
+	}
+	p.series -= expired
+	if p.series < p.MaxSeries {
+		p.limited = false
+	}
+	if expired > 0 {
+		klog.V(4).Infof("Receiver %s expired %d series.", PrometheusSinkName, expired)
+	}
+}
+
+// sanitizeMetricName replaces the characters which are invalid in metric name with _.
+func sanitizeMetricName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		valid := c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9' && i > 0)
+		if !valid {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,126 @@
+package sinks
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusCounter(t *testing.T) {
+	sink, err := NewPrometheusSink(map[string]interface{}{})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)))
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 2)))
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.oom", "OOMKilled", 1)))
+
+	require.NoError(t, testutil.CollectAndCompare(promCollector, strings.NewReader(`
+# HELP eventexporter_event_total Kubernetes events exported by eventexporter.
+# TYPE eventexporter_event_total counter
+eventexporter_event_total{cluster="test",kind="Pod",namespace="default",reason="BackOff",type="Warning"} 2
+eventexporter_event_total{cluster="test",kind="Pod",namespace="default",reason="OOMKilled",type="Warning"} 1
+`)))
+
+	// the series which are not updated are expired.
+	sink.(*prometheusSink).expire(time.Now().Add(time.Second))
+	require.Equal(t, 0, testutil.CollectAndCount(promCollector))
+}
+
+func TestPrometheusGaugeAndLimit(t *testing.T) {
+	sink, err := NewPrometheusSink(map[string]interface{}{
+		"maxSeries": 2,
+		"metrics": []interface{}{
+			map[string]interface{}{
+				"name":   "{{ .Reason | lower }}_count",
+				"type":   "gauge",
+				"help":   "Count of event.",
+				"labels": map[string]string{"name": "{{ .Event.InvolvedObject.Name }}"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	ev := buildTestEvent("nginx.backoff", "Back-Off", 3)
+	require.NoError(t, sink.Send(context.TODO(), ev))
+	ev.Count = 5
+	require.NoError(t, sink.Send(context.TODO(), ev))
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.oom", "OOMKilled", 1)))
+	// the new series is dropped when max series is reached.
+	ev.Event.InvolvedObject.Name = "redis"
+	require.NoError(t, sink.Send(context.TODO(), ev))
+
+	require.NoError(t, testutil.CollectAndCompare(promCollector, strings.NewReader(`
+# HELP eventexporter_event_back_off_count Count of event.
+# TYPE eventexporter_event_back_off_count gauge
+eventexporter_event_back_off_count{name="nginx"} 5
+# HELP eventexporter_event_oomkilled_count Count of event.
+# TYPE eventexporter_event_oomkilled_count gauge
+eventexporter_event_oomkilled_count{name="nginx"} 1
+`)))
+}
+
+func TestPrometheusInvalidLabelValue(t *testing.T) {
+	sink, err := NewPrometheusSink(map[string]interface{}{
+		"metrics": []interface{}{
+			map[string]interface{}{
+				"name":   "message_total",
+				"labels": map[string]string{"message": "{{ .Message | trunc 1 }}"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	// trunc cuts the multi-byte character.
+	ev := buildTestEvent("nginx.backoff", "BackOff", 1)
+	ev.Message = "é"
+	require.Error(t, sink.Send(context.TODO(), ev))
+	require.Equal(t, 0, testutil.CollectAndCount(promCollector))
+}
+
+func TestPrometheusConfig(t *testing.T) {
+	_, err := NewPrometheusSink(map[string]interface{}{
+		"metrics": []interface{}{map[string]interface{}{"name": "x", "type": "histogram"}},
+	})
+	require.Error(t, err)
+	_, err = NewPrometheusSink(map[string]interface{}{
+		"metrics": []interface{}{map[string]interface{}{"name": "x", "labels": map[string]string{"a-b": "x"}}},
+	})
+	require.Error(t, err)
+
+	// the metrics of the same name must have the same labels.
+	sink, err := NewPrometheusSink(map[string]interface{}{
+		"metrics": []interface{}{
+			map[string]interface{}{"name": "kube_event_conflict_total"},
+			map[string]interface{}{"name": "kube_event_conflict_total", "labels": map[string]string{"reason": "{{ .Reason }}"}},
+		},
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+	require.Error(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)))
+
+	// the templated names are prefixed, so they can't collide with the other metrics.
+	sink, err = NewPrometheusSink(map[string]interface{}{
+		"metrics": []interface{}{map[string]interface{}{"name": "{{ .Reason }}"}},
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.gc", "go_gc_duration_seconds", 1)))
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	names := []string{}
+	for _, f := range families {
+		names = append(names, f.GetName())
+	}
+	require.Contains(t, names, "eventexporter_event_go_gc_duration_seconds")
+
+	require.Equal(t, "kube_event_0_a_b", sanitizeMetricName("kube_event_0.a-b"))
+	require.Equal(t, "_abc", sanitizeMetricName("1abc"))
+}
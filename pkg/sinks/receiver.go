@@ -5,6 +5,8 @@ import (
 	"fmt"
 
 	"github.com/champly/eventexporter/pkg/kube"
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
 )
 
@@ -35,17 +37,44 @@ func InitReceiver(cfg ReceiverConfig) error {
 	return nil
 }
 
-func SendEvent(name string, ev *kube.EnhancedEvent) {
+// unmarshalConfig converts the receiver config to the config struct of the sink.
+func unmarshalConfig(name string, cfg interface{}, out interface{}) error {
+	b, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("init receiver, marshal interface{} to yaml %s config {%+v} failed: %v", name, cfg, err)
+	}
+
+	err = yaml.Unmarshal(b, out)
+	if err != nil {
+		return fmt.Errorf("init receiver, unmarshal yaml to %s config failed: %v, config -> %s", name, err, b)
+	}
+	return nil
+}
+
+func SendEvent(ctx context.Context, name string, ev *kube.EnhancedEvent) {
 	sink, ok := initedReceiver[name]
 	if !ok {
 		klog.Errorf("Not config %s receiver", name)
 		return
 	}
-	if err := sink.Send(context.TODO(), ev); err != nil {
+	if err := sink.Send(ctx, ev); err != nil {
 		klog.Errorf("Receiver %s cannot send event: %+v", name, err)
 	}
 }
 
+// ObjectDeleted fans out the deletion of an involved object to every sink which implements ObjectDeleteNotifier.
+func ObjectDeleted(clusterName string, reference *corev1.ObjectReference) {
+	for name, sink := range initedReceiver {
+		notifier, ok := sink.(ObjectDeleteNotifier)
+		if !ok {
+			continue
+		}
+		if err := notifier.OnObjectDeleted(context.TODO(), clusterName, reference); err != nil {
+			klog.Errorf("Receiver %s cannot handle deleted object %s/%s: %+v", name, reference.Namespace, reference.Name, err)
+		}
+	}
+}
+
 func Close() {
 	for _, sink := range initedReceiver {
 		sink.Close()
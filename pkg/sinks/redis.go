@@ -0,0 +1,162 @@
+package sinks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/champly/eventexporter/pkg/kube"
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog/v2"
+)
+
+const (
+	RedisSinkName = "redis"
+
+	defaultRedisField   = "event"
+	defaultRedisTimeout = time.Second * 5
+	defaultRedisRetry   = 2
+)
+
+func init() {
+	factory[RedisSinkName] = NewRedisSink
+}
+
+type redisConfig struct {
+	Addr      string     `yaml:"addr"`
+	Username  string     `yaml:"username"`
+	Password  string     `yaml:"password"`
+	DB        int        `yaml:"db"`
+	TLSConfig *tlsConfig `yaml:"tlsConfig"`
+	// Stream is the template of stream key.
+	Stream string `yaml:"stream"`
+	// MaxLen trims the stream approximately with MAXLEN ~, 0 is unlimited.
+	MaxLen int64 `yaml:"maxLen"`
+	// Field is the entry field of serialized event, default is event.
+	Field string `yaml:"field"`
+	// Layout is the layout of serialized event, the whole event is sent when it's empty.
+	Layout map[string]interface{} `yaml:"layout"`
+	// Fields are the templates of extra entry fields.
+	Fields     map[string]string `yaml:"fields"`
+	Timeout    time.Duration     `yaml:"timeout"`
+	MaxRetries *int              `yaml:"maxRetries"`
+}
+
+// redisSink appends events to redis streams with XADD, the client redials the broken
+// connections of pool.
+type redisSink struct {
+	*redisConfig
+	client     *redis.Client
+	maxRetries int
+}
+
+func NewRedisSink(cfg interface{}) (Sink, error) {
+	redisCfg := &redisConfig{}
+	if err := unmarshalConfig(RedisSinkName, cfg, redisCfg); err != nil {
+		return nil, err
+	}
+	if redisCfg.Addr == "" || redisCfg.Stream == "" {
+		return nil, fmt.Errorf("init receiver %s, addr and stream must be set", RedisSinkName)
+	}
+	if redisCfg.Field == "" {
+		redisCfg.Field = defaultRedisField
+	}
+	if redisCfg.Timeout <= 0 {
+		redisCfg.Timeout = defaultRedisTimeout
+	}
+
+	opts := &redis.Options{
+		Addr:         redisCfg.Addr,
+		Username:     redisCfg.Username,
+		Password:     redisCfg.Password,
+		DB:           redisCfg.DB,
+		DialTimeout:  redisCfg.Timeout,
+		ReadTimeout:  redisCfg.Timeout,
+		WriteTimeout: redisCfg.Timeout,
+		// retried by sendWithRetry.
+		MaxRetries: -1,
+	}
+	if redisCfg.TLSConfig != nil {
+		tlsCfg, err := redisCfg.TLSConfig.build()
+		if err != nil {
+			return nil, fmt.Errorf("init receiver %s tls config failed: %v", RedisSinkName, err)
+		}
+		opts.TLSConfig = tlsCfg
+	}
+
+	r := &redisSink{
+		redisConfig: redisCfg,
+		client:      redis.NewClient(opts),
+		maxRetries:  defaultRedisRetry,
+	}
+	if redisCfg.MaxRetries != nil {
+		r.maxRetries = *redisCfg.MaxRetries
+	}
+	klog.Infof("Redis addr: %s, stream: %s", redisCfg.Addr, redisCfg.Stream)
+	return r, nil
+}
+
+func (r *redisSink) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	args, err := r.buildArgs(ev)
+	if err != nil {
+		return err
+	}
+	return sendWithRetry(ctx, r.maxRetries, func(ctx context.Context) error {
+		return classifyRedisError(r.client.XAdd(ctx, args).Err())
+	})
+}
+
+func (r *redisSink) Close() {
+	if err := r.client.Close(); err != nil {
+		klog.Warningf("Receiver %s close client failed: %v", RedisSinkName, err)
+	}
+}
+
+func (r *redisSink) buildArgs(ev *kube.EnhancedEvent) (*redis.XAddArgs, error) {
+	stream, err := getLayoutString(ev, r.Stream)
+	if err != nil {
+		return nil, fmt.Errorf("render stream failed: %v", err)
+	}
+	if stream = strings.TrimSpace(stream); stream == "" {
+		return nil, fmt.Errorf("stream of %s/%s is empty", ev.Namespace, ev.Name)
+	}
+	data, err := serializeEventWithLayout(r.Layout, ev)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := getLayoutLabels(ev, r.Fields)
+	values := make([]interface{}, 0, len(fields)*2+2)
+	values = append(values, r.Field, data)
+	for _, k := range sortedKeys(fields) {
+		if k != r.Field {
+			values = append(values, k, fields[k])
+		}
+	}
+	return &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: r.MaxLen,
+		Approx: r.MaxLen > 0,
+		Values: values,
+	}, nil
+}
+
+// classifyRedisError treats the error replies as rejected except the temporary ones.
+func classifyRedisError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		for _, prefix := range []string{"LOADING", "READONLY", "MASTERDOWN", "TRYAGAIN", "CLUSTERDOWN", "BUSY"} {
+			if strings.HasPrefix(redisErr.Error(), prefix) {
+				return newStatusError(http.StatusServiceUnavailable, err)
+			}
+		}
+		return newStatusError(http.StatusBadRequest, err)
+	}
+	return newNetworkError(err)
+}
@@ -0,0 +1,48 @@
+package sinks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisStream(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	sink, err := NewRedisSink(map[string]interface{}{
+		"addr":   mr.Addr(),
+		"stream": "events:{{ .InvolvedObject.ClusterName }}",
+		"layout": map[string]interface{}{"reason": "{{ .Reason }}"},
+		"fields": map[string]interface{}{"namespace": "{{ .Event.InvolvedObject.Namespace }}"},
+		"maxLen": 100,
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)))
+	entries, err := mr.Stream("events:test")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, []string{"event", `{"reason":"BackOff"}`, "namespace", "default"}, entries[0].Values)
+
+	// the broken connection is redialed.
+	mr.Close()
+	err = sink.Send(context.TODO(), buildTestEvent("nginx.started", "Started", 1))
+	require.Error(t, err)
+	require.True(t, IsRetryable(err))
+	require.NoError(t, mr.Restart())
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.started", "Started", 1)))
+	entries, err = mr.Stream("events:test")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// the wrong type is rejected without retry.
+	mr.Set("events:wrong", "string")
+	wrong := buildTestEvent("nginx.started", "Started", 1)
+	wrong.InvolvedObject.ClusterName = "wrong"
+	err = sink.Send(context.TODO(), wrong)
+	require.Error(t, err)
+	require.False(t, IsRetryable(err))
+}
@@ -0,0 +1,556 @@
+package sinks
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Masterminds/sprig"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/champly/eventexporter/pkg/kube"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+	"k8s.io/klog/v2"
+)
+
+const (
+	S3SinkName = "s3"
+
+	s3FormatNDJSON  = "ndjson"
+	s3FormatParquet = "parquet"
+
+	s3CompressionGzip = "gzip"
+	s3CompressionNone = "none"
+
+	defaultS3Region          = "us-east-1"
+	defaultS3Key             = `events/cluster={{ .Cluster }}/date={{ .Date.Format "2006-01-02" }}/{{ .Time.Format "20060102T150405Z" }}-{{ .ID }}`
+	defaultS3MaxObjectSizeMB = 64
+	defaultS3FlushInterval   = time.Minute * 5
+	defaultS3Concurrency     = 2
+	defaultS3Timeout         = time.Minute * 5
+	defaultS3Retry           = 3
+	s3UploadQueueCapacity    = 16
+)
+
+func init() {
+	factory[S3SinkName] = NewS3Sink
+}
+
+type s3Config struct {
+	Bucket string `yaml:"bucket"`
+	// Endpoint is the url of s3 compatible storage such as minio, empty is aws s3.
+	Endpoint string `yaml:"endpoint"`
+	Region   string `yaml:"region"`
+	// ForcePathStyle uses http://endpoint/bucket/key instead of http://bucket.endpoint/key, minio requires it.
+	ForcePathStyle bool `yaml:"forcePathStyle"`
+	// AccessKeyID and SecretAccessKey are static credentials, the default credential chain
+	// (env, shared config, web identity and instance role) is used when they're empty.
+	AccessKeyID     string `yaml:"accessKeyID"`
+	SecretAccessKey string `yaml:"secretAccessKey"`
+	SessionToken    string `yaml:"sessionToken"`
+	// Key is the template of object key, the data is s3ObjectKey. The extension .ndjson,
+	// .ndjson.gz or .parquet is appended.
+	Key string `yaml:"key"`
+	// Format is ndjson (default) or parquet, the parquet objects have the columns of
+	// s3ParquetRow.
+	Format string `yaml:"format"`
+	// Compression is gzip (default) or none, it compresses the whole ndjson object or the
+	// column pages of parquet.
+	Compression string `yaml:"compression"`
+	// Layout is the layout of every ndjson line, the whole event is written when it's empty.
+	// It isn't supported by parquet.
+	Layout map[string]interface{} `yaml:"layout"`
+	// MaxObjectSizeMB uploads the object when the uncompressed size exceeds it.
+	MaxObjectSizeMB int `yaml:"maxObjectSizeMB"`
+	// FlushInterval uploads the object when it's opened longer than it.
+	FlushInterval time.Duration `yaml:"flushInterval"`
+	// PartSizeMB is the part size of multipart upload, the objects smaller than it are
+	// uploaded with one request. The min and default is 5.
+	PartSizeMB int `yaml:"partSizeMB"`
+	// Concurrency is the number of objects uploaded concurrently.
+	Concurrency  int        `yaml:"concurrency"`
+	StorageClass string     `yaml:"storageClass"`
+	TLSConfig    *tlsConfig `yaml:"tlsConfig"`
+	// Timeout limits the upload of every object.
+	Timeout    time.Duration `yaml:"timeout"`
+	MaxRetries *int          `yaml:"maxRetries"`
+}
+
+// s3ObjectKey is the data of key template.
+type s3ObjectKey struct {
+	Cluster string
+	// Date is the partition date of events, UTC.
+	Date time.Time
+	// Time is the time the object is opened, UTC.
+	Time time.Time
+	// ID is a random hex string which keeps the keys unique across replicas.
+	ID string
+}
+
+// s3ParquetRow is the row of parquet objects, the timestamps are unix milliseconds.
+type s3ParquetRow struct {
+	Cluster           string            `parquet:"name=cluster, type=BYTE_ARRAY, convertedtype=UTF8"`
+	UID               string            `parquet:"name=uid, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Namespace         string            `parquet:"name=namespace, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Name              string            `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Kind              string            `parquet:"name=kind, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ObjectNamespace   string            `parquet:"name=object_namespace, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ObjectName        string            `parquet:"name=object_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ObjectUID         string            `parquet:"name=object_uid, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Type              string            `parquet:"name=type, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Reason            string            `parquet:"name=reason, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Message           string            `parquet:"name=message, type=BYTE_ARRAY, convertedtype=UTF8"`
+	SourceComponent   string            `parquet:"name=source_component, type=BYTE_ARRAY, convertedtype=UTF8"`
+	SourceHost        string            `parquet:"name=source_host, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Count             int32             `parquet:"name=count, type=INT32"`
+	FirstTimestamp    int64             `parquet:"name=first_timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	LastTimestamp     int64             `parquet:"name=last_timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Labels            map[string]string `parquet:"name=labels, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	Annotations       map[string]string `parquet:"name=annotations, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	ObjectLabels      map[string]string `parquet:"name=object_labels, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	ObjectAnnotations map[string]string `parquet:"name=object_annotations, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+}
+
+// s3Object buffers the lines or rows of a partition.
+type s3Object struct {
+	key     s3ObjectKey
+	buf     *bytes.Buffer
+	w       io.Writer
+	gz      *gzip.Writer
+	pw      *writer.ParquetWriter
+	size    int
+	lines   int
+	created time.Time
+}
+
+// s3Sink archives events into newline-delimited JSON or parquet objects partitioned by
+// cluster and date, the objects are uploaded when they're large or old enough.
+type s3Sink struct {
+	*s3Config
+	keyTmpl  *template.Template
+	ext      string
+	maxSize  int
+	uploader *manager.Uploader
+	// objects are the open objects by partition, pending are the full objects which
+	// were not queued before the context of Send is done, they're queued by the next flush.
+	objects map[string]*s3Object
+	pending []*s3Object
+	stopped bool
+	sync.Mutex
+	// sending waits for the Sends queueing the objects before the upload queue is closed.
+	sending sync.WaitGroup
+	uploads chan *s3Object
+	wg      sync.WaitGroup
+	stopCh  chan struct{}
+	done    chan struct{}
+}
+
+func NewS3Sink(cfg interface{}) (Sink, error) {
+	s3Cfg := &s3Config{}
+	if err := unmarshalConfig(S3SinkName, cfg, s3Cfg); err != nil {
+		return nil, err
+	}
+	if s3Cfg.Bucket == "" {
+		return nil, fmt.Errorf("init receiver %s, bucket must be set", S3SinkName)
+	}
+	if s3Cfg.Region == "" {
+		s3Cfg.Region = defaultS3Region
+	}
+	if s3Cfg.Key == "" {
+		s3Cfg.Key = defaultS3Key
+	}
+	if s3Cfg.MaxObjectSizeMB <= 0 {
+		s3Cfg.MaxObjectSizeMB = defaultS3MaxObjectSizeMB
+	}
+	if s3Cfg.FlushInterval <= 0 {
+		s3Cfg.FlushInterval = defaultS3FlushInterval
+	}
+	if s3Cfg.Concurrency <= 0 {
+		s3Cfg.Concurrency = defaultS3Concurrency
+	}
+	if s3Cfg.Timeout <= 0 {
+		s3Cfg.Timeout = defaultS3Timeout
+	}
+
+	s := &s3Sink{
+		s3Config: s3Cfg,
+		maxSize:  s3Cfg.MaxObjectSizeMB * 1024 * 1024,
+		objects:  map[string]*s3Object{},
+		uploads:  make(chan *s3Object, s3UploadQueueCapacity),
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	switch s3Cfg.Compression {
+	case "":
+		s3Cfg.Compression = s3CompressionGzip
+	case s3CompressionGzip, s3CompressionNone:
+	default:
+		return nil, fmt.Errorf("init receiver %s, compression %s not supported, must be %s or %s", S3SinkName, s3Cfg.Compression, s3CompressionGzip, s3CompressionNone)
+	}
+	switch s3Cfg.Format {
+	case "", s3FormatNDJSON:
+		s3Cfg.Format = s3FormatNDJSON
+		s.ext = ".ndjson"
+		if s3Cfg.Compression == s3CompressionGzip {
+			s.ext += ".gz"
+		}
+	case s3FormatParquet:
+		if len(s3Cfg.Layout) > 0 {
+			return nil, fmt.Errorf("init receiver %s, layout isn't supported by format %s", S3SinkName, s3FormatParquet)
+		}
+		s.ext = ".parquet"
+	default:
+		return nil, fmt.Errorf("init receiver %s, format %s not supported, must be %s or %s", S3SinkName, s3Cfg.Format, s3FormatNDJSON, s3FormatParquet)
+	}
+
+	var err error
+	if s.keyTmpl, err = template.New("key").Funcs(sprig.TxtFuncMap()).Option("missingkey=zero").Parse(s3Cfg.Key); err != nil {
+		return nil, fmt.Errorf("init receiver %s, parse key template failed: %v", S3SinkName, err)
+	}
+	if s.uploader, err = s3Cfg.newUploader(); err != nil {
+		return nil, fmt.Errorf("init receiver %s failed: %v", S3SinkName, err)
+	}
+
+	for i := 0; i < s3Cfg.Concurrency; i++ {
+		s.wg.Add(1)
+		go s.uploadLoop()
+	}
+	go s.flushLoop()
+	klog.Infof("S3 endpoint: %s, bucket: %s", s3Cfg.Endpoint, s3Cfg.Bucket)
+	return s, nil
+}
+
+func (c *s3Config) newUploader() (*manager.Uploader, error) {
+	// the sdk requires the buildable client to load AWS_CA_BUNDLE.
+	httpClient := awshttp.NewBuildableClient()
+	if c.TLSConfig != nil {
+		tlsCfg, err := c.TLSConfig.build()
+		if err != nil {
+			return nil, fmt.Errorf("build tls config failed: %v", err)
+		}
+		httpClient = httpClient.WithTransportOptions(func(tr *http.Transport) {
+			tr.TLSClientConfig = tlsCfg
+		})
+	}
+	maxRetries := defaultS3Retry
+	if c.MaxRetries != nil {
+		maxRetries = *c.MaxRetries
+	}
+
+	opts := []func(*config.LoadOptions) error{
+		config.WithRegion(c.Region),
+		config.WithHTTPClient(httpClient),
+		// the attempts include the first request.
+		config.WithRetryMaxAttempts(maxRetries + 1),
+	}
+	if c.AccessKeyID != "" {
+		opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(c.AccessKeyID, c.SecretAccessKey, c.SessionToken)))
+	}
+	awsCfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("load aws config failed: %v", err)
+	}
+
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		o.UsePathStyle = c.ForcePathStyle
+		if c.Endpoint != "" {
+			o.BaseEndpoint = aws.String(c.Endpoint)
+		}
+	})
+	return manager.NewUploader(client, func(u *manager.Uploader) {
+		if c.PartSizeMB > 0 {
+			u.PartSize = int64(c.PartSizeMB) * 1024 * 1024
+		}
+		if u.PartSize < manager.MinUploadPartSize {
+			u.PartSize = manager.MinUploadPartSize
+		}
+	}), nil
+}
+
+// Send appends the event to the object of its partition.
+func (s *s3Sink) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	var (
+		line []byte
+		row  *s3ParquetRow
+		err  error
+	)
+	if s.Format == s3FormatParquet {
+		row = newS3ParquetRow(ev)
+	} else if line, err = serializeEventWithLayout(s.Layout, ev); err != nil {
+		return err
+	}
+	ts := ev.GetLastTimestamp().UTC()
+	if ts.IsZero() {
+		ts = time.Now().UTC()
+	}
+	date := time.Date(ts.Year(), ts.Month(), ts.Day(), 0, 0, 0, 0, time.UTC)
+	partition := ev.InvolvedObject.ClusterName + "/" + date.Format("2006-01-02")
+
+	s.Lock()
+	if s.stopped {
+		s.Unlock()
+		return fmt.Errorf("receiver %s is closed", S3SinkName)
+	}
+	obj, ok := s.objects[partition]
+	if !ok {
+		if obj, err = s.newObject(ev.InvolvedObject.ClusterName, date); err != nil {
+			s.Unlock()
+			return err
+		}
+		s.objects[partition] = obj
+	}
+	if row != nil {
+		err = obj.writeRow(row)
+	} else {
+		err = obj.write(line)
+	}
+	if err != nil {
+		s.Unlock()
+		return err
+	}
+	if obj.size < s.maxSize {
+		s.Unlock()
+		return nil
+	}
+	delete(s.objects, partition)
+	s.sending.Add(1)
+	s.Unlock()
+
+	defer s.sending.Done()
+	s.enqueue(ctx, obj)
+	return nil
+}
+
+// Close uploads the open objects and waits for the uploads, the events sent after
+// Close are rejected.
+func (s *s3Sink) Close() {
+	s.Lock()
+	s.stopped = true
+	s.Unlock()
+	s.sending.Wait()
+
+	close(s.stopCh)
+	<-s.done
+	close(s.uploads)
+	s.wg.Wait()
+}
+
+func (s *s3Sink) newObject(cluster string, date time.Time) (*s3Object, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	obj := &s3Object{
+		key:     s3ObjectKey{Cluster: cluster, Date: date, Time: time.Now().UTC(), ID: hex.EncodeToString(id)},
+		buf:     &bytes.Buffer{},
+		created: time.Now(),
+	}
+	obj.w = obj.buf
+	if s.Format == s3FormatParquet {
+		pw, err := writer.NewParquetWriterFromWriter(obj.buf, new(s3ParquetRow), 1)
+		if err != nil {
+			return nil, err
+		}
+		pw.CompressionType = parquet.CompressionCodec_UNCOMPRESSED
+		if s.Compression == s3CompressionGzip {
+			pw.CompressionType = parquet.CompressionCodec_GZIP
+		}
+		obj.pw = pw
+	} else if s.Compression == s3CompressionGzip {
+		obj.gz = gzip.NewWriter(obj.buf)
+		obj.w = obj.gz
+	}
+	return obj, nil
+}
+
+func newS3ParquetRow(ev *kube.EnhancedEvent) *s3ParquetRow {
+	last := ev.GetLastTimestamp().UTC()
+	first := ev.FirstTimestamp.Time.UTC()
+	if ev.FirstTimestamp.IsZero() {
+		first = last
+	}
+	ref := ev.Event.InvolvedObject
+	return &s3ParquetRow{
+		Cluster:           ev.InvolvedObject.ClusterName,
+		UID:               string(ev.UID),
+		Namespace:         ev.Namespace,
+		Name:              ev.Name,
+		Kind:              ref.Kind,
+		ObjectNamespace:   ref.Namespace,
+		ObjectName:        ref.Name,
+		ObjectUID:         string(ref.UID),
+		Type:              ev.Type,
+		Reason:            ev.Reason,
+		Message:           ev.Message,
+		SourceComponent:   ev.Source.Component,
+		SourceHost:        ev.Source.Host,
+		Count:             ev.Count,
+		FirstTimestamp:    first.UnixMilli(),
+		LastTimestamp:     last.UnixMilli(),
+		Labels:            ev.Labels,
+		Annotations:       ev.Annotations,
+		ObjectLabels:      ev.InvolvedObject.Labels,
+		ObjectAnnotations: ev.InvolvedObject.Annotations,
+	}
+}
+
+// size estimates the uncompressed size of row.
+func (r *s3ParquetRow) size() int {
+	// count and timestamps.
+	size := 4 + 8 + 8
+	for _, v := range []string{r.Cluster, r.UID, r.Namespace, r.Name, r.Kind, r.ObjectNamespace, r.ObjectName,
+		r.ObjectUID, r.Type, r.Reason, r.Message, r.SourceComponent, r.SourceHost} {
+		size += len(v)
+	}
+	for _, m := range []map[string]string{r.Labels, r.Annotations, r.ObjectLabels, r.ObjectAnnotations} {
+		for k, v := range m {
+			size += len(k) + len(v)
+		}
+	}
+	return size
+}
+
+func (o *s3Object) write(line []byte) error {
+	if _, err := o.w.Write(line); err != nil {
+		return err
+	}
+	if _, err := o.w.Write([]byte{'\n'}); err != nil {
+		return err
+	}
+	o.size += len(line) + 1
+	o.lines++
+	return nil
+}
+
+func (o *s3Object) writeRow(row *s3ParquetRow) error {
+	if err := o.pw.Write(row); err != nil {
+		return err
+	}
+	o.size += row.size()
+	o.lines++
+	return nil
+}
+
+// close flushes the buffered data of object, it's called before upload.
+func (o *s3Object) close() error {
+	if o.pw != nil {
+		return o.pw.WriteStop()
+	}
+	if o.gz != nil {
+		return o.gz.Close()
+	}
+	return nil
+}
+
+// enqueue queues the full object, the object is kept in pending when ctx is done.
+func (s *s3Sink) enqueue(ctx context.Context, obj *s3Object) {
+	select {
+	case s.uploads <- obj:
+	case <-ctx.Done():
+		klog.Warningf("Receiver %s upload queue is full, object of %d events is delayed to next flush.", S3SinkName, obj.lines)
+		s.Lock()
+		s.pending = append(s.pending, obj)
+		s.Unlock()
+	}
+}
+
+// flushLoop uploads the objects opened longer than flush interval, and all the objects
+// when the sink is closed.
+func (s *s3Sink) flushLoop() {
+	defer close(s.done)
+
+	interval := s.FlushInterval / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			s.flush(true)
+			return
+		case <-ticker.C:
+			s.flush(false)
+		}
+	}
+}
+
+func (s *s3Sink) flush(all bool) {
+	s.Lock()
+	expired := s.pending
+	s.pending = nil
+	for partition, obj := range s.objects {
+		if all || time.Since(obj.created) >= s.FlushInterval {
+			expired = append(expired, obj)
+			delete(s.objects, partition)
+		}
+	}
+	s.Unlock()
+
+	for _, obj := range expired {
+		s.uploads <- obj
+	}
+}
+
+func (s *s3Sink) uploadLoop() {
+	defer s.wg.Done()
+
+	for obj := range s.uploads {
+		key, err := s.upload(obj)
+		if err != nil {
+			klog.Errorf("Receiver %s upload object %s of %d events failed: %+v", S3SinkName, key, obj.lines, err)
+			continue
+		}
+		klog.V(4).Infof("Receiver %s upload object %s of %d events.", S3SinkName, key, obj.lines)
+	}
+}
+
+func (s *s3Sink) upload(obj *s3Object) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := s.keyTmpl.Execute(buf, obj.key); err != nil {
+		return "", fmt.Errorf("render key failed: %v", err)
+	}
+	key := strings.TrimPrefix(buf.String(), "/") + s.ext
+
+	if err := obj.close(); err != nil {
+		return key, err
+	}
+	contentType := "application/x-ndjson"
+	switch {
+	case obj.pw != nil:
+		contentType = "application/vnd.apache.parquet"
+	case obj.gz != nil:
+		contentType = "application/gzip"
+	}
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(obj.buf.Bytes()),
+		ContentType: aws.String(contentType),
+	}
+	if s.StorageClass != "" {
+		input.StorageClass = types.StorageClass(s.StorageClass)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+	_, err := s.uploader.Upload(ctx, input)
+	return key, err
+}
@@ -0,0 +1,224 @@
+package sinks
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeS3Server is a path style s3 stand-in supports put object and multipart upload.
+type fakeS3Server struct {
+	*recordingServer
+	objects map[string][]byte
+	// parts are the uploaded parts by upload id and part number.
+	parts      map[string]map[int][]byte
+	multiparts int
+}
+
+func newFakeS3Server() *fakeS3Server {
+	s := &fakeS3Server{objects: map[string][]byte{}, parts: map[string]map[int][]byte{}}
+	s.recordingServer = newRecordingServer(s.handle)
+	return s
+}
+
+func (s *fakeS3Server) handle(w http.ResponseWriter, r *recordedRequest) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+	body := r.Body
+	uploadID := query.Get("uploadId")
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		uploadID = strconv.Itoa(len(s.parts) + 1)
+		s.parts[uploadID] = map[int][]byte{}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>archive</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", key, uploadID)
+	case r.Method == http.MethodPut && uploadID != "":
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		s.parts[uploadID][n] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, n))
+	case r.Method == http.MethodPost && uploadID != "":
+		numbers := []int{}
+		for n := range s.parts[uploadID] {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		object := []byte{}
+		for _, n := range numbers {
+			object = append(object, s.parts[uploadID][n]...)
+		}
+		s.objects[key] = object
+		s.multiparts++
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><Bucket>archive</Bucket><Key>%s</Key><ETag>\"x\"</ETag></CompleteMultipartUploadResult>", key)
+	case r.Method == http.MethodPut:
+		s.objects[key] = body
+		w.Header().Set("ETag", `"x"`)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func (s *fakeS3Server) keys() []string {
+	s.Lock()
+	defer s.Unlock()
+	keys := []string{}
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func newTestS3Sink(t *testing.T, url string, cfg map[string]interface{}) *s3Sink {
+	cfg["bucket"] = "archive"
+	cfg["endpoint"] = url
+	cfg["forcePathStyle"] = true
+	cfg["accessKeyID"] = "minio"
+	cfg["secretAccessKey"] = "minio123"
+	sink, err := NewS3Sink(cfg)
+	require.NoError(t, err)
+	return sink.(*s3Sink)
+}
+
+func TestS3PartitionAndGzip(t *testing.T) {
+	srv := newFakeS3Server()
+	defer srv.Close()
+
+	sink := newTestS3Sink(t, srv.URL, map[string]interface{}{
+		"key":    `{{ .Cluster }}/{{ .Date.Format "2006/01/02" }}/events`,
+		"layout": map[string]interface{}{"reason": "{{ .Reason }}"},
+	})
+	day := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	for _, item := range []struct {
+		cluster string
+		ts      time.Time
+	}{
+		{"a", day},
+		{"a", day.Add(time.Hour)},
+		{"a", day.Add(time.Hour * 24)},
+		{"b", day},
+	} {
+		ev := buildTestEvent("nginx.backoff", "BackOff", 1)
+		ev.InvolvedObject.ClusterName = item.cluster
+		ev.LastTimestamp = metav1.NewTime(item.ts)
+		require.NoError(t, sink.Send(context.TODO(), ev))
+	}
+	require.Empty(t, srv.keys())
+
+	// the open objects are uploaded on close.
+	sink.Close()
+	require.Equal(t, []string{
+		"archive/a/2023/05/01/events.ndjson.gz",
+		"archive/a/2023/05/02/events.ndjson.gz",
+		"archive/b/2023/05/01/events.ndjson.gz",
+	}, srv.keys())
+
+	r, err := gzip.NewReader(bytes.NewReader(srv.objects["archive/a/2023/05/01/events.ndjson.gz"]))
+	require.NoError(t, err)
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "{\"reason\":\"BackOff\"}\n{\"reason\":\"BackOff\"}\n", string(b))
+}
+
+func TestS3MultipartUpload(t *testing.T) {
+	srv := newFakeS3Server()
+	defer srv.Close()
+
+	sink := newTestS3Sink(t, srv.URL, map[string]interface{}{
+		"compression":     "none",
+		"maxObjectSizeMB": 6,
+		"partSizeMB":      5,
+		"flushInterval":   "1h",
+	})
+	defer sink.Close()
+
+	ev := buildTestEvent("nginx.backoff", "BackOff", 1)
+	ev.Message = strings.Repeat("x", 64*1024)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, sink.Send(context.TODO(), ev))
+	}
+
+	// the object is uploaded when it exceeds max size.
+	require.Eventually(t, func() bool { return len(srv.keys()) == 1 }, time.Second*10, time.Millisecond*20)
+	key := srv.keys()[0]
+	require.True(t, strings.HasPrefix(key, "archive/events/cluster=test/date="), key)
+	require.True(t, strings.HasSuffix(key, ".ndjson"), key)
+	srv.Lock()
+	defer srv.Unlock()
+	require.Equal(t, 1, srv.multiparts)
+	require.Greater(t, len(srv.objects[key]), 6*1024*1024)
+	require.Equal(t, byte('\n'), srv.objects[key][len(srv.objects[key])-1])
+}
+
+func TestS3Parquet(t *testing.T) {
+	srv := newFakeS3Server()
+	defer srv.Close()
+
+	sink := newTestS3Sink(t, srv.URL, map[string]interface{}{
+		"key":    "{{ .Cluster }}/events",
+		"format": "parquet",
+	})
+	first := buildTestEvent("nginx.backoff", "BackOff", 1)
+	first.InvolvedObject.Labels = map[string]string{"app": "nginx"}
+	require.NoError(t, sink.Send(context.TODO(), first))
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.started", "Started", 2)))
+	sink.Close()
+	require.Equal(t, []string{"archive/test/events.parquet"}, srv.keys())
+
+	pf, err := buffer.NewBufferFile(srv.objects["archive/test/events.parquet"])
+	require.NoError(t, err)
+	pr, err := reader.NewParquetReader(pf, new(s3ParquetRow), 1)
+	require.NoError(t, err)
+	defer pr.ReadStop()
+	require.Equal(t, int64(2), pr.GetNumRows())
+	rows := make([]s3ParquetRow, 2)
+	require.NoError(t, pr.Read(&rows))
+	require.Equal(t, "test", rows[0].Cluster)
+	require.Equal(t, "BackOff", rows[0].Reason)
+	require.Equal(t, first.LastTimestamp.UnixMilli(), rows[0].LastTimestamp)
+	require.Equal(t, map[string]string{"app": "nginx"}, rows[0].ObjectLabels)
+	require.Equal(t, "Started", rows[1].Reason)
+	require.Equal(t, int32(2), rows[1].Count)
+
+	_, err = NewS3Sink(map[string]interface{}{
+		"bucket": "archive",
+		"format": "parquet",
+		"layout": map[string]interface{}{"reason": "{{ .Reason }}"},
+	})
+	require.Error(t, err)
+}
+
+func TestS3QueueFullAndClosed(t *testing.T) {
+	srv := newFakeS3Server()
+	defer srv.Close()
+
+	sink := newTestS3Sink(t, srv.URL, map[string]interface{}{
+		"key":           "{{ .Cluster }}/{{ .ID }}",
+		"flushInterval": "1h",
+	})
+	// every event fills an object.
+	sink.maxSize = 1
+	ev := buildTestEvent("nginx.backoff", "BackOff", 1)
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	for i := 0; i < s3UploadQueueCapacity*2; i++ {
+		require.NoError(t, sink.Send(ctx, ev))
+	}
+	sink.Close()
+	// the objects not queued are uploaded on close.
+	require.Len(t, srv.keys(), s3UploadQueueCapacity*2)
+
+	require.Error(t, sink.Send(context.TODO(), ev))
+}
@@ -0,0 +1,97 @@
+package sinks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordedRequest is a request received by recordingServer.
+type recordedRequest struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	Body   []byte
+	// Status is the status code of response.
+	Status int
+}
+
+// jsonBody returns the body as JSON object.
+func (r *recordedRequest) jsonBody(t *testing.T) map[string]interface{} {
+	payload := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(r.Body, &payload))
+	return payload
+}
+
+// recordingServer records every request it received, it's the stand-in of http receivers.
+type recordingServer struct {
+	*httptest.Server
+	sync.Mutex
+	recorded []*recordedRequest
+}
+
+// newRecordingServer starts a recordingServer responding with reply, reply is called with
+// the lock held so it can keep the state of fakes. The response is 200 when reply is nil.
+func newRecordingServer(reply func(rw http.ResponseWriter, req *recordedRequest)) *recordingServer {
+	s := &recordingServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := &recordedRequest{Method: r.Method, URL: r.URL, Header: r.Header, Body: body, Status: http.StatusOK}
+
+		s.Lock()
+		defer s.Unlock()
+		s.recorded = append(s.recorded, req)
+		if reply != nil {
+			reply(&statusRecorder{ResponseWriter: rw, req: req}, req)
+		}
+	}))
+	return s
+}
+
+// requests returns a copy of the recorded requests.
+func (s *recordingServer) requests() []recordedRequest {
+	s.Lock()
+	defer s.Unlock()
+	requests := make([]recordedRequest, 0, len(s.recorded))
+	for _, req := range s.recorded {
+		requests = append(requests, *req)
+	}
+	return requests
+}
+
+// payloads returns the JSON object bodies of the recorded requests.
+func (s *recordingServer) payloads(t *testing.T) []map[string]interface{} {
+	payloads := []map[string]interface{}{}
+	for _, req := range s.requests() {
+		payloads = append(payloads, req.jsonBody(t))
+	}
+	return payloads
+}
+
+func (s *recordingServer) count() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.recorded)
+}
+
+func (s *recordingServer) host() string {
+	u, _ := url.Parse(s.URL)
+	return u.Host
+}
+
+// statusRecorder keeps the status code of response in the recorded request.
+type statusRecorder struct {
+	http.ResponseWriter
+	req *recordedRequest
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	w.req.Status = code
+	w.ResponseWriter.WriteHeader(code)
+}
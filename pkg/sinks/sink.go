@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/champly/eventexporter/pkg/kube"
+	corev1 "k8s.io/api/core/v1"
 )
 
 // Sink is the interface that the third-party providers should implement. It should just get the event and
@@ -14,5 +15,11 @@ type Sink interface {
 	Close()
 }
 
+// ObjectDeleteNotifier is an optional interface for sinks that keep state per involved object
+// and want to be told when that object has been deleted.
+type ObjectDeleteNotifier interface {
+	OnObjectDeleted(ctx context.Context, clusterName string, reference *corev1.ObjectReference) error
+}
+
 // build sink func
 type NewSinkFunc func(cfg interface{}) (Sink, error)
@@ -0,0 +1,407 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/champly/eventexporter/pkg/kube"
+	"github.com/google/uuid"
+	"k8s.io/klog/v2"
+)
+
+const (
+	SplunkSinkName = "splunk"
+
+	splunkEventPath            = "/services/collector/event"
+	splunkAckPath              = "/services/collector/ack"
+	defaultSplunkSource        = "eventexporter"
+	defaultSplunkSourceType    = "kube:event"
+	defaultSplunkHost          = "{{ .InvolvedObject.ClusterName }}"
+	defaultSplunkBatchSize     = 100
+	defaultSplunkBatchInterval = time.Second * 2
+	defaultSplunkTimeout       = time.Second * 10
+	defaultSplunkRetry         = 3
+	defaultSplunkAckTimeout    = time.Minute
+	defaultSplunkAckInterval   = time.Second
+	defaultSplunkCloseTimeout  = time.Second * 10
+	splunkQueueCapacity        = 10
+)
+
+func init() {
+	factory[SplunkSinkName] = NewSplunkSink
+}
+
+type splunkConfig struct {
+	// URL is the address of http event collector, e.g. https://splunk:8088, the event
+	// path is appended when the path is empty.
+	URL   string `yaml:"url"`
+	Token string `yaml:"token"`
+	// Index, Source, SourceType and Host are the templates of event metadata, empty
+	// index uses the default index of token.
+	Index      string `yaml:"index"`
+	Source     string `yaml:"source"`
+	SourceType string `yaml:"sourceType"`
+	Host       string `yaml:"host"`
+	// Fields are the templates of indexed fields.
+	Fields map[string]string `yaml:"fields"`
+	// Layout is the event layout, the whole event is sent when it's empty.
+	Layout map[string]interface{} `yaml:"layout"`
+	// Ack waits for the indexer acknowledgement of every batch, the token must enable
+	// indexer acknowledgement.
+	Ack              *splunkAckConfig `yaml:"ack"`
+	HTTPClientConfig httpClientConfig `yaml:",inline"`
+	BatchSize        int              `yaml:"batchSize"`
+	BatchInterval    time.Duration    `yaml:"batchInterval"`
+	Timeout          time.Duration    `yaml:"timeout"`
+	MaxRetries       *int             `yaml:"maxRetries"`
+}
+
+type splunkAckConfig struct {
+	// Channel is the request channel, a random uuid is used when it's empty.
+	Channel string `yaml:"channel"`
+	// Timeout resends the batch when it's not acknowledged within it, the batches are posted
+	// without waiting for the acks of previous ones.
+	Timeout      time.Duration `yaml:"timeout"`
+	PollInterval time.Duration `yaml:"pollInterval"`
+	// CloseTimeout is the max time waiting for the acks of posted batches on close, the
+	// batches not acknowledged are dropped.
+	CloseTimeout time.Duration `yaml:"closeTimeout"`
+}
+
+type splunkEvent struct {
+	Time       json.Number       `json:"time"`
+	Host       string            `json:"host,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	SourceType string            `json:"sourcetype,omitempty"`
+	Index      string            `json:"index,omitempty"`
+	Event      json.RawMessage   `json:"event"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+type splunkResponse struct {
+	Text  string `json:"text"`
+	Code  int    `json:"code"`
+	AckID *int64 `json:"ackId"`
+}
+
+// splunkBatch is a posted batch waiting for ack.
+type splunkBatch struct {
+	body   []byte
+	events int
+	posted time.Time
+	// resent is the number of times the batch is resent after ack timeout.
+	resent int
+}
+
+type splunk struct {
+	*splunkConfig
+	eventURL   string
+	ackURL     string
+	client     *http.Client
+	maxRetries int
+	batcher    *batcher[*splunkEvent]
+
+	// pending are the batches waiting for ack by ack id.
+	pending map[int64]*splunkBatch
+	sync.Mutex
+	stopCh chan struct{}
+	done   chan struct{}
+}
+
+func NewSplunkSink(cfg interface{}) (Sink, error) {
+	splunkCfg := &splunkConfig{}
+	if err := unmarshalConfig(SplunkSinkName, cfg, splunkCfg); err != nil {
+		return nil, err
+	}
+	if splunkCfg.URL == "" || splunkCfg.Token == "" {
+		return nil, fmt.Errorf("init receiver %s, url and token must be set", SplunkSinkName)
+	}
+	u, err := url.Parse(splunkCfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s, parse url %s failed: %v", SplunkSinkName, splunkCfg.URL, err)
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		u.Path = splunkEventPath
+	}
+	ackURL := *u
+	ackURL.Path = splunkAckPath
+
+	if splunkCfg.Source == "" {
+		splunkCfg.Source = defaultSplunkSource
+	}
+	if splunkCfg.SourceType == "" {
+		splunkCfg.SourceType = defaultSplunkSourceType
+	}
+	if splunkCfg.Host == "" {
+		splunkCfg.Host = defaultSplunkHost
+	}
+	if splunkCfg.BatchSize <= 0 {
+		splunkCfg.BatchSize = defaultSplunkBatchSize
+	}
+	if splunkCfg.BatchInterval <= 0 {
+		splunkCfg.BatchInterval = defaultSplunkBatchInterval
+	}
+	if splunkCfg.Timeout <= 0 {
+		splunkCfg.Timeout = defaultSplunkTimeout
+	}
+	if ack := splunkCfg.Ack; ack != nil {
+		if ack.Channel == "" {
+			ack.Channel = uuid.NewString()
+		}
+		if ack.Timeout <= 0 {
+			ack.Timeout = defaultSplunkAckTimeout
+		}
+		if ack.PollInterval <= 0 {
+			ack.PollInterval = defaultSplunkAckInterval
+		}
+		if ack.CloseTimeout <= 0 {
+			ack.CloseTimeout = defaultSplunkCloseTimeout
+		}
+	}
+
+	client, err := splunkCfg.HTTPClientConfig.newHTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s http client failed: %v", SplunkSinkName, err)
+	}
+	s := &splunk{
+		splunkConfig: splunkCfg,
+		eventURL:     u.String(),
+		ackURL:       ackURL.String(),
+		client:       client,
+		maxRetries:   defaultSplunkRetry,
+	}
+	if splunkCfg.MaxRetries != nil {
+		s.maxRetries = *splunkCfg.MaxRetries
+	}
+	s.batcher = newBatcher(splunkCfg.BatchSize, splunkCfg.BatchInterval, splunkCfg.BatchSize*splunkQueueCapacity, s.flush)
+	if splunkCfg.Ack != nil {
+		s.pending = map[int64]*splunkBatch{}
+		s.stopCh = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.ackLoop()
+	}
+	klog.Infof("Splunk url: %s, ack: %t", s.eventURL, splunkCfg.Ack != nil)
+	return s, nil
+}
+
+// Send queues the event, the events are posted in batch.
+func (s *splunk) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	event, err := s.buildEvent(ev)
+	if err != nil {
+		return err
+	}
+	return s.batcher.add(event)
+}
+
+// Close flushes the queued events and waits for the acks of posted batches.
+func (s *splunk) Close() {
+	s.batcher.stop()
+	if s.Ack != nil {
+		close(s.stopCh)
+		<-s.done
+	}
+}
+
+func (s *splunk) buildEvent(ev *kube.EnhancedEvent) (*splunkEvent, error) {
+	body, err := serializeEventWithLayout(s.Layout, ev)
+	if err != nil {
+		return nil, err
+	}
+	ts := ev.GetLastTimestamp()
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	event := &splunkEvent{
+		Time:   json.Number(strconv.FormatFloat(float64(ts.UnixMilli())/1000, 'f', 3, 64)),
+		Event:  body,
+		Fields: getLayoutLabels(ev, s.Fields),
+	}
+	for _, f := range []struct {
+		name string
+		text string
+		out  *string
+	}{
+		{"index", s.Index, &event.Index},
+		{"source", s.Source, &event.Source},
+		{"sourceType", s.SourceType, &event.SourceType},
+		{"host", s.Host, &event.Host},
+	} {
+		if f.text == "" {
+			continue
+		}
+		v, err := getLayoutString(ev, f.text)
+		if err != nil {
+			return nil, fmt.Errorf("render %s failed: %v", f.name, err)
+		}
+		*f.out = strings.TrimSpace(v)
+	}
+	return event, nil
+}
+
+// flush posts the events with one request, the batch is tracked by ack loop when ack
+// is enabled.
+func (s *splunk) flush(events []*splunkEvent) {
+	body := &bytes.Buffer{}
+	encoder := json.NewEncoder(body)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			klog.Errorf("Receiver %s encode event failed: %+v", SplunkSinkName, err)
+		}
+	}
+	s.postBatch(&splunkBatch{body: body.Bytes(), events: len(events)})
+}
+
+func (s *splunk) postBatch(batch *splunkBatch) {
+	var ackID int64
+	err := sendWithRetry(context.Background(), s.maxRetries, func(ctx context.Context) error {
+		postCtx, cancel := context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+		resp, err := s.post(postCtx, s.eventURL, batch.body)
+		if err != nil || s.Ack == nil {
+			return err
+		}
+		if resp.AckID == nil {
+			return newStatusError(http.StatusBadRequest, fmt.Errorf("ack id is missing, enable indexer acknowledgement of token"))
+		}
+		ackID = *resp.AckID
+		return nil
+	})
+	if err != nil {
+		klog.Errorf("Receiver %s post %d events failed: %+v", SplunkSinkName, batch.events, err)
+		return
+	}
+	if s.Ack == nil {
+		klog.V(4).Infof("Receiver %s post %d events success.", SplunkSinkName, batch.events)
+		return
+	}
+
+	batch.posted = time.Now()
+	s.Lock()
+	s.pending[ackID] = batch
+	s.Unlock()
+}
+
+// ackLoop polls the acks of pending batches, the batches not acknowledged within ack
+// timeout are posted again. It exits after all the batches are done or close timeout
+// when closed.
+func (s *splunk) ackLoop() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.Ack.PollInterval)
+	defer ticker.Stop()
+
+	var closeTimeout <-chan time.Time
+	stopCh, stopped := s.stopCh, false
+	for {
+		select {
+		case <-stopCh:
+			stopCh, stopped = nil, true
+			closeTimeout = time.After(s.Ack.CloseTimeout)
+			continue
+		case <-closeTimeout:
+			s.Lock()
+			events := 0
+			for _, batch := range s.pending {
+				events += batch.events
+			}
+			klog.Errorf("Receiver %s drop %d batches of %d events, not acknowledged within close timeout %s.", SplunkSinkName, len(s.pending), events, s.Ack.CloseTimeout)
+			s.Unlock()
+			return
+		case <-ticker.C:
+		}
+
+		s.Lock()
+		ackIDs := make([]int64, 0, len(s.pending))
+		for ackID := range s.pending {
+			ackIDs = append(ackIDs, ackID)
+		}
+		s.Unlock()
+		if len(ackIDs) == 0 {
+			if stopped {
+				return
+			}
+			continue
+		}
+
+		acks, err := s.pollAcks(ackIDs)
+		if err != nil {
+			klog.V(4).Infof("Receiver %s poll %d acks failed: %v", SplunkSinkName, len(ackIDs), err)
+		}
+		expired := []*splunkBatch{}
+		s.Lock()
+		for _, ackID := range ackIDs {
+			batch := s.pending[ackID]
+			switch {
+			case acks[strconv.FormatInt(ackID, 10)]:
+				delete(s.pending, ackID)
+				klog.V(4).Infof("Receiver %s post %d events success.", SplunkSinkName, batch.events)
+			case time.Since(batch.posted) >= s.Ack.Timeout:
+				delete(s.pending, ackID)
+				expired = append(expired, batch)
+			}
+		}
+		s.Unlock()
+
+		for _, batch := range expired {
+			if batch.resent >= s.maxRetries {
+				klog.Errorf("Receiver %s post %d events failed: ack timeout after %d resends", SplunkSinkName, batch.events, batch.resent)
+				continue
+			}
+			batch.resent++
+			klog.Warningf("Receiver %s resend %d events, ack timeout.", SplunkSinkName, batch.events)
+			s.postBatch(batch)
+		}
+	}
+}
+
+// pollAcks queries the ack status of the ack ids with one request.
+func (s *splunk) pollAcks(ackIDs []int64) (map[string]bool, error) {
+	body, _ := json.Marshal(map[string][]int64{"acks": ackIDs})
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+	resp := &struct {
+		Acks map[string]bool `json:"acks"`
+	}{}
+	return resp.Acks, s.do(ctx, s.ackURL, body, resp)
+}
+
+func (s *splunk) post(ctx context.Context, u string, body []byte) (*splunkResponse, error) {
+	resp := &splunkResponse{}
+	return resp, s.do(ctx, u, body, resp)
+}
+
+func (s *splunk) do(ctx context.Context, u string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Splunk "+s.Token)
+	req.Header.Set("Content-Type", "application/json")
+	if s.Ack != nil {
+		req.Header.Set("X-Splunk-Request-Channel", s.Ack.Channel)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return newNetworkError(err)
+	}
+	defer resp.Body.Close()
+
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return newStatusError(resp.StatusCode, errors.New(string(b)))
+	}
+	if err = json.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("decode response %q failed: %v", b, err)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSplunkHEC is a http event collector stand-in, the batch is acknowledged after
+// the ack endpoint is polled ackAfter times, the lost ack ids are never acknowledged.
+type fakeSplunkHEC struct {
+	*recordingServer
+	ackAfter int
+	lost     map[string]bool
+	events   []splunkEvent
+	channels []string
+	posts    int
+	polls    int
+}
+
+func newFakeSplunkHEC(ackAfter int) *fakeSplunkHEC {
+	s := &fakeSplunkHEC{ackAfter: ackAfter}
+	s.recordingServer = newRecordingServer(s.handle)
+	return s
+}
+
+func (s *fakeSplunkHEC) handle(w http.ResponseWriter, r *recordedRequest) {
+	if r.Header.Get("Authorization") != "Splunk token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"text":"Invalid token","code":4}`)
+		return
+	}
+	switch r.URL.Path {
+	case splunkEventPath:
+		s.posts++
+		s.channels = append(s.channels, r.Header.Get("X-Splunk-Request-Channel"))
+		decoder := json.NewDecoder(bytes.NewReader(r.Body))
+		for decoder.More() {
+			event := splunkEvent{}
+			if err := decoder.Decode(&event); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			s.events = append(s.events, event)
+		}
+		fmt.Fprintf(w, `{"text":"Success","code":0,"ackId":%d}`, s.posts-1)
+	case splunkAckPath:
+		s.polls++
+		req := struct {
+			Acks []int64 `json:"acks"`
+		}{}
+		_ = json.Unmarshal(r.Body, &req)
+		acks := map[string]bool{}
+		for _, id := range req.Acks {
+			acks[fmt.Sprint(id)] = s.polls >= s.ackAfter && !s.lost[fmt.Sprint(id)]
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"acks": acks})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestSplunkBatch(t *testing.T) {
+	srv := newFakeSplunkHEC(0)
+	defer srv.Close()
+
+	sink, err := NewSplunkSink(map[string]interface{}{
+		"url":           srv.URL,
+		"token":         "token",
+		"index":         "k8s-{{ .InvolvedObject.ClusterName }}",
+		"fields":        map[string]string{"namespace": "{{ .Namespace }}"},
+		"layout":        map[string]interface{}{"reason": "{{ .Reason }}"},
+		"batchInterval": "1h",
+	})
+	require.NoError(t, err)
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)))
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.pulled", "Pulled", 1)))
+	sink.Close()
+
+	srv.Lock()
+	defer srv.Unlock()
+	require.Equal(t, 1, srv.posts)
+	require.Len(t, srv.events, 2)
+	event := srv.events[0]
+	require.Equal(t, "k8s-test", event.Index)
+	require.Equal(t, "test", event.Host)
+	require.Equal(t, defaultSplunkSource, event.Source)
+	require.Equal(t, defaultSplunkSourceType, event.SourceType)
+	require.Equal(t, map[string]string{"namespace": "default"}, event.Fields)
+	require.JSONEq(t, `{"reason":"BackOff"}`, string(event.Event))
+	require.Regexp(t, `^\d+\.\d{3}$`, event.Time.String())
+}
+
+func TestSplunkAck(t *testing.T) {
+	srv := newFakeSplunkHEC(3)
+	defer srv.Close()
+
+	sink, err := NewSplunkSink(map[string]interface{}{
+		"url":   srv.URL,
+		"token": "token",
+		"ack": map[string]interface{}{
+			"channel":      "0aa7e21b-0c32-4c3e-9d2d-6e7e4e2e43f4",
+			"pollInterval": "10ms",
+		},
+		"batchInterval": "1h",
+	})
+	require.NoError(t, err)
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)))
+	sink.Close()
+
+	srv.Lock()
+	require.Equal(t, 1, srv.posts)
+	require.Equal(t, 3, srv.polls)
+	require.Equal(t, []string{"0aa7e21b-0c32-4c3e-9d2d-6e7e4e2e43f4"}, srv.channels)
+	srv.Unlock()
+
+	// the batch is resent when it's not acknowledged in time.
+	srv.Lock()
+	srv.ackAfter, srv.polls, srv.posts = 1<<30, 0, 0
+	srv.Unlock()
+	sink, err = NewSplunkSink(map[string]interface{}{
+		"url":   srv.URL,
+		"token": "token",
+		"ack": map[string]interface{}{
+			"timeout":      "50ms",
+			"pollInterval": "10ms",
+		},
+		"batchInterval": "1h",
+		"maxRetries":    1,
+	})
+	require.NoError(t, err)
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)))
+	start := time.Now()
+	sink.Close()
+	require.GreaterOrEqual(t, time.Since(start), time.Millisecond*100)
+
+	srv.Lock()
+	defer srv.Unlock()
+	require.Equal(t, 2, srv.posts)
+	require.NotEmpty(t, srv.channels[len(srv.channels)-1])
+}
+
+func TestSplunkUnauthorized(t *testing.T) {
+	srv := newFakeSplunkHEC(0)
+	defer srv.Close()
+
+	s, err := NewSplunkSink(map[string]interface{}{"url": srv.URL, "token": "invalid"})
+	require.NoError(t, err)
+	defer s.Close()
+	_, err = s.(*splunk).post(context.TODO(), s.(*splunk).eventURL, []byte(`{}`))
+	require.Error(t, err)
+	require.False(t, IsRetryable(err))
+}
+
+func TestSplunkAckTimeoutResend(t *testing.T) {
+	srv := newFakeSplunkHEC(0)
+	defer srv.Close()
+	srv.lost = map[string]bool{"0": true}
+
+	sink, err := NewSplunkSink(map[string]interface{}{
+		"url":   srv.URL,
+		"token": "token",
+		"ack": map[string]interface{}{
+			"timeout":      "100ms",
+			"pollInterval": "10ms",
+		},
+		"layout":    map[string]interface{}{"reason": "{{ .Reason }}"},
+		"batchSize": 1,
+	})
+	require.NoError(t, err)
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)))
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.started", "Started", 1)))
+	sink.Close()
+
+	srv.Lock()
+	defer srv.Unlock()
+	// the second batch is posted without waiting for the ack of first one, and only the
+	// first one is resent.
+	require.Equal(t, 3, srv.posts)
+	reasons := []string{}
+	for _, event := range srv.events {
+		reasons = append(reasons, string(event.Event))
+	}
+	require.Equal(t, []string{`{"reason":"BackOff"}`, `{"reason":"Started"}`, `{"reason":"BackOff"}`}, reasons)
+}
+
+func TestSplunkCloseTimeout(t *testing.T) {
+	srv := newFakeSplunkHEC(1 << 30)
+	defer srv.Close()
+
+	sink, err := NewSplunkSink(map[string]interface{}{
+		"url":   srv.URL,
+		"token": "token",
+		"ack": map[string]interface{}{
+			"pollInterval": "10ms",
+			"closeTimeout": "100ms",
+		},
+		"batchInterval": "1h",
+	})
+	require.NoError(t, err)
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.backoff", "BackOff", 1)))
+	start := time.Now()
+	sink.Close()
+	// the batch is dropped instead of waiting for the ack timeout.
+	require.Less(t, time.Since(start), time.Second*5)
+	require.Len(t, sink.(*splunk).pending, 1)
+}
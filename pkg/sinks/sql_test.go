@@ -0,0 +1,131 @@
+package sinks
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSQLUpsertAndRetention(t *testing.T) {
+	dsn := "file:" + filepath.Join(t.TempDir(), "events.db")
+	cfg := map[string]interface{}{
+		"driver":        "sqlite",
+		"dsn":           dsn,
+		"table":         "k8s_events",
+		"batchInterval": "1h",
+		"retention":     "1h",
+	}
+	sink, err := NewSQLSink(cfg)
+	require.NoError(t, err)
+
+	ev := buildTestEvent("nginx.backoff", "BackOff", 1)
+	ev.UID = "event-1"
+	ev.InvolvedObject.Labels = map[string]string{"app": "nginx"}
+	require.NoError(t, sink.Send(context.TODO(), ev))
+	updated := buildTestEvent("nginx.backoff", "BackOff", 3)
+	updated.UID = ev.UID
+	updated.Message = "Back-off 3 times"
+	updated.LastTimestamp = metav1.NewTime(ev.LastTimestamp.Add(time.Minute))
+	require.NoError(t, sink.Send(context.TODO(), updated))
+	// the stale event doesn't decrease the count or overwrite the message.
+	require.NoError(t, sink.Send(context.TODO(), ev))
+
+	expired := buildTestEvent("nginx.pulled", "Pulled", 1)
+	expired.UID = "event-2"
+	expired.LastTimestamp = metav1.NewTime(time.Now().Add(-time.Hour * 2))
+	require.NoError(t, sink.Send(context.TODO(), expired))
+	sink.Close()
+
+	// the migrations are applied once.
+	sink, err = NewSQLSink(cfg)
+	require.NoError(t, err)
+	require.NoError(t, sink.(*sqlSink).deleteExpired(context.TODO()))
+	sink.Close()
+
+	db, err := sql.Open("sqlite", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var versions int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM k8s_events_migrations").Scan(&versions))
+	require.Equal(t, 1, versions)
+
+	var (
+		cluster, uid, message string
+		count                 int
+		last                  time.Time
+		labels, objectLabels  sql.NullString
+	)
+	rows, err := db.Query("SELECT cluster, uid, message, count, last_timestamp, labels, object_labels FROM k8s_events")
+	require.NoError(t, err)
+	defer rows.Close()
+	require.True(t, rows.Next())
+	require.NoError(t, rows.Scan(&cluster, &uid, &message, &count, &last, &labels, &objectLabels))
+	require.Equal(t, "test", cluster)
+	require.Equal(t, "event-1", uid)
+	require.Equal(t, 3, count)
+	require.Equal(t, updated.LastTimestamp.Unix(), last.Unix())
+	require.False(t, labels.Valid)
+	require.Equal(t, `{"app":"nginx"}`, objectLabels.String)
+	// the message of the newest event.
+	require.Equal(t, updated.Message, message)
+	require.False(t, rows.Next())
+}
+
+func TestSQLRejectedRow(t *testing.T) {
+	dsn := "file:" + filepath.Join(t.TempDir(), "events.db")
+	sink, err := NewSQLSink(map[string]interface{}{"driver": "sqlite", "dsn": dsn, "batchInterval": "1h"})
+	require.NoError(t, err)
+	s := sink.(*sqlSink)
+
+	ev := buildTestEvent("nginx.backoff", "BackOff", 1)
+	ev.UID = "event-1"
+	good, err := buildSQLRow(ev)
+	require.NoError(t, err)
+	ev.UID = "event-2"
+	bad, err := buildSQLRow(ev)
+	require.NoError(t, err)
+	// namespace is not null.
+	bad[2] = nil
+
+	err = s.upsert(context.TODO(), [][]interface{}{good, bad})
+	require.Error(t, err)
+	require.False(t, IsRetryable(err))
+
+	// only the rejected row is dropped.
+	s.flush([][]interface{}{good, bad})
+	var uid string
+	require.NoError(t, s.db.QueryRow("SELECT uid FROM events").Scan(&uid))
+	require.Equal(t, "event-1", uid)
+	sink.Close()
+}
+
+func TestNewSQLError(t *testing.T) {
+	require.False(t, IsRetryable(newSQLError(&pq.Error{Code: "23505"})))
+	require.True(t, IsRetryable(newSQLError(&pq.Error{Code: "57P01"})))
+	require.False(t, IsRetryable(newSQLError(&mysql.MySQLError{Number: 1406, SQLState: [5]byte{'2', '2', '0', '0', '1'}})))
+	require.True(t, IsRetryable(newSQLError(&mysql.MySQLError{Number: 1213, SQLState: [5]byte{'4', '0', '0', '0', '1'}})))
+	require.True(t, IsRetryable(newSQLError(sql.ErrConnDone)))
+}
+
+func TestSQLConfig(t *testing.T) {
+	_, err := NewSQLSink(map[string]interface{}{"driver": "oracle", "dsn": "x"})
+	require.Error(t, err)
+	_, err = NewSQLSink(map[string]interface{}{"driver": "sqlite", "dsn": ":memory:", "table": "events; DROP TABLE x"})
+	require.Error(t, err)
+
+	require.Equal(t,
+		"INSERT INTO events (cluster, uid, namespace, name, kind, object_namespace, object_name, object_uid, type, reason, message, source_component, source_host, count, first_timestamp, last_timestamp, labels, annotations, object_labels, object_annotations) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20) ON CONFLICT (cluster, uid) DO UPDATE SET\n"+
+			"\tmessage = CASE WHEN EXCLUDED.last_timestamp >= events.last_timestamp THEN EXCLUDED.message ELSE events.message END,\n"+
+			"\tcount = GREATEST(events.count, EXCLUDED.count),\n"+
+			"\tlast_timestamp = GREATEST(events.last_timestamp, EXCLUDED.last_timestamp)",
+		buildSQLUpsert(sqlDialects["postgres"], "events"))
+}
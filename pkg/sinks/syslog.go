@@ -0,0 +1,217 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/champly/eventexporter/pkg/kube"
+	"k8s.io/klog/v2"
+)
+
+const (
+	SyslogSinkName = "syslog"
+
+	// https://www.rfc-editor.org/rfc/rfc5424
+	syslogVersion         = 1
+	syslogNilValue        = "-"
+	syslogSDID            = "k8s@32473"
+	syslogSeverityWarning = 4
+	syslogSeverityNotice  = 5
+	syslogSeverityInfo    = 6
+
+	defaultSyslogFacility = "local0"
+	defaultSyslogHostname = "{{ .InvolvedObject.ClusterName }}"
+	defaultSyslogAppName  = "eventexporter"
+	defaultSyslogMsgID    = "{{ .Reason }}"
+	defaultSyslogMessage  = "{{ .Event.InvolvedObject.Kind }}/{{ .Event.InvolvedObject.Name }}: {{ .Message }}"
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11, "ntp": 12, "security": 13, "console": 14,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+func init() {
+	factory[SyslogSinkName] = NewSyslogSink
+}
+
+type syslogConfig struct {
+	netConfig `yaml:",inline"`
+	// Facility is the facility name, e.g. daemon or local0.
+	Facility string `yaml:"facility"`
+	// Hostname, AppName, ProcID, MsgID and Message are templates of the message fields.
+	Hostname string `yaml:"hostname"`
+	AppName  string `yaml:"appName"`
+	ProcID   string `yaml:"procID"`
+	MsgID    string `yaml:"msgID"`
+	Message  string `yaml:"message"`
+	// StructuredData adds templated params to the structured data element.
+	StructuredData map[string]string `yaml:"structuredData"`
+}
+
+type syslog struct {
+	*syslogConfig
+	facility int
+	pool     *connPool
+}
+
+func NewSyslogSink(cfg interface{}) (Sink, error) {
+	syslogCfg := &syslogConfig{}
+	if err := unmarshalConfig(SyslogSinkName, cfg, syslogCfg); err != nil {
+		return nil, err
+	}
+	if syslogCfg.Facility == "" {
+		syslogCfg.Facility = defaultSyslogFacility
+	}
+	facility, ok := syslogFacilities[syslogCfg.Facility]
+	if !ok {
+		return nil, fmt.Errorf("init receiver %s, facility %s not supported", SyslogSinkName, syslogCfg.Facility)
+	}
+	if syslogCfg.Hostname == "" {
+		syslogCfg.Hostname = defaultSyslogHostname
+	}
+	if syslogCfg.AppName == "" {
+		syslogCfg.AppName = defaultSyslogAppName
+	}
+	if syslogCfg.MsgID == "" {
+		syslogCfg.MsgID = defaultSyslogMsgID
+	}
+	if syslogCfg.Message == "" {
+		syslogCfg.Message = defaultSyslogMessage
+	}
+
+	pool, err := syslogCfg.newConnPool(networkUDP)
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s failed: %v", SyslogSinkName, err)
+	}
+	klog.Infof("Syslog %s address: %s", syslogCfg.Network, syslogCfg.Address)
+	return &syslog{syslogConfig: syslogCfg, facility: facility, pool: pool}, nil
+}
+
+func (s *syslog) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	msg, err := s.format(ev)
+	if err != nil {
+		return err
+	}
+	if s.Network != networkUDP {
+		// https://www.rfc-editor.org/rfc/rfc5425#section-4.3 octet counting
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+	return s.pool.write(ctx, msg)
+}
+
+func (s *syslog) Close() {
+	s.pool.close()
+}
+
+// format builds the RFC5424 message.
+func (s *syslog) format(ev *kube.EnhancedEvent) ([]byte, error) {
+	fields := make([]string, 4)
+	for i, f := range []struct {
+		name   string
+		text   string
+		maxLen int
+	}{
+		{"hostname", s.Hostname, 255},
+		{"appName", s.AppName, 48},
+		{"procID", s.ProcID, 128},
+		{"msgID", s.MsgID, 32},
+	} {
+		v, err := getLayoutString(ev, f.text)
+		if err != nil {
+			return nil, fmt.Errorf("render %s failed: %v", f.name, err)
+		}
+		fields[i] = syslogHeaderField(v, f.maxLen)
+	}
+	message, err := getLayoutString(ev, s.Message)
+	if err != nil {
+		return nil, fmt.Errorf("render message failed: %v", err)
+	}
+
+	params := map[string]string{
+		"cluster":   ev.InvolvedObject.ClusterName,
+		"namespace": ev.Event.InvolvedObject.Namespace,
+		"kind":      ev.Event.InvolvedObject.Kind,
+		"name":      ev.Event.InvolvedObject.Name,
+		"reason":    ev.Reason,
+		"type":      ev.Type,
+		"count":     strconv.Itoa(int(ev.Count)),
+	}
+	for k, v := range getLayoutLabels(ev, s.StructuredData) {
+		params[k] = v
+	}
+
+	ts := ev.GetLastTimestamp()
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "<%d>%d %s %s %s %s %s ", s.facility*8+syslogSeverity(ev.Type), syslogVersion,
+		ts.UTC().Format(time.RFC3339Nano), fields[0], fields[1], fields[2], fields[3])
+	b.WriteString("[" + syslogSDID)
+	for _, k := range sortedKeys(params) {
+		if params[k] == "" {
+			continue
+		}
+		fmt.Fprintf(b, ` %s="%s"`, syslogParamName(k), syslogParamEscaper.Replace(params[k]))
+	}
+	b.WriteString("] ")
+	b.WriteString(message)
+	return []byte(b.String()), nil
+}
+
+// syslogParamEscaper escapes '"', '\' and ']' of param value.
+var syslogParamEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+func syslogSeverity(eventType string) int {
+	switch eventType {
+	case "Normal":
+		return syslogSeverityInfo
+	case "Warning":
+		return syslogSeverityWarning
+	}
+	return syslogSeverityNotice
+}
+
+// syslogHeaderField keeps the printable ascii except space and truncates to maxLen,
+// empty value is the nil value.
+func syslogHeaderField(v string, maxLen int) string {
+	v = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, v)
+	if len(v) > maxLen {
+		v = v[:maxLen]
+	}
+	if v == "" {
+		return syslogNilValue
+	}
+	return v
+}
+
+// syslogParamName removes the characters which are invalid in SD-NAME.
+func syslogParamName(name string) string {
+	return syslogHeaderField(strings.Map(func(r rune) rune {
+		if r == '=' || r == ']' || r == '"' {
+			return -1
+		}
+		return r
+	}, name), 32)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,89 @@
+package sinks
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readOctetCounted reads one "LEN MSG" frame.
+func readOctetCounted(t *testing.T, r *bufio.Reader) string {
+	l, err := r.ReadString(' ')
+	require.NoError(t, err)
+	n, err := strconv.Atoi(strings.TrimSpace(l))
+	require.NoError(t, err)
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestSyslogTCPReconnect(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	sink, err := NewSyslogSink(map[string]interface{}{
+		"network":        "tcp",
+		"address":        lis.Addr().String(),
+		"facility":       "daemon",
+		"structuredData": map[string]interface{}{"app": "{{ .InvolvedObject.Labels.app }}"},
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	ev := buildTestEvent("nginx.backoff", "BackOff", 2)
+	ev.Message = `Back-off "restarting"`
+	ev.InvolvedObject.Labels = map[string]string{"app": "nginx]"}
+	require.NoError(t, sink.Send(context.TODO(), ev))
+
+	conn, err := lis.Accept()
+	require.NoError(t, err)
+	msg := readOctetCounted(t, bufio.NewReader(conn))
+	// daemon(3)*8 + warning(4)
+	require.True(t, strings.HasPrefix(msg, "<28>1 "), msg)
+	require.Contains(t, msg, " test eventexporter - BackOff [k8s@32473 app=\"nginx\\]\" cluster=\"test\" count=\"2\" kind=\"Pod\" name=\"nginx\" namespace=\"default\" reason=\"BackOff\" type=\"Warning\"] Pod/nginx: Back-off \"restarting\"")
+
+	// the server closes the connection, the next event is sent with a new connection.
+	conn.Close()
+	time.Sleep(time.Millisecond * 100)
+	require.NoError(t, sink.Send(context.TODO(), buildTestEvent("nginx.started", "Started", 1)))
+	conn, err = lis.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	msg = readOctetCounted(t, bufio.NewReader(conn))
+	require.Contains(t, msg, `reason="Started"`)
+}
+
+func TestSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+
+	sink, err := NewSyslogSink(map[string]interface{}{
+		"address": pc.LocalAddr().String(),
+		"message": "{{ .Message }}",
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	ev := buildTestEvent("nginx.started", "Started", 1)
+	ev.Type = "Normal"
+	ev.Message = "Started container"
+	require.NoError(t, sink.Send(context.TODO(), ev))
+
+	b := make([]byte, 2048)
+	pc.SetReadDeadline(time.Now().Add(time.Second * 5))
+	n, _, err := pc.ReadFrom(b)
+	require.NoError(t, err)
+	// local0(16)*8 + info(6)
+	require.True(t, strings.HasPrefix(string(b[:n]), "<134>1 "))
+	require.True(t, strings.HasSuffix(string(b[:n]), "] Started container"))
+}
@@ -26,6 +26,21 @@ func getLayoutString(ev *kube.EnhancedEvent, text string) (string, error) {
 	return buf.String(), nil
 }
 
+// getLayoutLabels renders label layouts, the latter layout overrides the former and
+// labels with empty value are skipped.
+func getLayoutLabels(ev *kube.EnhancedEvent, layouts ...map[string]string) map[string]string {
+	labels := make(map[string]string)
+	for _, layout := range layouts {
+		for key, value := range layout {
+			m, _ := getLayoutString(ev, value)
+			if len(m) > 0 {
+				labels[key] = m
+			}
+		}
+	}
+	return labels
+}
+
 func convertLayoutTemplate(layout map[string]interface{}, ev *kube.EnhancedEvent) (map[string]interface{}, error) {
 	result := make(map[string]interface{})
 
@@ -0,0 +1,139 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/champly/eventexporter/pkg/kube"
+	"k8s.io/klog/v2"
+)
+
+const (
+	WebhookSinkName = "webhook"
+
+	defaultWebhookTimeout = time.Second * 10
+	defaultWebhookRetry   = 2
+)
+
+func init() {
+	factory[WebhookSinkName] = NewWebhookSink
+}
+
+type webhookConfig struct {
+	URL string `yaml:"url"`
+	// Method is the http method, default is POST.
+	Method string `yaml:"method"`
+	// Headers are the templates of request headers.
+	Headers map[string]string `yaml:"headers"`
+	// Layout is the JSON layout of body, the whole event is sent when it's empty.
+	Layout map[string]interface{} `yaml:"layout"`
+	// CloudEvents sends the body as data of CloudEvents when it's set.
+	CloudEvents      *cloudEventsConfig `yaml:"cloudEvents"`
+	HTTPClientConfig httpClientConfig   `yaml:",inline"`
+	Timeout          time.Duration      `yaml:"timeout"`
+	MaxRetries       *int               `yaml:"maxRetries"`
+}
+
+type webhook struct {
+	*webhookConfig
+	name       string
+	client     *http.Client
+	maxRetries int
+}
+
+func NewWebhookSink(cfg interface{}) (Sink, error) {
+	webhookCfg := &webhookConfig{}
+	if err := unmarshalConfig(WebhookSinkName, cfg, webhookCfg); err != nil {
+		return nil, err
+	}
+	return newWebhookSink(WebhookSinkName, webhookCfg)
+}
+
+func newWebhookSink(name string, cfg *webhookConfig) (Sink, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("init receiver %s, url must be set", name)
+	}
+	if cfg.Method == "" {
+		cfg.Method = http.MethodPost
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultWebhookTimeout
+	}
+	if cfg.CloudEvents != nil {
+		if err := cfg.CloudEvents.complete(); err != nil {
+			return nil, fmt.Errorf("init receiver %s, %v", name, err)
+		}
+	}
+
+	client, err := cfg.HTTPClientConfig.newHTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("init receiver %s http client failed: %v", name, err)
+	}
+
+	w := &webhook{
+		webhookConfig: cfg,
+		name:          name,
+		client:        client,
+		maxRetries:    defaultWebhookRetry,
+	}
+	if cfg.MaxRetries != nil {
+		w.maxRetries = *cfg.MaxRetries
+	}
+	klog.Infof("Webhook %s url: %s", name, cfg.URL)
+	return w, nil
+}
+
+func (w *webhook) Send(ctx context.Context, ev *kube.EnhancedEvent) error {
+	body, err := serializeEventWithLayout(w.Layout, ev)
+	if err != nil {
+		return err
+	}
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	if w.CloudEvents != nil {
+		if header, body, err = w.CloudEvents.encode(ev, body); err != nil {
+			return err
+		}
+	}
+	for k, v := range w.Headers {
+		rendered, err := getLayoutString(ev, v)
+		if err != nil {
+			return fmt.Errorf("render header %s failed: %v", k, err)
+		}
+		header.Set(k, rendered)
+	}
+
+	return sendWithRetry(ctx, w.maxRetries, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, w.Timeout)
+		defer cancel()
+		return w.post(ctx, header, body)
+	})
+}
+
+func (w *webhook) Close() {
+	w.client.CloseIdleConnections()
+}
+
+func (w *webhook) post(ctx context.Context, header http.Header, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, w.Method, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = header.Clone()
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return newNetworkError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		return newStatusError(resp.StatusCode, errors.New(string(b)))
+	}
+	return nil
+}